@@ -0,0 +1,417 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config holds the complete backend configuration.
+// Keys are addressed as "<section>.<field>" using the toml tag names,
+// e.g. "ipc.read_timeout" or the environment variable LITEBASE_IPC_READ_TIMEOUT.
+type Config struct {
+	IPC       IPCConfig       `toml:"ipc" yaml:"ipc"`
+	Log       LogConfig       `toml:"log" yaml:"log"`
+	Pool      PoolConfig      `toml:"pool" yaml:"pool"`
+	Health    HealthConfig    `toml:"health" yaml:"health"`
+	Storage   StorageConfig   `toml:"storage" yaml:"storage"`
+	Cursors   CursorsConfig   `toml:"cursors" yaml:"cursors"`
+	Jobs      JobsConfig      `toml:"jobs" yaml:"jobs"`
+	Schedules SchedulesConfig `toml:"schedules" yaml:"schedules"`
+	Values    ValuesConfig    `toml:"values" yaml:"values"`
+	Secrets   SecretsConfig   `toml:"secrets" yaml:"secrets"`
+	Drivers   DriversConfig   `toml:"drivers" yaml:"drivers"`
+}
+
+// IPCConfig holds the IPC transport settings
+type IPCConfig struct {
+	SocketPath     string   `toml:"socket_path" yaml:"socket_path"`
+	PipeName       string   `toml:"pipe_name" yaml:"pipe_name"`
+	Port           int      `toml:"port" yaml:"port"`
+	ReadTimeout    Duration `toml:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout   Duration `toml:"write_timeout" yaml:"write_timeout"`
+	MaxMessageSize int      `toml:"max_message_size" yaml:"max_message_size"` // Largest accepted frame, in bytes
+	DrainTimeout   Duration `toml:"drain_timeout" yaml:"drain_timeout"`
+}
+
+// LogConfig holds the logger settings
+type LogConfig struct {
+	Level  string   `toml:"level" yaml:"level"`
+	Format string   `toml:"format" yaml:"format"`
+	Redact []string `toml:"redact" yaml:"redact"` // Field names whose values are never logged
+}
+
+// PoolConfig holds the default database/sql pool settings
+type PoolConfig struct {
+	MaxOpen        int      `toml:"max_open" yaml:"max_open"`
+	MaxIdle        int      `toml:"max_idle" yaml:"max_idle"`
+	IdleTimeout    Duration `toml:"idle_timeout" yaml:"idle_timeout"`
+	MaxLifetime    Duration `toml:"max_lifetime" yaml:"max_lifetime"`
+	MaxConnections int      `toml:"max_connections" yaml:"max_connections"` // Global cap across all pools
+	StatementCache int      `toml:"statement_cache" yaml:"statement_cache"` // Prepared statements kept per connection
+	AcquireTimeout Duration `toml:"acquire_timeout" yaml:"acquire_timeout"` // Longest wait for a connection under max_connections
+}
+
+// HealthConfig holds the database connection monitor settings
+type HealthConfig struct {
+	Interval         Duration `toml:"interval" yaml:"interval"`                   // Time between pings of each connection
+	Timeout          Duration `toml:"timeout" yaml:"timeout"`                     // Ping timeout
+	SlowThreshold    Duration `toml:"slow_threshold" yaml:"slow_threshold"`       // Pings slower than this mark a connection degraded
+	FailureThreshold int      `toml:"failure_threshold" yaml:"failure_threshold"` // Consecutive failed pings before reconnecting
+	BackoffInitial   Duration `toml:"backoff_initial" yaml:"backoff_initial"`
+	BackoffMax       Duration `toml:"backoff_max" yaml:"backoff_max"`
+	MaxAttempts      int      `toml:"max_attempts" yaml:"max_attempts"` // Reconnect attempts before giving up; 0 retries forever
+}
+
+// StorageConfig holds local storage locations
+type StorageConfig struct {
+	DataDir string `toml:"data_dir" yaml:"data_dir"`
+	TempDir string `toml:"temp_dir" yaml:"temp_dir"`
+}
+
+// CursorsConfig holds the settings of result cursors, which are spooled to
+// files under storage.temp_dir
+type CursorsConfig struct {
+	IdleTimeout Duration `toml:"idle_timeout" yaml:"idle_timeout"`   // Unused cursors are closed after this long
+	DiskQuotaMB int      `toml:"disk_quota_mb" yaml:"disk_quota_mb"` // Space all spools may use together; 0 for no limit
+}
+
+// JobsConfig holds the settings of background query jobs, whose results are
+// kept under storage.data_dir
+type JobsConfig struct {
+	Retention Duration `toml:"retention" yaml:"retention"` // Finished jobs and their results are deleted after this long
+}
+
+// SchedulesConfig holds the settings of scheduled queries
+type SchedulesConfig struct {
+	History int `toml:"history" yaml:"history"` // Runs kept per schedule; older runs are deleted
+}
+
+// ValuesConfig holds the settings of large result values. Truncated
+// values are kept in files under storage.temp_dir until they expire.
+type ValuesConfig struct {
+	MaxSize     int      `toml:"max_size" yaml:"max_size"`           // Bytes of a text, binary or JSON value sent in a result; 0 sends values whole
+	Retention   Duration `toml:"retention" yaml:"retention"`         // Truncated values can be fetched in full for this long
+	DiskQuotaMB int      `toml:"disk_quota_mb" yaml:"disk_quota_mb"` // Space kept values may use together; 0 for no limit
+}
+
+// SecretsConfig selects where credentials are kept
+type SecretsConfig struct {
+	Backend   string `toml:"backend" yaml:"backend"`       // auto, secret-service or file
+	VaultPath string `toml:"vault_path" yaml:"vault_path"` // Encrypted file vault; defaults to vault.enc in storage.data_dir
+}
+
+// DriversConfig holds per-driver connection defaults
+type DriversConfig struct {
+	Postgres DriverConfig `toml:"postgres" yaml:"postgres"`
+	MySQL    DriverConfig `toml:"mysql" yaml:"mysql"`
+	SQLite   DriverConfig `toml:"sqlite" yaml:"sqlite"`
+}
+
+// DriverConfig holds defaults applied to every connection of a driver
+type DriverConfig struct {
+	ConnectTimeout Duration          `toml:"connect_timeout" yaml:"connect_timeout"`
+	Params         map[string]string `toml:"params" yaml:"params"` // Extra DSN parameters
+}
+
+// Duration is a time.Duration that is written as a string ("30s") in config files
+type Duration time.Duration
+
+// UnmarshalText parses a duration string such as "30s" or "5m"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		IPC: IPCConfig{
+			ReadTimeout:    Duration(30 * time.Second),
+			WriteTimeout:   Duration(30 * time.Second),
+			MaxMessageSize: 64 << 20,
+			DrainTimeout:   Duration(5 * time.Minute),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+			Redact: []string{"password", "passphrase", "secret", "token"},
+		},
+		Pool: PoolConfig{
+			MaxOpen:        10,
+			MaxIdle:        2,
+			IdleTimeout:    Duration(5 * time.Minute),
+			MaxLifetime:    Duration(30 * time.Minute),
+			MaxConnections: 50,
+			StatementCache: 100,
+			AcquireTimeout: Duration(30 * time.Second),
+		},
+		Health: HealthConfig{
+			Interval:         Duration(15 * time.Second),
+			Timeout:          Duration(5 * time.Second),
+			SlowThreshold:    Duration(2 * time.Second),
+			FailureThreshold: 2,
+			BackoffInitial:   Duration(time.Second),
+			BackoffMax:       Duration(time.Minute),
+			MaxAttempts:      10,
+		},
+		Storage: StorageConfig{
+			DataDir: defaultDataDir(),
+			TempDir: filepath.Join(os.TempDir(), "litebase"),
+		},
+		Cursors: CursorsConfig{
+			IdleTimeout: Duration(10 * time.Minute),
+			DiskQuotaMB: 1024,
+		},
+		Jobs: JobsConfig{
+			Retention: Duration(24 * time.Hour),
+		},
+		Schedules: SchedulesConfig{
+			History: 100,
+		},
+		Values: ValuesConfig{
+			MaxSize:     1 << 20,
+			Retention:   Duration(10 * time.Minute),
+			DiskQuotaMB: 512,
+		},
+		Secrets: SecretsConfig{
+			Backend: "auto",
+		},
+		Drivers: DriversConfig{
+			Postgres: DriverConfig{
+				ConnectTimeout: Duration(10 * time.Second),
+				Params:         map[string]string{"application_name": "litebase"},
+			},
+			MySQL: DriverConfig{
+				ConnectTimeout: Duration(10 * time.Second),
+				Params:         map[string]string{"parseTime": "true"},
+			},
+			SQLite: DriverConfig{
+				ConnectTimeout: Duration(5 * time.Second),
+				Params:         map[string]string{"_busy_timeout": "5000"},
+			},
+		},
+	}
+}
+
+// DefaultPath returns the config file looked up when none is given explicitly
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.toml", "config.yaml", "config.yml"} {
+		path := filepath.Join(dir, "litebase", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// defaultDataDir returns the per-user directory for persistent backend data
+func defaultDataDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "litebase-data")
+	}
+	return filepath.Join(dir, "litebase")
+}
+
+// Validate checks every setting and reports all problems at once
+func (c *Config) Validate() error {
+	var errs ValidationError
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs.add("log.level", "must be one of debug, info, warn, error (got %q)", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "json", "console":
+	default:
+		errs.add("log.format", "must be json or console (got %q)", c.Log.Format)
+	}
+
+	if c.IPC.Port < 0 || c.IPC.Port > 65535 {
+		errs.add("ipc.port", "must be between 0 and 65535 (got %d)", c.IPC.Port)
+	}
+	if c.IPC.ReadTimeout <= 0 {
+		errs.add("ipc.read_timeout", "must be positive")
+	}
+	if c.IPC.WriteTimeout <= 0 {
+		errs.add("ipc.write_timeout", "must be positive")
+	}
+	if c.IPC.MaxMessageSize <= 0 || int64(c.IPC.MaxMessageSize) > 1<<32-1 {
+		errs.add("ipc.max_message_size", "must be between 1 and 4294967295 bytes (got %d)", c.IPC.MaxMessageSize)
+	}
+	if c.IPC.DrainTimeout < 0 {
+		errs.add("ipc.drain_timeout", "must not be negative")
+	}
+
+	if c.Pool.MaxOpen < 0 {
+		errs.add("pool.max_open", "must not be negative")
+	}
+	if c.Pool.MaxIdle < -1 {
+		errs.add("pool.max_idle", "must be -1 for no idle connections or not negative")
+	}
+	if c.Pool.MaxOpen > 0 && c.Pool.MaxIdle > c.Pool.MaxOpen {
+		errs.add("pool.max_idle", "must not exceed pool.max_open (%d > %d)", c.Pool.MaxIdle, c.Pool.MaxOpen)
+	}
+	if c.Pool.IdleTimeout < 0 {
+		errs.add("pool.idle_timeout", "must not be negative")
+	}
+	if c.Pool.MaxLifetime < 0 {
+		errs.add("pool.max_lifetime", "must not be negative")
+	}
+	if c.Pool.MaxConnections < 1 {
+		errs.add("pool.max_connections", "must be at least 1")
+	}
+	if c.Pool.AcquireTimeout <= 0 {
+		errs.add("pool.acquire_timeout", "must be positive")
+	}
+	if c.Pool.StatementCache < -1 {
+		errs.add("pool.statement_cache", "must be -1 to disable prepared statements or not negative")
+	}
+
+	if c.Health.Interval <= 0 {
+		errs.add("health.interval", "must be positive")
+	}
+	if c.Health.Timeout <= 0 {
+		errs.add("health.timeout", "must be positive")
+	}
+	if c.Health.SlowThreshold < 0 {
+		errs.add("health.slow_threshold", "must not be negative")
+	}
+	if c.Health.FailureThreshold < 1 {
+		errs.add("health.failure_threshold", "must be at least 1")
+	}
+	if c.Health.BackoffInitial <= 0 {
+		errs.add("health.backoff_initial", "must be positive")
+	}
+	if c.Health.BackoffMax < c.Health.BackoffInitial {
+		errs.add("health.backoff_max", "must not be less than health.backoff_initial")
+	}
+	if c.Health.MaxAttempts < 0 {
+		errs.add("health.max_attempts", "must not be negative")
+	}
+
+	if c.Storage.DataDir == "" {
+		errs.add("storage.data_dir", "must not be empty")
+	}
+	if c.Storage.TempDir == "" {
+		errs.add("storage.temp_dir", "must not be empty")
+	}
+
+	if c.Cursors.IdleTimeout <= 0 {
+		errs.add("cursors.idle_timeout", "must be positive")
+	}
+	if c.Cursors.DiskQuotaMB < 0 {
+		errs.add("cursors.disk_quota_mb", "must not be negative")
+	}
+
+	if c.Jobs.Retention <= 0 {
+		errs.add("jobs.retention", "must be positive")
+	}
+
+	if c.Schedules.History < 1 {
+		errs.add("schedules.history", "must be at least 1")
+	}
+
+	if c.Values.MaxSize < 0 {
+		errs.add("values.max_size", "must not be negative")
+	}
+	if c.Values.Retention <= 0 {
+		errs.add("values.retention", "must be positive")
+	}
+	if c.Values.DiskQuotaMB < 0 {
+		errs.add("values.disk_quota_mb", "must not be negative")
+	}
+
+	switch c.Secrets.Backend {
+	case "auto", "secret-service", "file":
+	default:
+		errs.add("secrets.backend", "must be auto, secret-service or file (got %q)", c.Secrets.Backend)
+	}
+
+	for _, driver := range []struct {
+		name   string
+		config DriverConfig
+	}{
+		{"postgres", c.Drivers.Postgres},
+		{"mysql", c.Drivers.MySQL},
+		{"sqlite", c.Drivers.SQLite},
+	} {
+		if driver.config.ConnectTimeout < 0 {
+			errs.add("drivers."+driver.name+".connect_timeout", "must not be negative")
+		}
+	}
+	// lib/pq supports no other modes and fails every connect otherwise
+	switch mode, ok := c.Drivers.Postgres.Params["sslmode"]; {
+	case !ok, mode == "disable", mode == "require", mode == "verify-ca", mode == "verify-full":
+	default:
+		errs.add("drivers.postgres.params.sslmode", "must be disable, require, verify-ca or verify-full (got %q)", mode)
+	}
+
+	return errs.orNil()
+}
+
+// FieldError describes a single invalid configuration key
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+// ValidationError collects every invalid configuration key
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error lists every invalid key, one per line
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("invalid configuration (%d problems):", len(e.Fields))
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("\n  %s: %s", f.Key, f.Message)
+	}
+	return msg
+}
+
+// add records a problem with key
+func (e *ValidationError) add(key, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// merge appends the problems of other
+func (e *ValidationError) merge(other error) {
+	if other == nil {
+		return
+	}
+	if v, ok := other.(*ValidationError); ok {
+		e.Fields = append(e.Fields, v.Fields...)
+		return
+	}
+	e.Fields = append(e.Fields, FieldError{Key: "-", Message: other.Error()})
+}
+
+// orNil returns nil when no problems were recorded
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that override config keys
+const EnvPrefix = "LITEBASE_"
+
+// LoadOptions controls where configuration is read from
+type LoadOptions struct {
+	// Path of the config file. Empty means DefaultPath(), if any.
+	Path string
+	// Overrides are applied last, keyed by config key (e.g. from command line flags)
+	Overrides map[string]string
+	// Environ is the environment to read LITEBASE_* variables from. Nil means os.Environ().
+	Environ []string
+}
+
+// Load builds the effective configuration: defaults < config file < LITEBASE_* env < overrides.
+// All invalid keys are reported together in a *ValidationError.
+func Load(opts LoadOptions) (*Config, error) {
+	cfg := Default()
+	var errs ValidationError
+
+	path := opts.Path
+	if path == "" {
+		path = DefaultPath()
+	}
+	if path != "" {
+		if err := decodeFile(path, cfg); err != nil {
+			errs.merge(err)
+		}
+	}
+
+	environ := opts.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	errs.merge(applyEnv(cfg, environ))
+
+	keys := make([]string, 0, len(opts.Overrides))
+	for key := range opts.Overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := cfg.Set(key, opts.Overrides[key]); err != nil {
+			errs.add(key, "%v", err)
+		}
+	}
+
+	errs.merge(cfg.Validate())
+	if err := errs.orNil(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeFile reads a TOML or YAML file into cfg, reporting unknown keys
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var errs ValidationError
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for _, key := range meta.Undecoded() {
+			errs.add(key.String(), "unknown key in %s", path)
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			for _, msg := range typeErr.Errors {
+				errs.add(path, "%s", msg)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .toml, .yaml or .yml)", filepath.Ext(path))
+	}
+
+	return errs.orNil()
+}
+
+// applyEnv applies LITEBASE_<SECTION>_<KEY> variables from environ
+func applyEnv(cfg *Config, environ []string) error {
+	envKeys := make(map[string]string)
+	for _, key := range Keys() {
+		envKeys[EnvName(key)] = key
+	}
+
+	var errs ValidationError
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, known := envKeys[name]
+		if !known {
+			// Other LITEBASE_* variables (e.g. LITEBASE_CONFIG) are not config keys
+			continue
+		}
+		if err := cfg.Set(key, value); err != nil {
+			errs.add(key, "%s: %v", name, err)
+		}
+	}
+	return errs.orNil()
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Keys returns every settable config key in declaration order
+func Keys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := prefix + tagName(field)
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type, key+".")
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// Set assigns a config key from its string form.
+// Lists are comma separated and maps are written as "k1=v1,k2=v2".
+func (c *Config) Set(key, value string) error {
+	field, err := lookup(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return err
+	}
+	return setValue(field, value)
+}
+
+// lookup finds the struct field addressed by a dotted key
+func lookup(v reflect.Value, key string) (reflect.Value, error) {
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown key")
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if tagName(v.Type().Field(i)) == part {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown key")
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("key is a section, not a setting")
+	}
+	return v, nil
+}
+
+// setValue parses value into the field according to its type
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		params := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid map entry %q (expected key=value)", pair)
+			}
+			params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		field.Set(reflect.ValueOf(params))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// tagName returns the config key name of a struct field
+func tagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// WriteTOML writes the configuration in TOML format
+func (c *Config) WriteTOML(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadableKeys lists the settings that are applied at runtime on reload.
+// Entries ending in "." match every key in that section.
+var reloadableKeys = []string{
+	"log.level",
+	"log.redact",
+	"ipc.read_timeout",
+	"ipc.write_timeout",
+	"ipc.max_message_size",
+	"ipc.drain_timeout",
+	// Pool and driver defaults apply to connections opened after the reload
+	"pool.max_open",
+	"pool.max_idle",
+	"pool.idle_timeout",
+	"pool.max_lifetime",
+	"pool.statement_cache",
+	"pool.acquire_timeout",
+	"drivers.",
+	"health.",
+	"cursors.",
+	"jobs.",
+	"schedules.",
+	"values.",
+}
+
+// IsReloadable reports whether a change to key can be applied without a restart
+func IsReloadable(key string) bool {
+	for _, reloadable := range reloadableKeys {
+		if key == reloadable || (strings.HasSuffix(reloadable, ".") && strings.HasPrefix(key, reloadable)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the keys whose values differ between two configurations
+func Diff(old, updated *Config) []string {
+	var changed []string
+	for _, key := range Keys() {
+		a, _ := lookup(reflect.ValueOf(old).Elem(), key)
+		b, _ := lookup(reflect.ValueOf(updated).Elem(), key)
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// WithKeys returns a copy of base with the given keys taken from other
+func WithKeys(base, other *Config, keys []string) *Config {
+	merged := *base
+	for _, key := range keys {
+		dst, err := lookup(reflect.ValueOf(&merged).Elem(), key)
+		if err != nil {
+			continue
+		}
+		src, _ := lookup(reflect.ValueOf(other).Elem(), key)
+		dst.Set(src)
+	}
+	return &merged
+}
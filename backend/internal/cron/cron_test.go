@@ -0,0 +1,82 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data is not available")
+	}
+	at := func(s string, loc *time.Location) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string // Empty when the expression never fires
+		loc  *time.Location
+	}{
+		{"* * * * *", "2024-03-01 10:00", "2024-03-01 10:01", time.UTC},
+		{"*/15 * * * *", "2024-03-01 10:07", "2024-03-01 10:15", time.UTC},
+		{"0 7 * * mon-fri", "2024-03-01 08:00", "2024-03-04 07:00", time.UTC},
+		{"30 9 1 * *", "2024-12-05 00:00", "2025-01-01 09:30", time.UTC},
+		{"0 0 * * 7", "2024-03-01 00:00", "2024-03-03 00:00", time.UTC},
+		{"0 0 29 feb *", "2024-03-01 00:00", "2028-02-29 00:00", time.UTC},
+		{"0 0 30 2 *", "2024-01-01 00:00", "", time.UTC},
+		// Both day fields restricted: either one matching fires
+		{"0 0 13 * fri", "2024-09-01 00:00", "2024-09-06 00:00", time.UTC},
+		{"@hourly", "2024-03-01 10:59", "2024-03-01 11:00", time.UTC},
+		{"@monthly", "2024-03-01 00:00", "2024-04-01 00:00", time.UTC},
+		// 02:30 does not exist on the day clocks go forward
+		{"30 2 * * *", "2024-03-31 00:00", "2024-04-01 02:30", berlin},
+		{"0 12 * * *", "2024-10-27 00:00", "2024-10-27 12:00", berlin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" from "+tt.from, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got := e.Next(at(tt.from, tt.loc))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next = %v, want never", got)
+				}
+				return
+			}
+			if want := at(tt.want, tt.loc); !got.Equal(want) {
+				t.Errorf("Next = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every",
+	} {
+		if _, err := Parse(expr); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalid", expr, err)
+		}
+	}
+}
@@ -0,0 +1,519 @@
+// Package cursor spools query results to scratch SQLite files so clients
+// can page through them at random without re-running the query.
+package cursor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+	"litebase-backend/internal/spool"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for unknown cursor IDs or cursors owned by another session
+	ErrNotFound = errors.New("cursor not found")
+	// ErrInvalid is returned for malformed cursor requests
+	ErrInvalid = errors.New("invalid cursor request")
+	// ErrQuotaExceeded stops spooling when the spool files outgrow the disk quota
+	ErrQuotaExceeded = errors.New("cursor disk quota exceeded")
+)
+
+const (
+	// MaxFetch is the largest number of rows one fetch returns
+	MaxFetch = 10000
+	// filePrefix names spool files in the cursor directory
+	filePrefix = "cursor_"
+)
+
+// Config configures the cursor manager
+type Config struct {
+	Logger      logger.Logger
+	Dir         string        // Holds the spool files; leftovers are removed on start
+	IdleTimeout time.Duration // Cursors unused for this long are closed
+	DiskQuota   int64         // Bytes all spool files may use together; 0 for no limit
+}
+
+// Source runs the query of a cursor, passing its rows to sink
+type Source func(ctx context.Context, sink database.RowSink) (*database.Result, error)
+
+// Info describes a cursor
+type Info struct {
+	ID           string            `msgpack:"id"`
+	ConnectionID string            `msgpack:"connection_id"`
+	Columns      []database.Column `msgpack:"columns"`
+	Rows         int64             `msgpack:"rows"`      // Rows spooled so far
+	Done         bool              `msgpack:"done"`      // The query finished, failed or was stopped
+	Truncated    bool              `msgpack:"truncated"` // Spooling stopped at max_rows or the disk quota
+	Error        string            `msgpack:"error"`     // Why spooling stopped early
+	Bytes        int64             `msgpack:"bytes"`     // Disk used by the spool
+	CreatedAt    time.Time         `msgpack:"created_at"`
+	ExpiresAt    time.Time         `msgpack:"expires_at"` // Closed then unless used again
+}
+
+// Cursor is a result being spooled or fully spooled to disk
+type Cursor struct {
+	id           string
+	connectionID string
+	owner        string
+	createdAt    time.Time
+	cancel       context.CancelFunc
+	finished     chan struct{} // Closed when spooling has stopped
+
+	// reading is held shared while a request uses the spool and exclusively
+	// while remove deletes it
+	reading sync.RWMutex
+
+	mu        sync.Mutex
+	closed    bool // Being removed; new requests are refused
+	spool     *spool.Spool
+	columns   []database.Column
+	rows      int64
+	done      bool
+	truncated bool
+	err       error
+	bytes     int64
+	lastUsed  time.Time
+	waiters   int // Requests waiting for rows; a waited-on cursor never expires
+	views     map[string]*view
+	building  int           // Views being built, which count towards MaxViews
+	changed   chan struct{} // Closed and replaced whenever rows arrive or spooling ends
+}
+
+// Manager owns the open cursors
+type Manager struct {
+	dir    string
+	logger logger.Logger
+	ctx    context.Context // Parent of every spooling query
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	cursors     map[string]*Cursor
+	idleTimeout time.Duration
+	diskQuota   int64
+
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewManager creates the cursor directory and starts expiring idle cursors
+func NewManager(config Config) (*Manager, error) {
+	if config.Logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	if config.IdleTimeout <= 0 {
+		return nil, fmt.Errorf("idle timeout must be positive")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cursor directory: %w", err)
+	}
+	// Spools of a previous run with our process ID are unreachable
+	leftovers, _ := filepath.Glob(filepath.Join(config.Dir, filePrefix+"*"))
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		dir:         config.Dir,
+		logger:      config.Logger,
+		ctx:         ctx,
+		cancel:      cancel,
+		cursors:     make(map[string]*Cursor),
+		idleTimeout: config.IdleTimeout,
+		diskQuota:   config.DiskQuota,
+	}
+	m.wg.Add(1)
+	go m.expire()
+	return m, nil
+}
+
+// SetLimits changes the idle timeout and disk quota of all cursors
+func (m *Manager) SetLimits(idleTimeout time.Duration, diskQuota int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idleTimeout, m.diskQuota = idleTimeout, diskQuota
+}
+
+// Open starts spooling the rows of src for owner. It returns once the
+// result columns are known; the rows keep arriving in the background.
+func (m *Manager) Open(ctx context.Context, connectionID, owner string, src Source) (Info, error) {
+	id, err := ids.New("cur_")
+	if err != nil {
+		return Info{}, err
+	}
+	now := time.Now()
+	spoolCtx, cancel := context.WithCancel(m.ctx)
+	c := &Cursor{
+		id:           id,
+		connectionID: connectionID,
+		owner:        owner,
+		createdAt:    now,
+		cancel:       cancel,
+		finished:     make(chan struct{}),
+		lastUsed:     now,
+		changed:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.cursors[c.id] = c
+	m.mu.Unlock()
+
+	opened := make(chan struct{})
+	path := filepath.Join(m.dir, filePrefix+strings.TrimPrefix(c.id, "cur_")+".db")
+	sink := spool.NewSink(spoolCtx, path, spool.Options{}, func(sp *spool.Spool, cols []database.Column) error {
+		c.mu.Lock()
+		c.spool, c.columns, c.bytes = sp, cols, sp.Size()
+		c.mu.Unlock()
+		close(opened)
+		return nil
+	}, func(rows, bytes int64) error {
+		c.mu.Lock()
+		c.rows, c.bytes = rows, bytes
+		c.notify()
+		c.mu.Unlock()
+		if used, quota := m.diskUsage(); quota > 0 && used > quota {
+			return ErrQuotaExceeded
+		}
+		return nil
+	})
+	go func() {
+		defer close(c.finished)
+		res, err := src(spoolCtx, sink)
+		// Rows read before a failure stay available
+		if flushErr := sink.Flush(); err == nil {
+			err = flushErr
+		}
+		c.finish(res, err)
+	}()
+
+	select {
+	case <-opened:
+	case <-c.finished:
+	case <-ctx.Done():
+		m.remove(c)
+		return Info{}, ctx.Err()
+	}
+
+	c.mu.Lock()
+	failed := c.spool == nil
+	err = c.err
+	c.mu.Unlock()
+	if failed {
+		// The query failed before returning any columns
+		m.remove(c)
+		return Info{}, err
+	}
+
+	m.logger.Info("Cursor opened",
+		zap.String("cursor_id", c.id),
+		zap.String("connection_id", connectionID),
+		zap.String("owner", owner),
+	)
+	return m.info(c), nil
+}
+
+// Fetch returns up to limit rows starting at offset, waiting for them to be
+// spooled if the query is still running
+func (m *Manager) Fetch(ctx context.Context, id, owner string, offset, limit int64) ([][]interface{}, Info, error) {
+	if offset < 0 || limit < 1 || limit > MaxFetch {
+		return nil, Info{}, fmt.Errorf("%w: offset must not be negative and limit must be between 1 and %d", ErrInvalid, MaxFetch)
+	}
+	c, err := m.get(id, owner)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	sp, err := c.wait(ctx, func() bool { return c.rows >= offset+limit })
+	if err != nil {
+		return nil, Info{}, err
+	}
+	defer c.reading.RUnlock()
+
+	rows, err := sp.Read(ctx, offset, limit)
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("failed to read cursor: %w", err)
+	}
+	return rows, m.info(c), nil
+}
+
+// Count returns the state of a cursor. With wait it blocks until every row
+// is spooled, so Info.Rows is the total.
+func (m *Manager) Count(ctx context.Context, id, owner string, wait bool) (Info, error) {
+	c, err := m.get(id, owner)
+	if err != nil {
+		return Info{}, err
+	}
+	if wait {
+		if _, err := c.wait(ctx, func() bool { return false }); err != nil {
+			return Info{}, err
+		}
+		c.reading.RUnlock()
+	}
+	return m.info(c), nil
+}
+
+// Close stops a cursor's query and deletes its spool
+func (m *Manager) Close(id, owner string) error {
+	c, err := m.get(id, owner)
+	if err != nil {
+		return err
+	}
+	m.remove(c)
+	m.logger.Info("Cursor closed", zap.String("cursor_id", id))
+	return nil
+}
+
+// CloseOwner closes every cursor of owner and returns how many there were
+func (m *Manager) CloseOwner(owner string) int {
+	m.mu.Lock()
+	var owned []*Cursor
+	for _, c := range m.cursors {
+		if c.owner == owner {
+			owned = append(owned, c)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, c := range owned {
+		m.remove(c)
+	}
+	return len(owned)
+}
+
+// HasCursors reports whether owner has any open cursor
+func (m *Manager) HasCursors(owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.cursors {
+		if c.owner == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the cursors of owner, oldest first
+func (m *Manager) List(owner string) []Info {
+	m.mu.Lock()
+	var owned []*Cursor
+	for _, c := range m.cursors {
+		if c.owner == owner {
+			owned = append(owned, c)
+		}
+	}
+	m.mu.Unlock()
+
+	infos := make([]Info, len(owned))
+	for i, c := range owned {
+		infos[i] = m.info(c)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	return infos
+}
+
+// Shutdown closes every cursor and stops the expiry loop
+func (m *Manager) Shutdown() error {
+	m.stopOnce.Do(m.cancel)
+
+	m.mu.Lock()
+	cursors := make([]*Cursor, 0, len(m.cursors))
+	for _, c := range m.cursors {
+		cursors = append(cursors, c)
+	}
+	m.mu.Unlock()
+
+	for _, c := range cursors {
+		m.remove(c)
+	}
+	m.wg.Wait()
+	os.Remove(m.dir)
+	return nil
+}
+
+// get returns a cursor of owner and marks it used
+func (m *Manager) get(id, owner string) (*Cursor, error) {
+	m.mu.Lock()
+	c, ok := m.cursors[id]
+	m.mu.Unlock()
+	if !ok || c.owner != owner {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	c.mu.Lock()
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// remove unregisters a cursor, stops its query and deletes its spool once
+// the requests reading it are done
+func (m *Manager) remove(c *Cursor) {
+	m.mu.Lock()
+	delete(m.cursors, c.id)
+	m.mu.Unlock()
+
+	c.mu.Lock()
+	c.closed = true
+	c.notify()
+	c.mu.Unlock()
+
+	c.cancel()
+	<-c.finished
+	c.reading.Lock()
+	defer c.reading.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spool != nil {
+		if err := c.spool.Remove(); err != nil {
+			m.logger.Warn("Failed to delete cursor spool", zap.String("cursor_id", c.id), zap.Error(err))
+		}
+		c.spool = nil
+	}
+	c.views = nil
+}
+
+// info returns a snapshot of a cursor
+func (m *Manager) info(c *Cursor) Info {
+	m.mu.Lock()
+	idle := m.idleTimeout
+	m.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := Info{
+		ID:           c.id,
+		ConnectionID: c.connectionID,
+		Columns:      c.columns,
+		Rows:         c.rows,
+		Done:         c.done,
+		Truncated:    c.truncated,
+		Bytes:        c.bytes,
+		CreatedAt:    c.createdAt,
+		ExpiresAt:    c.lastUsed.Add(idle),
+	}
+	if c.err != nil {
+		info.Error = c.err.Error()
+	}
+	return info
+}
+
+// diskUsage returns the bytes used by all spools
+func (m *Manager) diskUsage() (used, quota int64) {
+	m.mu.Lock()
+	cursors := make([]*Cursor, 0, len(m.cursors))
+	for _, c := range m.cursors {
+		cursors = append(cursors, c)
+	}
+	quota = m.diskQuota
+	m.mu.Unlock()
+
+	for _, c := range cursors {
+		c.mu.Lock()
+		used += c.bytes
+		c.mu.Unlock()
+	}
+	return used, quota
+}
+
+// expire closes cursors that have been idle longer than the idle timeout
+func (m *Manager) expire() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			idle := m.idleTimeout
+			var expired []*Cursor
+			for _, c := range m.cursors {
+				c.mu.Lock()
+				if c.waiters == 0 && c.spool != nil && now.Sub(c.lastUsed) > idle {
+					expired = append(expired, c)
+				}
+				c.mu.Unlock()
+			}
+			m.mu.Unlock()
+
+			for _, c := range expired {
+				m.remove(c)
+				m.logger.Info("Cursor expired", zap.String("cursor_id", c.id), zap.String("owner", c.owner))
+			}
+		}
+	}
+}
+
+// wait blocks until ready reports true or spooling has stopped, and returns
+// the spool to read from. ready is called with c.mu held. On success the
+// spool is held for reading; the caller must call c.reading.RUnlock.
+func (c *Cursor) wait(ctx context.Context, ready func() bool) (*spool.Spool, error) {
+	c.mu.Lock()
+	c.waiters++
+	defer func() {
+		c.waiters--
+		c.lastUsed = time.Now()
+		c.mu.Unlock()
+	}()
+
+	for !c.closed && !c.done && !ready() {
+		changed := c.changed
+		c.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			c.mu.Lock()
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+	return c.use()
+}
+
+// use holds the spool for reading, unless the cursor is being removed;
+// c.mu must be held. remove sets closed before it waits for the readers,
+// so taking the read lock here never blocks.
+func (c *Cursor) use() (*spool.Spool, error) {
+	if c.closed || c.spool == nil {
+		return nil, fmt.Errorf("%w: %s was closed", ErrNotFound, c.id)
+	}
+	c.reading.RLock()
+	return c.spool, nil
+}
+
+// notify wakes every waiter; c.mu must be held
+func (c *Cursor) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// finish records the end of spooling
+func (c *Cursor) finish(res *database.Result, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		c.truncated, c.err = true, ErrQuotaExceeded
+	case err != nil && c.spool != nil && errors.Is(err, context.Canceled):
+		// Closed by the client; the rows so far stay readable until removal
+		c.err = fmt.Errorf("spooling was cancelled")
+	case err != nil:
+		c.err = err
+	case res != nil:
+		c.truncated = res.Truncated
+	}
+	c.notify()
+}
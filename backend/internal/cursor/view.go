@@ -0,0 +1,275 @@
+package cursor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/spool"
+
+	"go.uber.org/zap"
+)
+
+// Filter operators
+const (
+	FilterEquals   = "equals"
+	FilterContains = "contains" // Case-insensitive substring match on the value as text
+	FilterRange    = "range"    // Between min and max, both inclusive and each optional
+	FilterIsNull   = "is_null"
+)
+
+// MaxViews is the number of views a cursor may have at once
+const MaxViews = 16
+
+// SortKey orders a view by one result column
+type SortKey struct {
+	Column int  `msgpack:"column"` // Index into the cursor's columns
+	Desc   bool `msgpack:"desc"`
+}
+
+// Filter is a predicate on one result column. A view keeps the rows that
+// match all of its filters.
+type Filter struct {
+	Column int         `msgpack:"column"`
+	Op     string      `msgpack:"op"`
+	Value  interface{} `msgpack:"value"` // For equals and contains
+	Min    interface{} `msgpack:"min"`   // For range
+	Max    interface{} `msgpack:"max"`
+	Not    bool        `msgpack:"not"` // Keeps the rows that do not match, including NULLs
+}
+
+// ViewOptions selects and orders the rows of a view
+type ViewOptions struct {
+	Sort    []SortKey `msgpack:"sort"`
+	Filters []Filter  `msgpack:"filters"`
+}
+
+// ViewInfo describes a view
+type ViewInfo struct {
+	ID         string      `msgpack:"id"`
+	CursorID   string      `msgpack:"cursor_id"`
+	Rows       int64       `msgpack:"rows"` // Rows matching the filters
+	Options    ViewOptions `msgpack:"options"`
+	CreatedAt  time.Time   `msgpack:"created_at"`
+	DurationMs int64       `msgpack:"duration_ms"` // Time taken to build the view
+}
+
+// view is a sorted and filtered selection of a cursor's rows. The numbers of
+// its rows are kept in view order in a table of the spool named after it.
+type view struct {
+	info ViewInfo
+}
+
+// CreateView builds a view over the rows of a cursor without re-running its
+// query. It waits for spooling to finish, so the view covers every row. The
+// view table counts towards the disk quota.
+func (m *Manager) CreateView(ctx context.Context, id, owner string, opts ViewOptions) (ViewInfo, error) {
+	c, err := m.get(id, owner)
+	if err != nil {
+		return ViewInfo{}, err
+	}
+	sp, err := c.wait(ctx, func() bool { return false })
+	if err != nil {
+		return ViewInfo{}, err
+	}
+	defer c.reading.RUnlock()
+	if used, quota := m.diskUsage(); quota > 0 && used >= quota {
+		return ViewInfo{}, ErrQuotaExceeded
+	}
+
+	// Reserve a slot so concurrent requests cannot exceed MaxViews
+	c.mu.Lock()
+	columns, full := len(c.columns), len(c.views)+c.building >= MaxViews
+	if !full {
+		c.building++
+	}
+	c.mu.Unlock()
+	if full {
+		return ViewInfo{}, fmt.Errorf("%w: a cursor can have at most %d views", ErrInvalid, MaxViews)
+	}
+	defer func() {
+		c.mu.Lock()
+		c.building--
+		c.mu.Unlock()
+	}()
+
+	where, args, err := opts.where(columns)
+	if err != nil {
+		return ViewInfo{}, err
+	}
+	order, err := opts.orderBy(columns)
+	if err != nil {
+		return ViewInfo{}, err
+	}
+
+	viewID, err := ids.New("view_")
+	if err != nil {
+		return ViewInfo{}, err
+	}
+	start := time.Now()
+	rows, err := sp.CreateView(ctx, viewID, where, args, order)
+	if err != nil {
+		return ViewInfo{}, fmt.Errorf("failed to build view: %w", err)
+	}
+	v := &view{
+		info: ViewInfo{
+			ID:         viewID,
+			CursorID:   id,
+			Rows:       rows,
+			Options:    opts,
+			CreatedAt:  time.Now(),
+			DurationMs: time.Since(start).Milliseconds(),
+		},
+	}
+	c.mu.Lock()
+	c.bytes = sp.Size()
+	c.mu.Unlock()
+	if used, quota := m.diskUsage(); quota > 0 && used > quota {
+		if err := sp.DropView(viewID); err != nil {
+			m.logger.Warn("Failed to drop cursor view", zap.String("cursor_id", id), zap.String("view_id", viewID), zap.Error(err))
+		}
+		return ViewInfo{}, ErrQuotaExceeded
+	}
+
+	c.mu.Lock()
+	if c.views == nil {
+		c.views = make(map[string]*view)
+	}
+	c.views[v.info.ID] = v
+	c.mu.Unlock()
+
+	m.logger.Debug("Cursor view created",
+		zap.String("cursor_id", id),
+		zap.String("view_id", v.info.ID),
+		zap.Int64("rows", v.info.Rows),
+		zap.Int64("duration_ms", v.info.DurationMs),
+	)
+	return v.info, nil
+}
+
+// FetchView returns up to limit rows of a view starting at offset
+func (m *Manager) FetchView(ctx context.Context, id, viewID, owner string, offset, limit int64) ([][]interface{}, ViewInfo, error) {
+	if offset < 0 || limit < 1 || limit > MaxFetch {
+		return nil, ViewInfo{}, fmt.Errorf("%w: offset must not be negative and limit must be between 1 and %d", ErrInvalid, MaxFetch)
+	}
+	c, err := m.get(id, owner)
+	if err != nil {
+		return nil, ViewInfo{}, err
+	}
+	c.mu.Lock()
+	v := c.views[viewID]
+	sp, err := c.use()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, ViewInfo{}, err
+	}
+	defer c.reading.RUnlock()
+	if v == nil {
+		return nil, ViewInfo{}, fmt.Errorf("%w: view %s", ErrNotFound, viewID)
+	}
+
+	rows, err := sp.ReadView(ctx, v.info.ID, offset, limit)
+	if err != nil {
+		return nil, ViewInfo{}, fmt.Errorf("failed to read view: %w", err)
+	}
+	return rows, v.info, nil
+}
+
+// CloseView drops a view of a cursor
+func (m *Manager) CloseView(id, viewID, owner string) error {
+	c, err := m.get(id, owner)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	_, ok := c.views[viewID]
+	delete(c.views, viewID)
+	sp, err := c.use()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer c.reading.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: view %s", ErrNotFound, viewID)
+	}
+	return sp.DropView(viewID)
+}
+
+// where returns the SQL condition of the filters over a spool of the given width
+func (o ViewOptions) where(columns int) (string, []interface{}, error) {
+	conds := []string{}
+	args := []interface{}{}
+	for i, f := range o.Filters {
+		if f.Column < 0 || f.Column >= columns {
+			return "", nil, fmt.Errorf("%w: filters[%d]: column %d does not exist", ErrInvalid, i, f.Column)
+		}
+		col := spool.ColumnName(f.Column)
+		var cond string
+		switch f.Op {
+		case FilterEquals:
+			if f.Value == nil {
+				return "", nil, fmt.Errorf("%w: filters[%d]: equals needs a value; use is_null for NULL", ErrInvalid, i)
+			}
+			cond = col + " = ?"
+			args = append(args, spool.ColumnValue(f.Value))
+		case FilterContains:
+			if f.Value == nil {
+				return "", nil, fmt.Errorf("%w: filters[%d]: contains needs a value", ErrInvalid, i)
+			}
+			cond = col + ` LIKE ? ESCAPE '\'`
+			args = append(args, "%"+escapeLike(fmt.Sprint(spool.ColumnValue(f.Value)))+"%")
+		case FilterRange:
+			var bounds []string
+			if f.Min != nil {
+				bounds = append(bounds, col+" >= ?")
+				args = append(args, spool.ColumnValue(f.Min))
+			}
+			if f.Max != nil {
+				bounds = append(bounds, col+" <= ?")
+				args = append(args, spool.ColumnValue(f.Max))
+			}
+			if len(bounds) == 0 {
+				return "", nil, fmt.Errorf("%w: filters[%d]: range needs min, max or both", ErrInvalid, i)
+			}
+			cond = strings.Join(bounds, " AND ")
+		case FilterIsNull:
+			cond = col + " IS NULL"
+		default:
+			return "", nil, fmt.Errorf("%w: filters[%d]: unknown operator %q", ErrInvalid, i, f.Op)
+		}
+		if f.Not {
+			// A plain NOT would drop the rows where cond is NULL
+			cond = "(" + cond + ") IS NOT 1"
+		}
+		conds = append(conds, "("+cond+")")
+	}
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// orderBy returns the SQL ordering of the sort keys. Ties keep the result order.
+func (o ViewOptions) orderBy(columns int) (string, error) {
+	keys := make([]string, 0, len(o.Sort)+1)
+	for i, key := range o.Sort {
+		if key.Column < 0 || key.Column >= columns {
+			return "", fmt.Errorf("%w: sort[%d]: column %d does not exist", ErrInvalid, i, key.Column)
+		}
+		if key.Desc {
+			keys = append(keys, spool.ColumnName(key.Column)+" DESC")
+		} else {
+			keys = append(keys, spool.ColumnName(key.Column))
+		}
+	}
+	keys = append(keys, "n")
+	return " ORDER BY " + strings.Join(keys, ", "), nil
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
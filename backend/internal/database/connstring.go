@@ -0,0 +1,643 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// redactedValue replaces secrets in display forms
+const redactedValue = "xxxxx"
+
+// ConnectionURL is the structured form of a connection string
+type ConnectionURL struct {
+	Driver   string            `msgpack:"driver"`
+	Host     string            `msgpack:"host"` // Host name, IP address or Unix socket path
+	Port     int               `msgpack:"port"` // 0 uses the driver default
+	User     string            `msgpack:"user"`
+	Password string            `msgpack:"password"`
+	Database string            `msgpack:"database"` // Database name; the file path for SQLite
+	Params   map[string]string `msgpack:"params"`
+	Ignored  []string          `msgpack:"ignored,omitempty"` // JDBC parameters with no driver equivalent
+}
+
+// FieldError describes one invalid part of a connection string
+type FieldError struct {
+	Field   string `msgpack:"field"`
+	Message string `msgpack:"message"`
+}
+
+// ParseError collects every problem found in a connection string
+type ParseError struct {
+	Fields []FieldError
+}
+
+// Error lists every invalid field
+func (e *ParseError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid connection string: " + strings.Join(parts, "; ")
+}
+
+// Unwrap makes parse errors match ErrInvalidProfile
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidProfile
+}
+
+// add records a problem with field
+func (e *ParseError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// orNil returns nil when no problems were recorded
+func (e *ParseError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// isConnectionURL reports whether s is a URL or JDBC string rather than a native DSN
+func isConnectionURL(s string) bool {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	for _, prefix := range []string{"jdbc:", "postgres://", "postgresql://", "mysql://", "mariadb://", "sqlite://", "sqlite3://", "file:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseConnectionString parses a postgres://, mysql:// or file: URL, a JDBC
+// string, or a native DSN of driverHint's driver. driverHint may be empty for
+// URLs, which name their driver.
+func ParseConnectionString(input, driverHint string) (ConnectionURL, error) {
+	input = strings.TrimSpace(input)
+	var errs ParseError
+	if input == "" {
+		errs.add("dsn", "is required")
+		return ConnectionURL{}, errs.orNil()
+	}
+
+	hint := ""
+	if driverHint != "" {
+		var err error
+		if hint, err = NormalizeDriver(driverHint); err != nil {
+			errs.add("driver", "%v", err)
+			return ConnectionURL{}, errs.orNil()
+		}
+	}
+
+	var c ConnectionURL
+	lower := strings.ToLower(input)
+	switch {
+	case strings.HasPrefix(lower, "jdbc:"):
+		c = parseJDBC(input[len("jdbc:"):], &errs)
+	case strings.HasPrefix(lower, "postgres://"), strings.HasPrefix(lower, "postgresql://"):
+		c = parseURL(DriverPostgres, input, &errs)
+	case strings.HasPrefix(lower, "mysql://"), strings.HasPrefix(lower, "mariadb://"):
+		c = parseURL(DriverMySQL, input, &errs)
+	case strings.HasPrefix(lower, "sqlite://"), strings.HasPrefix(lower, "sqlite3://"), strings.HasPrefix(lower, "file:"):
+		c = parseSQLite(input, &errs)
+	case hint == "":
+		errs.add("driver", "is required for connection strings that are not URLs")
+		return ConnectionURL{}, errs.orNil()
+	case hint == DriverPostgres:
+		c = parsePQ(input, &errs)
+	case hint == DriverMySQL:
+		c = parseMySQL(input, &errs)
+	default:
+		c = parseSQLite(input, &errs)
+	}
+
+	if hint != "" && c.Driver != "" && c.Driver != hint {
+		errs.add("driver", "the connection string is for %s, not %s", c.Driver, hint)
+	}
+	if c.Driver != "" {
+		c.validate(&errs)
+	}
+	if err := errs.orNil(); err != nil {
+		return ConnectionURL{}, err
+	}
+	return c, nil
+}
+
+// parseURL parses a postgres:// or mysql:// URL
+func parseURL(driverName, input string, errs *ParseError) ConnectionURL {
+	c := ConnectionURL{Driver: driverName, Params: make(map[string]string)}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		// url.Error repeats the input, password included; report only the cause
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		field := "url"
+		if strings.Contains(err.Error(), "port") {
+			field = "port"
+		}
+		errs.add(field, "%v", err)
+		return c
+	}
+
+	if u.User != nil {
+		c.User = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+	if strings.Contains(u.Host, ",") {
+		errs.add("host", "multiple hosts are not supported")
+	} else {
+		c.Host = u.Hostname()
+		c.setPort(u.Port(), errs)
+	}
+
+	c.Database = strings.TrimPrefix(u.Path, "/")
+	if strings.Contains(c.Database, "/") {
+		errs.add("database", "must be a single name (got %q)", c.Database)
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		errs.add("params", "%v", err)
+	}
+	for k, v := range query {
+		c.Params[k] = v[len(v)-1]
+	}
+	c.liftParams(errs)
+	return c
+}
+
+// parseJDBC parses the part of a JDBC URL after "jdbc:" and maps the JDBC
+// driver properties to their Go driver equivalents
+func parseJDBC(rest string, errs *ParseError) ConnectionURL {
+	lower := strings.ToLower(rest)
+	var c ConnectionURL
+	switch {
+	case strings.HasPrefix(lower, "postgresql://"):
+		c = parseURL(DriverPostgres, rest, errs)
+	case strings.HasPrefix(lower, "mysql://"), strings.HasPrefix(lower, "mariadb://"):
+		c = parseURL(DriverMySQL, rest, errs)
+	case strings.HasPrefix(lower, "sqlite:"):
+		return parseSQLite(rest[len("sqlite:"):], errs)
+	default:
+		scheme, _, _ := strings.Cut(rest, ":")
+		errs.add("scheme", "unsupported JDBC driver %q (use postgresql, mysql, mariadb or sqlite)", scheme)
+		return c
+	}
+
+	params := c.Params
+	c.Params = make(map[string]string)
+	keys := sortedKeys(params)
+	for _, k := range keys {
+		v := params[k]
+		switch c.Driver {
+		case DriverPostgres:
+			switch k {
+			case "sslmode", "sslcert", "sslkey", "sslrootcert", "options", "application_name":
+				c.Params[k] = v
+			case "ssl":
+				if strings.EqualFold(v, "true") && params["sslmode"] == "" {
+					c.Params["sslmode"] = "require"
+				}
+			case "ApplicationName":
+				c.Params["application_name"] = v
+			case "currentSchema":
+				c.Params["search_path"] = v
+			case "connectTimeout", "loginTimeout":
+				c.Params["connect_timeout"] = v // Seconds in both
+			default:
+				c.Ignored = append(c.Ignored, k)
+			}
+		case DriverMySQL:
+			switch k {
+			case "useSSL", "requireSSL":
+				if _, ok := params["sslMode"]; ok {
+					continue
+				}
+				if strings.EqualFold(v, "true") {
+					if strings.EqualFold(params["verifyServerCertificate"], "true") {
+						c.Params["tls"] = "true"
+					} else {
+						c.Params["tls"] = "skip-verify"
+					}
+				} else if k == "useSSL" {
+					c.Params["tls"] = "false"
+				}
+			case "verifyServerCertificate":
+			case "sslMode":
+				switch strings.ToUpper(v) {
+				case "DISABLED":
+					c.Params["tls"] = "false"
+				case "PREFERRED":
+					c.Params["tls"] = "preferred"
+				case "REQUIRED":
+					c.Params["tls"] = "skip-verify"
+				case "VERIFY_CA", "VERIFY_IDENTITY":
+					c.Params["tls"] = "true"
+				default:
+					errs.add("params.sslMode", "unknown value %q", v)
+				}
+			case "serverTimezone":
+				c.Params["loc"] = v
+			case "characterEncoding":
+				c.Params["charset"] = "utf8mb4"
+				if !strings.EqualFold(strings.ReplaceAll(v, "-", ""), "utf8") {
+					c.Params["charset"] = strings.ToLower(v)
+				}
+			case "connectTimeout":
+				c.Params["timeout"] = v + "ms"
+			case "socketTimeout":
+				c.Params["readTimeout"] = v + "ms"
+				c.Params["writeTimeout"] = v + "ms"
+			case "allowMultiQueries":
+				c.Params["multiStatements"] = strings.ToLower(v)
+			default:
+				c.Ignored = append(c.Ignored, k)
+			}
+		}
+	}
+	return c
+}
+
+// parseSQLite parses a file: or sqlite:// URL or a plain path
+func parseSQLite(input string, errs *ParseError) ConnectionURL {
+	c := ConnectionURL{Driver: DriverSQLite, Params: make(map[string]string)}
+
+	rest := input
+	lower := strings.ToLower(rest)
+	for _, prefix := range []string{"sqlite3://", "sqlite://", "file:"} {
+		if strings.HasPrefix(lower, prefix) {
+			rest = rest[len(prefix):]
+			break
+		}
+	}
+	// file:///abs/path and file://localhost/abs/path
+	if strings.HasPrefix(rest, "//") {
+		rest = strings.TrimPrefix(rest[2:], "localhost")
+	}
+
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		errs.add("database", "%v", err)
+	}
+	c.Database = unescaped
+	if c.Database == "" {
+		errs.add("database", "a file path is required")
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		errs.add("params", "%v", err)
+	}
+	for k, v := range query {
+		c.Params[k] = v[len(v)-1]
+	}
+	return c
+}
+
+// parsePQ parses a PostgreSQL key=value connection string
+func parsePQ(input string, errs *ParseError) ConnectionURL {
+	c := ConnectionURL{Driver: DriverPostgres, Params: make(map[string]string)}
+	pairs, err := parsePQKeyValues(input)
+	if err != nil {
+		errs.add("dsn", "%v", err)
+		return c
+	}
+	for _, kv := range pairs {
+		c.Params[kv[0]] = kv[1]
+	}
+	c.liftParams(errs)
+	return c
+}
+
+// parseMySQL parses a go-sql-driver/mysql DSN: user:pass@tcp(host:port)/db?params
+func parseMySQL(input string, errs *ParseError) ConnectionURL {
+	c := ConnectionURL{Driver: DriverMySQL, Params: make(map[string]string)}
+	cfg, err := mysql.ParseDSN(input)
+	if err != nil {
+		errs.add("dsn", "%v", err)
+		return c
+	}
+
+	c.User, c.Password, c.Database = cfg.User, cfg.Passwd, cfg.DBName
+	switch cfg.Net {
+	case "unix":
+		c.Host = cfg.Addr
+	default:
+		host, port, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			errs.add("host", "%v", err)
+			break
+		}
+		c.Host = host
+		if port != "3306" {
+			c.setPort(port, errs)
+		}
+	}
+
+	// ParseDSN folds known parameters into Config fields; read them from the string instead
+	if slash := strings.LastIndex(input, "/"); slash >= 0 {
+		if _, rawQuery, ok := strings.Cut(input[slash:], "?"); ok {
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				errs.add("params", "%v", err)
+			}
+			for k, v := range query {
+				c.Params[k] = v[len(v)-1]
+			}
+		}
+	}
+	return c
+}
+
+// liftParams moves connection fields given as parameters into the struct
+func (c *ConnectionURL) liftParams(errs *ParseError) {
+	lift := func(key string, field *string) {
+		if v, ok := c.Params[key]; ok {
+			if *field == "" {
+				*field = v
+			}
+			delete(c.Params, key)
+		}
+	}
+
+	lift("user", &c.User)
+	lift("password", &c.Password)
+	switch c.Driver {
+	case DriverPostgres:
+		lift("dbname", &c.Database)
+		lift("host", &c.Host)
+		if port, ok := c.Params["port"]; ok {
+			delete(c.Params, "port")
+			if c.Port == 0 {
+				c.setPort(port, errs)
+			}
+		}
+	case DriverMySQL:
+		lift("socket", &c.Host)
+	}
+}
+
+// setPort parses a port number, recording an error when it is invalid
+func (c *ConnectionURL) setPort(port string, errs *ParseError) {
+	if port == "" {
+		return
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		errs.add("port", "must be between 1 and 65535 (got %q)", port)
+		return
+	}
+	c.Port = n
+}
+
+// validate checks values the drivers would reject
+func (c ConnectionURL) validate(errs *ParseError) {
+	switch c.Driver {
+	case DriverPostgres:
+		// lib/pq supports no allow or prefer mode
+		switch c.Params["sslmode"] {
+		case "", TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+		default:
+			errs.add("params.sslmode", "must be disable, require, verify-ca or verify-full (got %q)", c.Params["sslmode"])
+		}
+		if _, err := strconv.Atoi(orDefault(c.Params["connect_timeout"], "0")); err != nil {
+			errs.add("params.connect_timeout", "must be a number of seconds (got %q)", c.Params["connect_timeout"])
+		}
+	case DriverMySQL:
+		if strings.HasPrefix(c.Host, "/") && c.Port != 0 {
+			errs.add("port", "cannot be combined with a socket path")
+		}
+		// Let the driver check the parameters it knows
+		dsn, err := c.DSN()
+		if err == nil {
+			_, err = mysql.ParseDSN(dsn)
+		}
+		if err != nil {
+			errs.add("params", "%v", err)
+		}
+	}
+}
+
+// DSN returns the connection string in the form the driver expects:
+// a postgres:// URL for lib/pq, user:pass@tcp(host:port)/db for
+// go-sql-driver/mysql and a path or file: URL for go-sqlite3
+func (c ConnectionURL) DSN() (string, error) {
+	switch c.Driver {
+	case DriverPostgres:
+		return c.postgresURL(c.Password).String(), nil
+	case DriverMySQL:
+		cfg := mysql.NewConfig()
+		cfg.User, cfg.Passwd, cfg.DBName = c.User, c.Password, c.Database
+		switch {
+		case strings.HasPrefix(c.Host, "/"):
+			cfg.Net, cfg.Addr = "unix", c.Host
+		case c.Host != "" || c.Port != 0:
+			cfg.Net, cfg.Addr = "tcp", net.JoinHostPort(orDefault(c.Host, "127.0.0.1"), strconv.Itoa(orDefaultInt(c.Port, 3306)))
+		}
+		return overrideParams(DriverMySQL, cfg.FormatDSN(), c.Params), nil
+	case DriverSQLite:
+		if len(c.Params) == 0 {
+			return c.Database, nil
+		}
+		return "file:" + c.Database + "?" + encodeParams(c.Params), nil
+	default:
+		return "", fmt.Errorf("unsupported driver %q", c.Driver)
+	}
+}
+
+// Profile returns a connection profile with the password moved out of the DSN
+func (c ConnectionURL) Profile() (Profile, error) {
+	password := c.Password
+	c.Password = ""
+	dsn, err := c.DSN()
+	if err != nil {
+		return Profile{}, err
+	}
+	return Profile{Driver: c.Driver, DSN: dsn, Password: password}, nil
+}
+
+// Redacted returns the connection as a URL with the password and other
+// secret parameters masked, for display and logs
+func (c ConnectionURL) Redacted() string {
+	params := make(map[string]string, len(c.Params))
+	for k, v := range c.Params {
+		if isSecretParam(k) {
+			v = redactedValue
+		}
+		params[k] = v
+	}
+	c.Params = params
+
+	password := ""
+	if c.Password != "" {
+		password = redactedValue
+	}
+
+	switch c.Driver {
+	case DriverPostgres:
+		return c.postgresURL(password).String()
+	case DriverMySQL:
+		u := &url.URL{Scheme: "mysql", Path: "/" + c.Database, RawQuery: encodeParams(c.Params)}
+		u.User = userInfo(c.User, password)
+		if strings.HasPrefix(c.Host, "/") {
+			params["socket"] = c.Host
+			u.RawQuery = encodeParams(params)
+		} else if c.Host != "" || c.Port != 0 {
+			u.Host = hostPort(orDefault(c.Host, "127.0.0.1"), c.Port)
+		}
+		return u.String()
+	default:
+		s := "file:" + c.Database
+		if len(c.Params) > 0 {
+			s += "?" + encodeParams(c.Params)
+		}
+		return s
+	}
+}
+
+// postgresURL builds a lib/pq URL with the given password
+func (c ConnectionURL) postgresURL(password string) *url.URL {
+	params := make(map[string]string, len(c.Params)+1)
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	u := &url.URL{Scheme: "postgres", User: userInfo(c.User, password)}
+	if c.Database != "" {
+		u.Path = "/" + c.Database
+	}
+	if strings.HasPrefix(c.Host, "/") {
+		// Unix socket directories go in the host parameter
+		params["host"] = c.Host
+		if c.Port != 0 {
+			params["port"] = strconv.Itoa(c.Port)
+		}
+		u.Host = ""
+	} else {
+		u.Host = hostPort(c.Host, c.Port)
+	}
+	if u.Host == "" && u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = encodeParams(params)
+	return u
+}
+
+// RedactDSN returns a loggable form of a DSN or connection URL
+func RedactDSN(driverName, dsn string) string {
+	c, err := ParseConnectionString(dsn, driverName)
+	if err != nil {
+		return "[unparseable connection string]"
+	}
+	return c.Redacted()
+}
+
+// NormalizeConnection returns the profile with a supported driver name and a
+// DSN the driver can read. URL and JDBC strings are converted, and name the
+// driver when the profile does not; native DSNs are kept as given.
+func (p Profile) NormalizeConnection() (Profile, error) {
+	lower := strings.ToLower(strings.TrimSpace(p.DSN))
+	native := !isConnectionURL(p.DSN) ||
+		(p.Driver != "" && (strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://") || strings.HasPrefix(lower, "file:")))
+
+	if !native {
+		c, err := ParseConnectionString(p.DSN, p.Driver)
+		if err != nil {
+			return p, err
+		}
+		if p.DSN, err = c.DSN(); err != nil {
+			return p, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+		p.Driver = c.Driver
+	}
+
+	driverName, err := NormalizeDriver(p.Driver)
+	if err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	p.Driver = driverName
+	if err := p.Limits.validate(); err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	return p, nil
+}
+
+// isSecretParam reports whether a DSN parameter holds a secret
+func isSecretParam(key string) bool {
+	switch strings.ToLower(key) {
+	case "password", "sslpassword", "sslkey", "passwd":
+		return true
+	}
+	return false
+}
+
+// userInfo builds URL credentials; nil when there are none
+func userInfo(user, password string) *url.Userinfo {
+	switch {
+	case password != "":
+		return url.UserPassword(user, password)
+	case user != "":
+		return url.User(user)
+	default:
+		return nil
+	}
+}
+
+// hostPort joins a host and an optional port
+func hostPort(host string, port int) string {
+	if port == 0 {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// encodeParams encodes parameters as a query string in key order
+func encodeParams(params map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(params) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(params[k]))
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// orDefault returns s, or def when s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// orDefaultInt returns n, or def when n is zero
+func orDefaultInt(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
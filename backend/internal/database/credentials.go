@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithoutSecrets returns a copy of the profile with every password, passphrase
+// and inline private key removed, along with the names of the removed fields
+func (p Profile) WithoutSecrets() (Profile, []string, error) {
+	var removed []string
+
+	if p.Password != "" {
+		p.Password = ""
+		removed = append(removed, "password")
+	}
+
+	if driverName, err := NormalizeDriver(p.Driver); err == nil && p.DSN != "" {
+		password, err := dsnPassword(driverName, p.DSN)
+		if err != nil {
+			return p, nil, fmt.Errorf("invalid dsn: %w", err)
+		}
+		if password != "" {
+			if p.DSN, err = setDSNPassword(driverName, p.DSN, ""); err != nil {
+				return p, nil, fmt.Errorf("invalid dsn: %w", err)
+			}
+			removed = append(removed, "dsn password")
+		}
+	}
+
+	if p.SSH != nil {
+		ssh := *p.SSH
+		ssh.SSHHost, removed = ssh.SSHHost.withoutSecrets("ssh", removed)
+		ssh.JumpHosts = append([]SSHHost(nil), ssh.JumpHosts...)
+		for i := range ssh.JumpHosts {
+			ssh.JumpHosts[i], removed = ssh.JumpHosts[i].withoutSecrets(fmt.Sprintf("ssh jump_hosts[%d]", i), removed)
+		}
+		p.SSH = &ssh
+	}
+
+	if p.TLS != nil && p.TLS.Key != "" {
+		// The client certificate is public and stays, to pair with a
+		// key_secret or key_path
+		tls := *p.TLS
+		tls.Key = ""
+		removed = append(removed, "tls key")
+		p.TLS = &tls
+	}
+
+	return p, removed, nil
+}
+
+// withoutSecrets clears the host's credentials, recording them under prefix
+func (h SSHHost) withoutSecrets(prefix string, removed []string) (SSHHost, []string) {
+	if h.Password != "" {
+		h.Password = ""
+		removed = append(removed, prefix+" password")
+	}
+	if h.Passphrase != "" {
+		h.Passphrase = ""
+		removed = append(removed, prefix+" passphrase")
+	}
+	if h.PrivateKey != "" {
+		h.PrivateKey = ""
+		removed = append(removed, prefix+" private_key")
+	}
+	return h, removed
+}
+
+// resolveSecrets returns a copy of the profile with every secret reference
+// replaced by the stored value
+func (m *Manager) resolveSecrets(ctx context.Context, p Profile) (Profile, error) {
+	resolve := func(field string, value *string, id string) error {
+		if id == "" {
+			return nil
+		}
+		if *value != "" {
+			return fmt.Errorf("%w: %s and %s_secret are mutually exclusive", ErrInvalidProfile, field, field)
+		}
+		if m.resolveSecret == nil {
+			return fmt.Errorf("%w: no secret store is configured", ErrSecretUnavailable)
+		}
+		secret, err := m.resolveSecret(ctx, id)
+		if err != nil {
+			return fmt.Errorf("%w: %s_secret %q: %w", ErrSecretUnavailable, field, id, err)
+		}
+		*value = secret
+		return nil
+	}
+	resolveHost := func(prefix string, h *SSHHost) error {
+		if err := resolve(prefix+" password", &h.Password, h.PasswordSecret); err != nil {
+			return err
+		}
+		if err := resolve(prefix+" private_key", &h.PrivateKey, h.PrivateKeySecret); err != nil {
+			return err
+		}
+		return resolve(prefix+" passphrase", &h.Passphrase, h.PassphraseSecret)
+	}
+
+	if err := resolve("password", &p.Password, p.PasswordSecret); err != nil {
+		return p, err
+	}
+
+	if p.SSH != nil {
+		ssh := *p.SSH
+		if err := resolveHost("ssh", &ssh.SSHHost); err != nil {
+			return p, err
+		}
+		ssh.JumpHosts = append([]SSHHost(nil), ssh.JumpHosts...)
+		for i := range ssh.JumpHosts {
+			if err := resolveHost(fmt.Sprintf("ssh jump_hosts[%d]", i), &ssh.JumpHosts[i]); err != nil {
+				return p, err
+			}
+		}
+		p.SSH = &ssh
+	}
+
+	if p.TLS != nil {
+		tls := *p.TLS
+		if err := resolve("tls key", &tls.Key, tls.KeySecret); err != nil {
+			return p, err
+		}
+		p.TLS = &tls
+	}
+
+	return p, nil
+}
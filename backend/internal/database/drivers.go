@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Supported driver names
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite3"
+)
+
+// DriverDefaults holds settings applied to every connection of a driver
+type DriverDefaults struct {
+	ConnectTimeout int64             // Milliseconds; 0 means no timeout
+	Params         map[string]string // DSN parameters added unless already present
+}
+
+// NormalizeDriver maps the accepted driver aliases to a supported driver name
+func NormalizeDriver(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "postgres", "postgresql", "pg":
+		return DriverPostgres, nil
+	case "mysql", "mariadb":
+		return DriverMySQL, nil
+	case "sqlite", "sqlite3":
+		return DriverSQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported driver %q (use postgres, mysql or sqlite3)", name)
+	}
+}
+
+// openConnector creates a driver.Connector for dsn.
+// A non-nil tunnel replaces the driver's own network dialing.
+func openConnector(driverName, dsn string, tunnel *sshTunnel) (driver.Connector, error) {
+	switch driverName {
+	case DriverPostgres:
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		if tunnel != nil {
+			connector.Dialer(tunnel)
+		}
+		return connector, nil
+	case DriverMySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		if tunnel != nil {
+			cfg.DialFunc = tunnel.DialContext
+		}
+		return mysql.NewConnector(cfg)
+	case DriverSQLite:
+		if tunnel != nil {
+			return nil, fmt.Errorf("ssh tunnels are not supported for sqlite3")
+		}
+		return &dsnConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported driver %q", driverName)
+	}
+}
+
+// dsnConnector adapts drivers that don't implement driver.DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+// Connect implements driver.Connector
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver implements driver.Connector
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// applyDefaultParams adds driver default parameters that the DSN does not set itself
+func applyDefaultParams(driverName, dsn string, params map[string]string) string {
+	return mergeParams(driverName, dsn, params, false)
+}
+
+// overrideParams sets parameters on the DSN, replacing any it already has
+func overrideParams(driverName, dsn string, params map[string]string) string {
+	return mergeParams(driverName, dsn, params, true)
+}
+
+// mergeParams adds params to the DSN; existing ones are kept unless override is set
+func mergeParams(driverName, dsn string, params map[string]string, override bool) string {
+	if len(params) == 0 {
+		return dsn
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// PostgreSQL key=value form: "host=localhost dbname=app"; the last occurrence of a key wins
+	if driverName == DriverPostgres && !strings.Contains(dsn, "://") {
+		for _, k := range keys {
+			if override || !strings.Contains(dsn, k+"=") {
+				dsn = strings.TrimSpace(dsn + " " + k + "=" + quotePQValue(params[k]))
+			}
+		}
+		return dsn
+	}
+
+	// URL-style query parameters: postgres://..., user@tcp(host)/db?..., file:app.db?...
+	base, rawQuery, _ := strings.Cut(dsn, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dsn
+	}
+	for _, k := range keys {
+		if _, ok := query[k]; override || !ok {
+			query.Set(k, params[k])
+		}
+	}
+	return base + "?" + query.Encode()
+}
+
+// quotePQValue quotes a value for a PostgreSQL key=value connection string
+func quotePQValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// dsnPassword returns the password embedded in dsn, if any
+func dsnPassword(driverName, dsn string) (string, error) {
+	switch driverName {
+	case DriverPostgres:
+		if strings.Contains(dsn, "://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return "", err
+			}
+			password, _ := u.User.Password()
+			if password == "" {
+				password = u.Query().Get("password")
+			}
+			return password, nil
+		}
+		pairs, err := parsePQKeyValues(dsn)
+		if err != nil {
+			return "", err
+		}
+		var password string
+		for _, kv := range pairs {
+			if kv[0] == "password" {
+				password = kv[1]
+			}
+		}
+		return password, nil
+	case DriverMySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", err
+		}
+		return cfg.Passwd, nil
+	default:
+		return "", nil
+	}
+}
+
+// setDSNPassword replaces the password in dsn; an empty password removes it
+func setDSNPassword(driverName, dsn, password string) (string, error) {
+	switch driverName {
+	case DriverPostgres:
+		if strings.Contains(dsn, "://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return "", err
+			}
+			if u.User != nil {
+				if password == "" {
+					u.User = url.User(u.User.Username())
+				} else {
+					u.User = url.UserPassword(u.User.Username(), password)
+				}
+			}
+			query := u.Query()
+			if query.Has("password") || (u.User == nil && password != "") {
+				if password == "" {
+					query.Del("password")
+				} else {
+					query.Set("password", password)
+				}
+				u.RawQuery = query.Encode()
+			}
+			return u.String(), nil
+		}
+		pairs, err := parsePQKeyValues(dsn)
+		if err != nil {
+			return "", err
+		}
+		var parts []string
+		for _, kv := range pairs {
+			if kv[0] != "password" {
+				parts = append(parts, kv[0]+"="+quotePQValue(kv[1]))
+			}
+		}
+		if password != "" {
+			parts = append(parts, "password="+quotePQValue(password))
+		}
+		return strings.Join(parts, " "), nil
+	case DriverMySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", err
+		}
+		cfg.Passwd = password
+		return cfg.FormatDSN(), nil
+	default:
+		if password != "" {
+			return "", fmt.Errorf("%s connections do not take a password", driverName)
+		}
+		return dsn, nil
+	}
+}
+
+// parsePQKeyValues splits a PostgreSQL key=value connection string,
+// unquoting values written as 'it\'s'
+func parsePQKeyValues(dsn string) ([][2]string, error) {
+	var pairs [][2]string
+	s := strings.TrimSpace(dsn)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("missing \"=\" after %q in connection string", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\n")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			i := 1
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for %q", key)
+			}
+			s = s[i+1:]
+		} else {
+			i := 0
+			for ; i < len(s) && !strings.ContainsRune(" \t\n", rune(s[i])); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			s = s[i:]
+		}
+
+		pairs = append(pairs, [2]string{key, value.String()})
+		s = strings.TrimLeft(s, " \t\n")
+	}
+	return pairs, nil
+}
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/sqlparse"
+)
+
+// ExplainOptions controls plan capture
+type ExplainOptions struct {
+	QueryOptions
+	Analyze bool // Execute the statement for actual rows and timing (PostgreSQL only)
+}
+
+// Plan is an execution plan normalized across drivers
+type Plan struct {
+	Driver      string      `msgpack:"driver"`
+	Analyzed    bool        `msgpack:"analyzed"` // Actual rows and timing are filled in
+	Root        *PlanNode   `msgpack:"root"`
+	PlanningMs  *float64    `msgpack:"planning_ms"`  // Reported by PostgreSQL
+	ExecutionMs *float64    `msgpack:"execution_ms"` // Reported by PostgreSQL with analyze
+	Raw         interface{} `msgpack:"raw"`          // The driver's plan output as returned
+	Stats       QueryStats  `msgpack:"stats"`
+	DurationMs  int64       `msgpack:"duration_ms"`
+}
+
+// PlanNode is one operation of a plan. Figures the driver does not report are nil.
+type PlanNode struct {
+	NodeType      string                 `msgpack:"node_type"` // e.g. Seq Scan, table, SEARCH
+	Relation      string                 `msgpack:"relation"`  // Table the node reads, if any
+	Detail        string                 `msgpack:"detail"`
+	StartupCost   *float64               `msgpack:"startup_cost"`
+	TotalCost     *float64               `msgpack:"total_cost"`
+	EstimatedRows *float64               `msgpack:"estimated_rows"`
+	ActualRows    *float64               `msgpack:"actual_rows"`
+	ActualTimeMs  *float64               `msgpack:"actual_time_ms"` // Across all loops
+	Loops         *float64               `msgpack:"loops"`
+	Properties    map[string]interface{} `msgpack:"properties"` // Remaining driver-specific fields
+	Children      []*PlanNode            `msgpack:"children"`
+}
+
+// Explain captures the execution plan of a single statement. With analyze
+// the statement runs inside a transaction that is rolled back, unless it is
+// part of an open transaction.
+func (m *Manager) Explain(ctx context.Context, id, query string, opts ExplainOptions) (*Plan, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	stmts := sqlparse.Parse(query, sqlparse.Dialect(conn.Driver))
+	switch {
+	case len(stmts) != 1:
+		return nil, fmt.Errorf("%w: explain needs exactly one statement, got %d", ErrInvalidQuery, len(stmts))
+	case stmts[0].Keyword == "EXPLAIN":
+		return nil, fmt.Errorf("%w: the statement is already an EXPLAIN", ErrInvalidQuery)
+	case opts.Analyze && conn.Driver != DriverPostgres:
+		return nil, fmt.Errorf("%w: analyze is only supported on postgres", ErrInvalidQuery)
+	}
+
+	var prefix string
+	switch {
+	case conn.Driver == DriverPostgres && opts.Analyze:
+		prefix = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+	case conn.Driver == DriverPostgres:
+		prefix = "EXPLAIN (FORMAT JSON) "
+	case conn.Driver == DriverMySQL:
+		prefix = "EXPLAIN FORMAT=JSON "
+	default:
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	explain := prefix + stmts[0].Text
+
+	// The EXPLAIN is checked like any query, so EXPLAIN ANALYZE of a write
+	// needs confirmation on a read-only connection
+	plan, err := m.plan(id, explain, opts.QueryOptions, false)
+	if err != nil {
+		return nil, err
+	}
+	bound, args, err := bindParams(conn.Driver, explain, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := opts.Limits.withDefaults(conn.Limits)
+	start := time.Now()
+	var result *Result
+	err = m.run(ctx, plan, opts.Analyze || needsSession(conn.Driver, limits), func(q querier) error {
+		if opts.Analyze && plan.tx == nil {
+			starter, ok := q.(beginner)
+			if !ok {
+				return fmt.Errorf("cannot start a transaction for explain analyze")
+			}
+			tx, err := starter.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			q = tx
+		}
+		return withTimeout(ctx, conn.Driver, q, limits, func(ctx context.Context) error {
+			var err error
+			result, err = execute(ctx, q, bound, args, true, fetchOptions{driver: conn.Driver})
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Plan{Driver: conn.Driver, Analyzed: opts.Analyze, Stats: result.Stats}
+	switch conn.Driver {
+	case DriverPostgres:
+		err = parsePostgresPlan(result, out)
+	case DriverMySQL:
+		err = parseMySQLPlan(result, out)
+	default:
+		parseSQLitePlan(result, out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.DurationMs = time.Since(start).Milliseconds()
+	return out, nil
+}
+
+// planJSON decodes the single JSON document an EXPLAIN returned
+func planJSON(result *Result) (interface{}, error) {
+	if len(result.Rows) == 0 || len(result.Rows[0]) == 0 {
+		return nil, fmt.Errorf("explain returned no plan")
+	}
+	var text []byte
+	switch v := result.Rows[0][0].(type) {
+	case string:
+		text = []byte(v)
+	case []byte:
+		text = v
+	case JSON:
+		text = []byte(v.Value)
+	default:
+		return nil, fmt.Errorf("unexpected plan value %T", v)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(text, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	return doc, nil
+}
+
+// parsePostgresPlan reads the output of EXPLAIN (FORMAT JSON)
+func parsePostgresPlan(result *Result, out *Plan) error {
+	doc, err := planJSON(result)
+	if err != nil {
+		return err
+	}
+	out.Raw = doc
+	list, _ := doc.([]interface{})
+	if len(list) == 0 {
+		return fmt.Errorf("unexpected plan format")
+	}
+	top, _ := list[0].(map[string]interface{})
+	root, _ := top["Plan"].(map[string]interface{})
+	if root == nil {
+		return fmt.Errorf("unexpected plan format")
+	}
+	out.Root = postgresNode(root)
+	out.PlanningMs = number(top["Planning Time"])
+	out.ExecutionMs = number(top["Execution Time"])
+	return nil
+}
+
+// postgresDetailKeys are summarized in PlanNode.Detail, in this order
+var postgresDetailKeys = []string{"Join Type", "Strategy", "Index Name", "Index Cond", "Hash Cond", "Merge Cond", "Filter", "Sort Key"}
+
+// postgresNode converts a PostgreSQL plan node and its children
+func postgresNode(m map[string]interface{}) *PlanNode {
+	node := &PlanNode{
+		NodeType:      stringValue(m["Node Type"]),
+		Relation:      stringValue(m["Relation Name"]),
+		StartupCost:   number(m["Startup Cost"]),
+		TotalCost:     number(m["Total Cost"]),
+		EstimatedRows: number(m["Plan Rows"]),
+		ActualRows:    number(m["Actual Rows"]),
+		Loops:         number(m["Actual Loops"]),
+		Properties:    make(map[string]interface{}),
+	}
+	// Actual times are per loop
+	if t := number(m["Actual Total Time"]); t != nil {
+		total := *t
+		if node.Loops != nil {
+			total *= *node.Loops
+		}
+		node.ActualTimeMs = &total
+	}
+
+	var detail []string
+	for _, key := range postgresDetailKeys {
+		if v, ok := m[key]; ok {
+			detail = append(detail, key+": "+fmt.Sprint(v))
+		}
+	}
+	node.Detail = strings.Join(detail, "; ")
+
+	for key, v := range m {
+		switch key {
+		case "Node Type", "Relation Name", "Startup Cost", "Total Cost", "Plan Rows", "Actual Rows",
+			"Actual Loops", "Actual Total Time", "Plans":
+		default:
+			node.Properties[key] = v
+		}
+	}
+	children, _ := m["Plans"].([]interface{})
+	for _, c := range children {
+		if child, ok := c.(map[string]interface{}); ok {
+			node.Children = append(node.Children, postgresNode(child))
+		}
+	}
+	return node
+}
+
+// mysqlOperations are the keys of MySQL JSON plans that hold plan nodes
+var mysqlOperations = map[string]bool{
+	"query_block": true, "table": true, "nested_loop": true, "ordering_operation": true,
+	"grouping_operation": true, "duplicates_removal": true, "union_result": true,
+	"materialized_from_subquery": true, "windowing": true, "buffer_result": true,
+	"query_specifications": true, "attached_subqueries": true, "optimized_away_subqueries": true,
+	"subqueries": true, "having_subqueries": true, "select_list_subqueries": true,
+	"order_by_subqueries": true, "group_by_subqueries": true, "update_value_subqueries": true,
+}
+
+// parseMySQLPlan reads the output of EXPLAIN FORMAT=JSON
+func parseMySQLPlan(result *Result, out *Plan) error {
+	doc, err := planJSON(result)
+	if err != nil {
+		return err
+	}
+	out.Raw = doc
+	top, _ := doc.(map[string]interface{})
+	block, ok := top["query_block"]
+	if !ok {
+		return fmt.Errorf("unexpected plan format")
+	}
+	out.Root = mysqlNode("query_block", block)
+	return nil
+}
+
+// mysqlNode converts a MySQL plan operation. Arrays such as nested_loop
+// become a node whose children are their elements.
+func mysqlNode(name string, value interface{}) *PlanNode {
+	node := &PlanNode{NodeType: name, Properties: make(map[string]interface{})}
+
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			node.Children = append(node.Children, mysqlChildren(item)...)
+		}
+		return node
+	}
+
+	m, _ := value.(map[string]interface{})
+	costs, _ := m["cost_info"].(map[string]interface{})
+	node.TotalCost = number(costs["query_cost"])
+	if node.TotalCost == nil {
+		node.TotalCost = number(costs["prefix_cost"])
+	}
+	node.EstimatedRows = number(m["rows_produced_per_join"])
+	if name == "table" {
+		node.Relation = stringValue(m["table_name"])
+		node.Detail = "access_type: " + stringValue(m["access_type"])
+		if key := stringValue(m["key"]); key != "" {
+			node.Detail += "; key: " + key
+		}
+	}
+
+	for key, v := range m {
+		switch {
+		case mysqlOperations[key]:
+			node.Children = append(node.Children, mysqlNode(key, v))
+		case key == "table_name" || key == "rows_produced_per_join":
+		default:
+			node.Properties[key] = v
+		}
+	}
+	sortNodes(node.Children)
+	return node
+}
+
+// mysqlChildren converts the operations inside an array element, such as
+// {"table": {...}} in a nested loop
+func mysqlChildren(item interface{}) []*PlanNode {
+	m, _ := item.(map[string]interface{})
+	var nodes []*PlanNode
+	for key, v := range m {
+		if mysqlOperations[key] {
+			nodes = append(nodes, mysqlNode(key, v))
+		}
+	}
+	sortNodes(nodes)
+	return nodes
+}
+
+// sortNodes orders sibling nodes decoded from a JSON object, whose key order is lost
+func sortNodes(nodes []*PlanNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].NodeType < nodes[j].NodeType
+	})
+}
+
+// parseSQLitePlan builds a tree from the id/parent rows of EXPLAIN QUERY PLAN
+func parseSQLitePlan(result *Result, out *Plan) {
+	out.Raw = result.Rows
+	out.Root = &PlanNode{NodeType: "QUERY PLAN", Properties: map[string]interface{}{}}
+
+	nodes := map[int64]*PlanNode{0: out.Root}
+	for _, row := range result.Rows {
+		if len(row) < 4 {
+			continue
+		}
+		id, _ := row[0].(int64)
+		parentID, _ := row[1].(int64)
+		detail := stringValue(row[3])
+
+		node := &PlanNode{NodeType: detail, Detail: detail, Properties: map[string]interface{}{}}
+		words := strings.Fields(detail)
+		if len(words) >= 2 && (words[0] == "SCAN" || words[0] == "SEARCH") && words[1] != "CONSTANT" && words[1] != "SUBQUERY" {
+			node.NodeType = words[0]
+			node.Relation = words[1]
+			// Older SQLite versions write SCAN TABLE t
+			if words[1] == "TABLE" && len(words) > 2 {
+				node.Relation = words[2]
+			}
+		}
+
+		parent, ok := nodes[parentID]
+		if !ok {
+			parent = out.Root
+		}
+		parent.Children = append(parent.Children, node)
+		nodes[id] = node
+	}
+}
+
+// number returns a JSON number or numeric string as a float, or nil
+func number(v interface{}) *float64 {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case int64:
+		f = float64(n)
+	case string:
+		if _, err := fmt.Sscanf(n, "%g", &f); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &f
+}
+
+// stringValue returns v as a string, or "" for nil
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// State is the monitored health of a connection
+type State string
+
+// Connection states
+const (
+	StateConnected    State = "connected"    // Pings succeed in time
+	StateDegraded     State = "degraded"     // Pings are slow or have started failing
+	StateReconnecting State = "reconnecting" // The pool is being reopened with backoff
+	StateFailed       State = "failed"       // Reconnecting gave up; Reconnect retries
+)
+
+// HealthOptions tunes the connection monitor
+type HealthOptions struct {
+	Interval         time.Duration // Time between pings of each connection
+	Timeout          time.Duration // Ping and reconnect timeout
+	SlowThreshold    time.Duration // Slower pings mark a connection degraded; 0 disables
+	FailureThreshold int           // Consecutive failed pings before reconnecting
+	BackoffInitial   time.Duration
+	BackoffMax       time.Duration
+	MaxAttempts      int // Reconnect attempts before giving up; 0 retries forever
+}
+
+// Health is the monitored state of a connection
+type Health struct {
+	State     State     `msgpack:"state"`
+	Since     time.Time `msgpack:"since"`
+	LastCheck time.Time `msgpack:"last_check"`
+	LatencyMs int64     `msgpack:"latency_ms"`
+	Failures  int       `msgpack:"failures"` // Consecutive failed pings
+	Attempts  int       `msgpack:"attempts"` // Reconnect attempts since the connection was lost
+	LastError string    `msgpack:"last_error,omitempty"`
+}
+
+// StateChange reports a connection moving to a new state, or another
+// reconnect attempt while it stays in StateReconnecting
+type StateChange struct {
+	ConnectionID string `msgpack:"connection_id"`
+	Name         string `msgpack:"name"`
+	State        State  `msgpack:"state"`
+	Previous     State  `msgpack:"previous_state"`
+	Error        string `msgpack:"error,omitempty"`
+	Attempt      int    `msgpack:"attempt,omitempty"`
+	NextRetryMs  int64  `msgpack:"next_retry_ms,omitempty"`
+}
+
+// withDefaults fills unset options with the built-in defaults
+func (o HealthOptions) withDefaults() HealthOptions {
+	if o.Interval <= 0 {
+		o.Interval = 15 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.FailureThreshold < 1 {
+		o.FailureThreshold = 1
+	}
+	if o.BackoffInitial <= 0 {
+		o.BackoffInitial = time.Second
+	}
+	if o.BackoffMax < o.BackoffInitial {
+		o.BackoffMax = o.BackoffInitial
+	}
+	return o
+}
+
+// backoff returns the delay after the given failed reconnect attempt
+func (o HealthOptions) backoff(attempt int) time.Duration {
+	delay := o.BackoffInitial
+	for i := 1; i < attempt && delay < o.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > o.BackoffMax {
+		delay = o.BackoffMax
+	}
+	return delay
+}
+
+// Health returns the monitored state of the connection
+func (c *Connection) Health() Health {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.health
+}
+
+// setState moves the connection to state. Callers hold c.mu.
+func (c *Connection) setState(state State) (StateChange, bool) {
+	previous := c.health.State
+	if previous == state {
+		return StateChange{}, false
+	}
+	c.health.State = state
+	c.health.Since = time.Now()
+	return c.change(previous), true
+}
+
+// change describes the current state. Callers hold c.mu.
+func (c *Connection) change(previous State) StateChange {
+	return StateChange{
+		ConnectionID: c.ID,
+		Name:         c.Name,
+		State:        c.health.State,
+		Previous:     previous,
+		Error:        c.health.LastError,
+		Attempt:      c.health.Attempts,
+	}
+}
+
+// SetHealthOptions replaces the monitor settings; they apply from the next check
+func (m *Manager) SetHealthOptions(opts HealthOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.health = opts.withDefaults()
+}
+
+// healthOptions returns the current monitor settings
+func (m *Manager) healthOptions() HealthOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.health
+}
+
+// States counts open connections by state
+func (m *Manager) States() map[State]int {
+	states := make(map[State]int)
+	for _, conn := range m.List() {
+		states[conn.Health().State]++
+	}
+	return states
+}
+
+// Reconnect reopens a connection's pool now, whatever its state.
+// It is how clients retry a connection that has failed.
+func (m *Manager) Reconnect(id string) (*Connection, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.mu.Lock()
+	conn.health.LastError = "reconnect requested"
+	change, changed := conn.setState(StateReconnecting)
+	conn.mu.Unlock()
+	if changed {
+		m.notify(change)
+	}
+
+	m.startReconnect(conn)
+	return conn, nil
+}
+
+// monitor pings every connection on the configured interval
+func (m *Manager) monitor() {
+	defer m.wg.Done()
+
+	timer := time.NewTimer(m.healthOptions().Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-timer.C:
+		}
+
+		m.checkAll()
+		timer.Reset(m.healthOptions().Interval)
+	}
+}
+
+// checkAll pings the connections that are not already being reconnected
+func (m *Manager) checkAll() {
+	opts := m.healthOptions()
+
+	var wg sync.WaitGroup
+	for _, conn := range m.List() {
+		switch conn.Health().State {
+		case StateReconnecting, StateFailed:
+			continue
+		}
+		wg.Add(1)
+		go func(conn *Connection) {
+			defer wg.Done()
+			m.check(conn, opts)
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// check pings a connection and updates its state
+func (m *Manager) check(conn *Connection, opts HealthOptions) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := conn.DB().PingContext(ctx)
+	latency := time.Since(start)
+
+	conn.mu.Lock()
+	if conn.reconnecting {
+		// A manual reconnect started while we were pinging
+		conn.mu.Unlock()
+		return
+	}
+
+	conn.health.LastCheck = time.Now()
+	conn.health.LatencyMs = latency.Milliseconds()
+
+	state := StateConnected
+	switch {
+	case err != nil:
+		conn.health.Failures++
+		conn.health.LastError = err.Error()
+		state = StateDegraded
+		if conn.health.Failures >= opts.FailureThreshold {
+			state = StateReconnecting
+		}
+	case opts.SlowThreshold > 0 && latency > opts.SlowThreshold:
+		conn.health.Failures = 0
+		conn.health.LastError = fmt.Sprintf("ping took %s (threshold %s)", latency.Round(time.Millisecond), opts.SlowThreshold)
+		state = StateDegraded
+	default:
+		conn.health.Failures = 0
+		conn.health.LastError = ""
+	}
+	change, changed := conn.setState(state)
+	conn.mu.Unlock()
+
+	if changed {
+		m.notify(change)
+	}
+	if state == StateReconnecting {
+		m.startReconnect(conn)
+	}
+}
+
+// startReconnect starts reconnecting unless it is already in progress
+func (m *Manager) startReconnect(conn *Connection) {
+	conn.mu.Lock()
+	if conn.reconnecting {
+		conn.mu.Unlock()
+		return
+	}
+	conn.reconnecting = true
+	conn.health.Attempts = 0
+	conn.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.reconnect(conn)
+}
+
+// reconnect reopens the pool with exponential backoff until it succeeds,
+// the attempts run out, or the connection is closed
+func (m *Manager) reconnect(conn *Connection) {
+	defer m.wg.Done()
+	defer func() {
+		conn.mu.Lock()
+		conn.reconnecting = false
+		conn.mu.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		opts := m.healthOptions()
+		err := m.reopen(conn, opts.Timeout)
+
+		conn.mu.Lock()
+		conn.health.Attempts = attempt
+		conn.health.LastCheck = time.Now()
+		if err == nil {
+			conn.health.Failures = 0
+			conn.health.LastError = ""
+			change, changed := conn.setState(StateConnected)
+			conn.mu.Unlock()
+
+			m.logger.Info("Database connection restored", zap.String("connection_id", conn.ID), zap.Int("attempts", attempt))
+			if changed {
+				m.notify(change)
+			}
+			return
+		}
+
+		conn.health.LastError = err.Error()
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			change, changed := conn.setState(StateFailed)
+			conn.mu.Unlock()
+
+			m.logger.Error("Giving up reconnecting", zap.String("connection_id", conn.ID), zap.Int("attempts", attempt), zap.Error(err))
+			if changed {
+				m.notify(change)
+			}
+			return
+		}
+
+		delay := opts.backoff(attempt)
+		change := conn.change(StateReconnecting)
+		change.NextRetryMs = delay.Milliseconds()
+		conn.mu.Unlock()
+
+		m.logger.Warn("Reconnect attempt failed",
+			zap.String("connection_id", conn.ID),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+		m.notify(change)
+
+		select {
+		case <-time.After(delay):
+		case <-conn.closed:
+			return
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// reopen replaces the connection's pool with a freshly verified one
+func (m *Manager) reopen(conn *Connection, timeout time.Duration) error {
+	db := sql.OpenDB(conn.connector)
+	conn.Pool.apply(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return err
+	}
+
+	conn.mu.Lock()
+	select {
+	case <-conn.closed:
+		conn.mu.Unlock()
+		db.Close()
+		return fmt.Errorf("connection closed")
+	default:
+	}
+	old := conn.db
+	conn.db = db
+	conn.mu.Unlock()
+
+	// Statements prepared on the old pool are prepared again when next used
+	conn.statements.invalidate()
+
+	// Close waits for queries still running on the old pool
+	go old.Close()
+	return nil
+}
+
+// notify reports a state change to the logger and the configured callback
+func (m *Manager) notify(change StateChange) {
+	m.logger.Info("Database connection state changed",
+		zap.String("connection_id", change.ConnectionID),
+		zap.String("state", string(change.State)),
+		zap.String("previous_state", string(change.Previous)),
+		zap.String("error", change.Error),
+	)
+	if m.onStateChange != nil {
+		m.onStateChange(change)
+	}
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// slotLimiter caps the number of physical database connections across all pools
+type slotLimiter struct {
+	slots   chan struct{}
+	open    atomic.Int64
+	timeout atomic.Int64 // Longest wait for a free slot in nanoseconds; 0 waits for ctx only
+}
+
+// newSlotLimiter creates a limiter allowing max concurrent physical
+// connections, waiting at most timeout for a free slot
+func newSlotLimiter(max int, timeout time.Duration) *slotLimiter {
+	l := &slotLimiter{slots: make(chan struct{}, max)}
+	l.setTimeout(timeout)
+	return l
+}
+
+// setTimeout changes the longest wait for a free slot
+func (l *slotLimiter) setTimeout(timeout time.Duration) {
+	l.timeout.Store(int64(timeout))
+}
+
+// acquire reserves a slot, waiting until one is free, the acquire timeout
+// passes or ctx is done
+func (l *slotLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		l.open.Add(1)
+		return nil
+	default:
+	}
+
+	var expired <-chan time.Time
+	if timeout := time.Duration(l.timeout.Load()); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.open.Add(1)
+		return nil
+	case <-expired:
+		return fmt.Errorf("%w: all %d database connections stayed in use for %s", ErrPoolExhausted, cap(l.slots), time.Duration(l.timeout.Load()))
+	case <-ctx.Done():
+		return fmt.Errorf("all %d database connections are in use: %w", cap(l.slots), ctx.Err())
+	}
+}
+
+// release frees a slot
+func (l *slotLimiter) release() {
+	l.open.Add(-1)
+	<-l.slots
+}
+
+// Open returns the number of physical connections currently open
+func (l *slotLimiter) Open() int {
+	return int(l.open.Load())
+}
+
+// Max returns the global connection cap
+func (l *slotLimiter) Max() int {
+	return cap(l.slots)
+}
+
+// limitedConnector opens connections through a base connector, holding a
+// limiter slot for as long as each physical connection stays open
+type limitedConnector struct {
+	base    driver.Connector
+	limiter *slotLimiter
+}
+
+// Connect implements driver.Connector
+func (c *limitedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		c.limiter.release()
+		return nil, err
+	}
+
+	return &limitedConn{Conn: conn, limiter: c.limiter}, nil
+}
+
+// Driver implements driver.Connector
+func (c *limitedConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// limitedConn releases its limiter slot when closed. It forwards the optional
+// driver interfaces so database/sql behaves exactly as with the bare driver.
+type limitedConn struct {
+	driver.Conn
+	limiter *slotLimiter
+	closed  atomic.Bool
+}
+
+// Unwrap returns the underlying driver connection
+func (c *limitedConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+// Close closes the connection and frees its slot
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	if c.closed.CompareAndSwap(false, true) {
+		c.limiter.release()
+	}
+	return err
+}
+
+// PrepareContext implements driver.ConnPrepareContext
+func (c *limitedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *limitedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.ReadOnly || opts.Isolation != driver.IsolationLevel(0) {
+		return nil, fmt.Errorf("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *limitedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *limitedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// Ping implements driver.Pinger
+func (c *limitedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *limitedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator
+func (c *limitedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue implements driver.NamedValueChecker
+func (c *limitedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// ErrQueryTimeout is returned when a statement runs past its timeout
+var ErrQueryTimeout = errors.New("query timed out")
+
+// QueryLimits bounds a query. Zero values fall back to the connection
+// profile's limits; zero there means unlimited.
+type QueryLimits struct {
+	TimeoutMs int64 `msgpack:"timeout_ms"` // Per statement
+	MaxRows   int   `msgpack:"max_rows"`   // Rows fetched per statement before the result is truncated
+	// Bytes of a text, binary or JSON value sent before it is truncated
+	MaxValueSize int `msgpack:"max_value_size"`
+}
+
+// withDefaults fills unset limits from defaults
+func (l QueryLimits) withDefaults(defaults QueryLimits) QueryLimits {
+	if l.TimeoutMs == 0 {
+		l.TimeoutMs = defaults.TimeoutMs
+	}
+	if l.MaxRows == 0 {
+		l.MaxRows = defaults.MaxRows
+	}
+	if l.MaxValueSize == 0 {
+		l.MaxValueSize = defaults.MaxValueSize
+	}
+	return l
+}
+
+// validate checks that the limits are usable
+func (l QueryLimits) validate() error {
+	if l.TimeoutMs < 0 || l.MaxRows < 0 || l.MaxValueSize < 0 {
+		return fmt.Errorf("query limits must not be negative")
+	}
+	return nil
+}
+
+// timeout returns the statement timeout as a duration
+func (l QueryLimits) timeout() time.Duration {
+	return time.Duration(l.TimeoutMs) * time.Millisecond
+}
+
+// withTimeout runs fn under the statement timeout of limits. The context
+// deadline covers every driver; PostgreSQL and MySQL also get the timeout as
+// a session setting, so the server stops the statement itself.
+func withTimeout(ctx context.Context, driverName string, q querier, limits QueryLimits, fn func(context.Context) error) error {
+	if limits.TimeoutMs == 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, limits.timeout())
+	defer cancel()
+
+	var set, restore string
+	_, inTx := q.(*sql.Tx)
+	switch {
+	case driverName == DriverPostgres && inTx:
+		set, restore = fmt.Sprintf("SET LOCAL statement_timeout = %d", limits.TimeoutMs), "SET LOCAL statement_timeout TO DEFAULT"
+	case driverName == DriverPostgres:
+		set, restore = fmt.Sprintf("SET statement_timeout = %d", limits.TimeoutMs), "RESET statement_timeout"
+	case driverName == DriverMySQL:
+		// Only SELECT statements honour max_execution_time
+		set, restore = fmt.Sprintf("SET SESSION max_execution_time = %d", limits.TimeoutMs), "SET SESSION max_execution_time = DEFAULT"
+	}
+	if set == "" {
+		return timeoutError(ctx, fn(ctx))
+	}
+
+	if _, err := q.ExecContext(ctx, set); err != nil {
+		return timeoutError(ctx, fmt.Errorf("failed to set statement timeout: %w", err))
+	}
+	fnErr := fn(ctx)
+	if _, err := q.ExecContext(context.Background(), restore); err != nil {
+		// Never hand a session with a changed timeout back to the pool
+		if conn, ok := q.(*sql.Conn); ok {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}
+	return timeoutError(ctx, fnErr)
+}
+
+// timeoutError wraps err in ErrQueryTimeout when the deadline of ctx passed
+// or the server cancelled the statement for running too long
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded),
+		errors.As(err, &pqErr) && pqErr.Code == "57014",      // query_canceled
+		errors.As(err, &mysqlErr) && mysqlErr.Number == 3024: // ER_QUERY_TIMEOUT
+		return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,409 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for unknown connection IDs
+	ErrNotFound = errors.New("connection not found")
+	// ErrInvalidProfile is returned when a connection request is malformed
+	ErrInvalidProfile = errors.New("invalid connection profile")
+	// ErrSecretUnavailable is returned when a referenced secret cannot be read
+	ErrSecretUnavailable = errors.New("secret unavailable")
+	// ErrPoolExhausted is returned when no connection frees up under the
+	// global cap within the acquire timeout
+	ErrPoolExhausted = errors.New("connection limit reached")
+)
+
+// Profile describes a database connection request
+type Profile struct {
+	Name           string      `msgpack:"name"`
+	Driver         string      `msgpack:"driver"`
+	DSN            string      `msgpack:"dsn"`
+	Password       string      `msgpack:"password"`        // Replaces any password in the DSN
+	PasswordSecret string      `msgpack:"password_secret"` // ID of a stored secret used as Password
+	Pool           PoolOptions `msgpack:"pool"`
+	SSH            *SSHOptions `msgpack:"ssh"` // Tunnel through an SSH server
+	TLS            *TLSOptions `msgpack:"tls"`
+	ReadOnly       bool        `msgpack:"read_only"` // Refuse writes and open sessions read-only
+	Limits         QueryLimits `msgpack:"limits"`    // Default timeout and row limit of queries
+}
+
+// Config holds the connection manager configuration
+type Config struct {
+	Logger         logger.Logger
+	Pool           PoolOptions               // Defaults for options not set in a profile
+	MaxConnections int                       // Global cap on physical connections across all pools
+	AcquireTimeout time.Duration             // Longest wait for a free connection under the global cap; 0 for no limit
+	Drivers        map[string]DriverDefaults // Keyed by normalized driver name
+	Health         HealthOptions
+	OnStateChange  func(StateChange)                                    // Called when the monitor sees a connection change state
+	ResolveSecret  func(ctx context.Context, id string) (string, error) // Reads secrets referenced by profiles
+	MaxValueSize   int                                                  // Default for QueryLimits.MaxValueSize; 0 keeps values whole
+	Values         ValueKeeper                                          // Keeps truncated values for fetching; may be nil
+}
+
+// Connection is an open logical connection backed by its own database/sql pool
+type Connection struct {
+	ID          string
+	Name        string
+	Driver      string
+	ConnectedAt time.Time
+	Pool        PoolOptions
+	TLS         TLSInfo // Encryption negotiated when the connection was opened
+	ReadOnly    bool
+	Limits      QueryLimits // Defaults for queries that set no limits
+
+	connector driver.Connector
+	limiter   *slotLimiter
+	writeDSN  string // SQLite DSN without read-only mode, for confirmed writes
+	tunnel    *sshTunnel
+	release   func() // Frees the tunnel and TLS resources
+	closed    chan struct{}
+
+	mu           sync.RWMutex
+	db           *sql.DB // Replaced when the monitor reconnects
+	health       Health
+	reconnecting bool
+
+	confirmations map[string]confirmation // Write confirmation tokens by token
+	txs           map[string]*Transaction // Open transactions by ID
+
+	statements *statementCache // Prepared statements on db
+}
+
+// DB returns the connection pool
+func (c *Connection) DB() *sql.DB {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.db
+}
+
+// close stops monitoring the connection and closes its pool
+func (c *Connection) close() error {
+	c.rollbackAll()
+
+	c.mu.Lock()
+	close(c.closed)
+	db := c.db
+	c.mu.Unlock()
+
+	c.statements.clear()
+	err := db.Close()
+	c.release()
+	return err
+}
+
+// Manager owns all open database connections
+type Manager struct {
+	mu       sync.RWMutex
+	conns    map[string]*Connection
+	limiter  *slotLimiter
+	defaults PoolOptions
+	drivers  map[string]DriverDefaults
+	health   HealthOptions
+	logger   logger.Logger
+
+	maxValueSize int
+	values       ValueKeeper
+
+	onStateChange func(StateChange)
+	resolveSecret func(ctx context.Context, id string) (string, error)
+	stop          chan struct{}
+	stopOnce      sync.Once
+	wg            sync.WaitGroup
+}
+
+// NewManager creates a new connection manager
+func NewManager(config *Config) (*Manager, error) {
+	if config.Logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	if config.MaxConnections < 1 {
+		return nil, fmt.Errorf("max connections must be at least 1")
+	}
+
+	drivers := config.Drivers
+	if drivers == nil {
+		drivers = make(map[string]DriverDefaults)
+	}
+
+	m := &Manager{
+		conns:         make(map[string]*Connection),
+		limiter:       newSlotLimiter(config.MaxConnections, config.AcquireTimeout),
+		defaults:      config.Pool,
+		drivers:       drivers,
+		health:        config.Health.withDefaults(),
+		logger:        config.Logger,
+		onStateChange: config.OnStateChange,
+		resolveSecret: config.ResolveSecret,
+		maxValueSize:  config.MaxValueSize,
+		values:        config.Values,
+		stop:          make(chan struct{}),
+	}
+
+	m.wg.Add(1)
+	go m.monitor()
+
+	return m, nil
+}
+
+// SetPoolDefaults replaces the pool defaults used by new connections
+func (m *Manager) SetPoolDefaults(defaults PoolOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaults = defaults
+}
+
+// SetAcquireTimeout replaces the longest wait for a free connection under
+// the global cap
+func (m *Manager) SetAcquireTimeout(timeout time.Duration) {
+	m.limiter.setTimeout(timeout)
+}
+
+// SetMaxValueSize replaces the size above which values are truncated in
+// queries that set no max_value_size
+func (m *Manager) SetMaxValueSize(size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxValueSize = size
+}
+
+// SetDriverDefaults replaces the driver defaults used by new connections
+func (m *Manager) SetDriverDefaults(drivers map[string]DriverDefaults) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drivers = drivers
+}
+
+// Connect opens a new logical connection and verifies it with a ping
+func (m *Manager) Connect(ctx context.Context, profile Profile) (*Connection, error) {
+	var err error
+	if profile, err = profile.NormalizeConnection(); err != nil {
+		return nil, err
+	}
+	driverName := profile.Driver
+	if profile.DSN == "" {
+		return nil, fmt.Errorf("%w: dsn is required", ErrInvalidProfile)
+	}
+	if profile, err = m.resolveSecrets(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	pool := profile.Pool.withDefaults(m.defaults)
+	defaults := m.drivers[driverName]
+	m.mu.RUnlock()
+
+	if err := pool.validate(m.limiter.Max()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+
+	var tunnel *sshTunnel
+	if profile.SSH != nil {
+		tunnel, err = newSSHTunnel(*profile.SSH, time.Duration(defaults.ConnectTimeout)*time.Millisecond)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+
+	id, err := ids.New("conn_")
+	if err != nil {
+		return nil, err
+	}
+	dsn := applyDefaultParams(driverName, profile.DSN, defaults.Params)
+	if profile.Password != "" {
+		if dsn, err = setDSNPassword(driverName, dsn, profile.Password); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+
+	var tlsConf *tlsMaterial
+	var tlsName string
+	if profile.TLS != nil {
+		if tlsConf, err = loadTLS(*profile.TLS); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+		if driverName == DriverMySQL {
+			tlsName = "litebase_" + id
+		}
+		if dsn, err = applyTLS(driverName, dsn, tlsConf, tlsName); err != nil {
+			tlsConf.cleanup()
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+
+	// Frees the setup above when the connection fails or is closed
+	cleanup := func() {
+		if tunnel != nil {
+			tunnel.Close()
+		}
+		if tlsConf != nil {
+			tlsConf.cleanup()
+		}
+		if tlsName != "" {
+			mysql.DeregisterTLSConfig(tlsName)
+		}
+	}
+
+	var writeDSN string
+	if profile.ReadOnly {
+		if driverName == DriverSQLite {
+			writeDSN = dsn
+		}
+		dsn = readOnlyDSN(driverName, dsn)
+	}
+
+	connector, err := openConnector(driverName, dsn, tunnel)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("%w: invalid dsn: %v", ErrInvalidProfile, err)
+	}
+	if profile.ReadOnly && driverName == DriverMySQL {
+		connector = &readOnlyConnector{base: connector, statements: []string{mysqlReadOnly}}
+	}
+	if driverName == DriverPostgres && tlsConf != nil && tlsConf.minVersion != 0 {
+		// MySQL enforces the minimum through its registered tls.Config
+		connector = &postgresTLSConnector{base: connector, tls: tlsConf}
+	}
+
+	limited := &limitedConnector{base: connector, limiter: m.limiter}
+	db := sql.OpenDB(limited)
+	pool.apply(db)
+
+	if defaults.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(defaults.ConnectTimeout)*time.Millisecond)
+		defer cancel()
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		cleanup()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	tlsInfo, err := queryTLSInfo(ctx, db, driverName)
+	if err != nil {
+		m.logger.Debug("Could not determine TLS state", zap.String("connection_id", id), zap.Error(err))
+	}
+	if tlsConf != nil {
+		if err := tlsConf.checkMinVersion(tlsInfo); err != nil {
+			db.Close()
+			cleanup()
+			return nil, fmt.Errorf("failed to connect: %w", err)
+		}
+	}
+
+	now := time.Now()
+	conn := &Connection{
+		ID:          id,
+		Name:        profile.Name,
+		Driver:      driverName,
+		ConnectedAt: now,
+		Pool:        pool,
+		TLS:         tlsInfo,
+		ReadOnly:    profile.ReadOnly,
+		Limits:      profile.Limits,
+		connector:   limited,
+		limiter:     m.limiter,
+		writeDSN:    writeDSN,
+		tunnel:      tunnel,
+		release:     cleanup,
+		closed:      make(chan struct{}),
+		db:          db,
+		health:      Health{State: StateConnected, Since: now, LastCheck: now},
+		statements:  newStatementCache(max(pool.StatementCache, 0)),
+	}
+
+	m.mu.Lock()
+	m.conns[conn.ID] = conn
+	m.mu.Unlock()
+
+	m.logger.Info("Database connection opened",
+		zap.String("connection_id", conn.ID),
+		zap.String("driver", driverName),
+		zap.String("name", profile.Name),
+		zap.String("target", RedactDSN(driverName, profile.DSN)),
+		zap.Int("max_open", pool.MaxOpen),
+		zap.Bool("ssh", tunnel != nil),
+		zap.String("tls", tlsInfo.Version),
+		zap.Bool("read_only", profile.ReadOnly),
+	)
+
+	return conn, nil
+}
+
+// Get returns an open connection by ID
+func (m *Manager) Get(id string) (*Connection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	conn, ok := m.conns[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return conn, nil
+}
+
+// List returns all open connections ordered by connection time
+func (m *Manager) List() []*Connection {
+	m.mu.RLock()
+	conns := make([]*Connection, 0, len(m.conns))
+	for _, conn := range m.conns {
+		conns = append(conns, conn)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ConnectedAt.Before(conns[j].ConnectedAt)
+	})
+	return conns
+}
+
+// Disconnect closes a connection and its pool
+func (m *Manager) Disconnect(id string) error {
+	m.mu.Lock()
+	conn, ok := m.conns[id]
+	delete(m.conns, id)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	m.logger.Info("Database connection closed", zap.String("connection_id", id))
+	return conn.close()
+}
+
+// Close stops the monitor and closes every open connection
+func (m *Manager) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	m.mu.Lock()
+	conns := m.conns
+	m.conns = make(map[string]*Connection)
+	m.mu.Unlock()
+
+	var errs []error
+	for id, conn := range conns {
+		if err := conn.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", id, err))
+		}
+	}
+	m.wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,524 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/sqlparse"
+
+	"github.com/lib/pq"
+)
+
+// Parameter types accepted in Param.Type
+const (
+	ParamNull      = "null"
+	ParamString    = "string"
+	ParamInt       = "int"
+	ParamFloat     = "float"
+	ParamDecimal   = "decimal"
+	ParamBool      = "bool"
+	ParamTimestamp = "timestamp"
+	ParamDate      = "date"
+	ParamTime      = "time"
+	ParamUUID      = "uuid"
+	ParamBytes     = "bytes"
+	ParamJSON      = "json"
+	ParamArray     = "array"
+)
+
+// paramTypeAliases maps accepted spellings to parameter types
+var paramTypeAliases = map[string]string{
+	"text": ParamString, "varchar": ParamString,
+	"integer": ParamInt, "bigint": ParamInt, "int64": ParamInt,
+	"double": ParamFloat, "real": ParamFloat, "float64": ParamFloat,
+	"numeric":     ParamDecimal,
+	"boolean":     ParamBool,
+	"timestamptz": ParamTimestamp, "datetime": ParamTimestamp,
+	"bytea": ParamBytes, "blob": ParamBytes, "binary": ParamBytes,
+	"jsonb": ParamJSON,
+}
+
+var (
+	decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+	uuidPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+)
+
+// timestampLayouts are the accepted string forms of timestamps
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05Z07:00"}
+
+// Param is a typed bind value. Positional parameters have no Name.
+type Param struct {
+	Name        string      `msgpack:"name"`
+	Type        string      `msgpack:"type"` // Inferred from Value when empty
+	Value       interface{} `msgpack:"value"`
+	ElementType string      `msgpack:"element_type"` // Type of array elements; inferred when empty
+}
+
+// ParamError collects every parameter that could not be bound
+type ParamError struct {
+	Fields []FieldError
+}
+
+// Error lists every invalid parameter
+func (e *ParamError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid query parameters: " + strings.Join(parts, "; ")
+}
+
+// Unwrap makes parameter errors match ErrInvalidQuery
+func (e *ParamError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// add records a problem with field
+func (e *ParamError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// orNil returns nil when no problems were recorded
+func (e *ParamError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// field names a parameter in error messages
+func (p Param) field(index int) string {
+	if p.Name != "" {
+		return "params." + p.Name
+	}
+	return fmt.Sprintf("params[%d]", index)
+}
+
+// bindParams rewrites the placeholders of query into the driver's style and
+// converts params to driver values. Queries may use ?, $N and ?N for
+// positional parameters and :name, @name or $name for named ones. Without
+// params the query is returned untouched.
+func bindParams(driverName, query string, params []Param) (string, []interface{}, error) {
+	if len(params) == 0 {
+		return query, nil, nil
+	}
+
+	var errs ParamError
+	values := make([]interface{}, len(params))
+	named := make(map[string]int)
+	namedCount := 0
+	duplicate := make([]bool, len(params))
+	for i, p := range params {
+		if p.Name != "" {
+			namedCount++
+			name := strings.TrimLeft(p.Name, ":@$")
+			if _, dup := named[name]; dup {
+				errs.add(p.field(i), "is given more than once")
+				duplicate[i] = true
+			} else {
+				named[name] = i
+			}
+		}
+		v, err := convertParam(driverName, p)
+		if err != nil {
+			errs.add(p.field(i), "%v", err)
+		}
+		values[i] = v
+	}
+	if namedCount > 0 && namedCount != len(params) {
+		errs.add("params", "mixes positional and named parameters")
+		return "", nil, errs.orNil()
+	}
+
+	// Map every placeholder to the index of its parameter
+	placeholders := sqlparse.Placeholders(query, sqlparse.Dialect(driverName))
+	// ? is the jsonb key operator once $N placeholders are in use, even
+	// before the first of them
+	operators := false
+	for _, ph := range placeholders {
+		operators = operators || (driverName == DriverPostgres && ph.Position > 0)
+	}
+	refs := make([]int, 0, len(placeholders))
+	used := make([]bool, len(params))
+	var kept []sqlparse.Placeholder
+	bare, numbered := 0, false
+	for _, ph := range placeholders {
+		index := -1
+		switch {
+		case len(named) > 0:
+			i, ok := named[ph.Name]
+			if !ok {
+				// Not ours, e.g. an array slice bound or a PostgreSQL ? operator
+				continue
+			}
+			index = i
+		case ph.Name != "":
+			continue
+		case ph.Position > 0:
+			numbered = true
+			index = ph.Position - 1
+		case operators:
+			continue
+		default:
+			index = bare
+			bare++
+		}
+		if bare > 0 && numbered {
+			errs.add("sql", "mixes ? with numbered placeholders")
+			return "", nil, errs.orNil()
+		}
+		if index >= len(params) {
+			errs.add("params", "the query references parameter %d but %d were given", index+1, len(params))
+			continue
+		}
+		used[index] = true
+		refs = append(refs, index)
+		kept = append(kept, ph)
+	}
+	for i, ok := range used {
+		if !ok && !duplicate[i] {
+			errs.add(params[i].field(i), "is not used in the query")
+		}
+	}
+	if err := errs.orNil(); err != nil {
+		return "", nil, err
+	}
+
+	// Rewrite into the driver's placeholder style
+	var b strings.Builder
+	var args []interface{}
+	last := 0
+	for i, ph := range kept {
+		b.WriteString(query[last:ph.Start])
+		switch driverName {
+		case DriverMySQL:
+			b.WriteString("?")
+			args = append(args, values[refs[i]])
+		case DriverSQLite:
+			b.WriteString("?" + strconv.Itoa(refs[i]+1))
+		default:
+			b.WriteString("$" + strconv.Itoa(refs[i]+1))
+		}
+		last = ph.End
+	}
+	b.WriteString(query[last:])
+	if driverName != DriverMySQL {
+		args = values
+	}
+	return b.String(), args, nil
+}
+
+// convertParam checks a parameter against its type and returns the driver value
+func convertParam(driverName string, p Param) (interface{}, error) {
+	typ := strings.ToLower(strings.TrimSpace(p.Type))
+	if alias, ok := paramTypeAliases[typ]; ok {
+		typ = alias
+	}
+	if typ == "" {
+		typ = inferParamType(p.Value)
+	}
+	if p.Value == nil {
+		if !knownParamType(typ) {
+			return nil, fmt.Errorf("unknown type %q", p.Type)
+		}
+		return nil, nil
+	}
+
+	switch typ {
+	case ParamNull:
+		return nil, fmt.Errorf("null parameters cannot have a value")
+	case ParamString:
+		if s, ok := p.Value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected a string, got %s", describeValue(p.Value))
+	case ParamInt:
+		return toInt(p.Value)
+	case ParamFloat:
+		return toFloat(p.Value)
+	case ParamDecimal:
+		return toDecimal(p.Value)
+	case ParamBool:
+		return toBool(p.Value)
+	case ParamTimestamp:
+		return toTimestamp(p.Value)
+	case ParamDate:
+		return toLayout(p.Value, "2006-01-02", "a date (YYYY-MM-DD)")
+	case ParamTime:
+		return toLayout(p.Value, "15:04:05.999999999", "a time (HH:MM:SS)")
+	case ParamUUID:
+		return toUUID(p.Value)
+	case ParamBytes:
+		return toBytes(p.Value)
+	case ParamJSON:
+		return toJSON(p.Value)
+	case ParamArray:
+		return toArray(driverName, p)
+	default:
+		return nil, fmt.Errorf("unknown type %q", p.Type)
+	}
+}
+
+// knownParamType reports whether typ is a parameter type
+func knownParamType(typ string) bool {
+	switch typ {
+	case ParamNull, ParamString, ParamInt, ParamFloat, ParamDecimal, ParamBool, ParamTimestamp,
+		ParamDate, ParamTime, ParamUUID, ParamBytes, ParamJSON, ParamArray:
+		return true
+	}
+	return false
+}
+
+// inferParamType picks a type for an untyped value
+func inferParamType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ParamNull
+	case string:
+		return ParamString
+	case bool:
+		return ParamBool
+	case float32, float64:
+		return ParamFloat
+	case time.Time:
+		return ParamTimestamp
+	case []byte:
+		return ParamBytes
+	case []interface{}:
+		return ParamArray
+	case map[string]interface{}:
+		return ParamJSON
+	}
+	if isInteger(v) {
+		return ParamInt
+	}
+	return ""
+}
+
+// isInteger reports whether v holds any Go integer type
+func isInteger(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// describeValue names the kind of a value for error messages
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	case []byte:
+		return "bytes"
+	}
+	if isInteger(v) {
+		return "an integer"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// toInt converts integers, integral floats and numeric strings to int64
+func toInt(v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d is out of range for a 64-bit integer", rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f), nil
+		}
+		return nil, fmt.Errorf("%v is not an integer", v)
+	case reflect.String:
+		n, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", rv.String())
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("expected an integer, got %s", describeValue(v))
+}
+
+// toFloat converts numbers and numeric strings to float64
+func toFloat(v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64:
+		return rv.Float(), nil
+	case isInteger(v):
+		n, _ := toInt(v)
+		if n, ok := n.(int64); ok {
+			return float64(n), nil
+		}
+	case rv.Kind() == reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", rv.String())
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("expected a number, got %s", describeValue(v))
+}
+
+// toDecimal keeps decimals as strings so no precision is lost
+func toDecimal(v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if !decimalPattern.MatchString(s) {
+			return nil, fmt.Errorf("%q is not a decimal number", s)
+		}
+		return s, nil
+	}
+	if isInteger(v) {
+		return toInt(v)
+	}
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return nil, fmt.Errorf("expected a decimal string or number, got %s", describeValue(v))
+}
+
+// toBool converts booleans and "true"/"false" strings
+func toBool(v interface{}) (interface{}, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", b)
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("expected a boolean, got %s", describeValue(v))
+}
+
+// toTimestamp converts msgpack timestamps and RFC 3339 strings
+func toTimestamp(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range timestampLayouts {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not an RFC 3339 timestamp", t)
+	}
+	return nil, fmt.Errorf("expected a timestamp, got %s", describeValue(v))
+}
+
+// toLayout validates a date or time string against layout and passes it on as text
+func toLayout(v interface{}, layout, what string) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		if t, isTime := v.(time.Time); isTime {
+			return t.Format(strings.TrimSuffix(layout, ".999999999")), nil
+		}
+		return nil, fmt.Errorf("expected %s, got %s", what, describeValue(v))
+	}
+	s = strings.TrimSpace(s)
+	if _, err := time.Parse(layout, s); err != nil {
+		return nil, fmt.Errorf("%q is not %s", s, what)
+	}
+	return s, nil
+}
+
+// toUUID validates a UUID string or 16 bytes and returns the canonical form
+func toUUID(v interface{}) (interface{}, error) {
+	var digits string
+	switch u := v.(type) {
+	case string:
+		s := strings.Trim(strings.TrimSpace(u), "{}")
+		if !uuidPattern.MatchString(s) {
+			return nil, fmt.Errorf("%q is not a UUID", u)
+		}
+		digits = strings.ToLower(strings.ReplaceAll(s, "-", ""))
+	case []byte:
+		if len(u) != 16 {
+			return nil, fmt.Errorf("a binary UUID must be 16 bytes, got %d", len(u))
+		}
+		digits = hex.EncodeToString(u)
+	default:
+		return nil, fmt.Errorf("expected a UUID string, got %s", describeValue(v))
+	}
+	return digits[0:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:], nil
+}
+
+// toBytes accepts binary values and base64 strings
+func toBytes(v interface{}) (interface{}, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(b)
+		if err != nil {
+			return nil, fmt.Errorf("expected base64-encoded bytes: %v", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("expected bytes or a base64 string, got %s", describeValue(v))
+}
+
+// toJSON encodes a value as JSON text; strings must already be valid JSON
+func toJSON(v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("string is not valid JSON")
+		}
+		return s, nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode value as JSON: %v", err)
+	}
+	return string(encoded), nil
+}
+
+// toArray converts every element and wraps them as a PostgreSQL array
+func toArray(driverName string, p Param) (interface{}, error) {
+	items, ok := p.Value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %s", describeValue(p.Value))
+	}
+	if driverName != DriverPostgres {
+		return nil, fmt.Errorf("%s has no array parameters; use json instead", driverName)
+	}
+	if p.ElementType == ParamArray {
+		return nil, fmt.Errorf("nested arrays are not supported")
+	}
+
+	elems := make([]interface{}, len(items))
+	for i, item := range items {
+		v, err := convertParam(driverName, Param{Type: p.ElementType, Value: item})
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339Nano)
+		}
+		elems[i] = v
+	}
+	return pq.GenericArray{A: elems}, nil
+}
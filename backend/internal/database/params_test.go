@@ -0,0 +1,260 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestBindParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		query  string
+		params []Param
+		want   string
+		args   []interface{}
+	}{
+		{
+			name:   "no params",
+			driver: DriverPostgres,
+			query:  "SELECT ':x', ?",
+			want:   "SELECT ':x', ?",
+		},
+		{
+			name:   "positional question marks",
+			driver: DriverPostgres,
+			query:  "SELECT * FROM t WHERE a = ? AND b = ?",
+			params: []Param{{Value: int64(1)}, {Value: "x"}},
+			want:   "SELECT * FROM t WHERE a = $1 AND b = $2",
+			args:   []interface{}{int64(1), "x"},
+		},
+		{
+			name:   "cast next to a named parameter",
+			driver: DriverPostgres,
+			query:  "SELECT :id::int, created::date FROM t",
+			params: []Param{{Name: "id", Value: "7"}},
+			want:   "SELECT $1::int, created::date FROM t",
+			args:   []interface{}{"7"},
+		},
+		{
+			name:   "jsonb ? operator alongside numbered placeholders",
+			driver: DriverPostgres,
+			query:  "SELECT * FROM t WHERE doc ? 'key' AND id = $1",
+			params: []Param{{Value: int64(3)}},
+			want:   "SELECT * FROM t WHERE doc ? 'key' AND id = $1",
+			args:   []interface{}{int64(3)},
+		},
+		{
+			name:   "named parameter used twice",
+			driver: DriverPostgres,
+			query:  "SELECT * FROM t WHERE a = :v OR b = :v",
+			params: []Param{{Name: "v", Value: int64(5)}},
+			want:   "SELECT * FROM t WHERE a = $1 OR b = $1",
+			args:   []interface{}{int64(5)},
+		},
+		{
+			name:   "placeholders inside strings and comments",
+			driver: DriverPostgres,
+			query:  "SELECT ':v', \"?\" -- :v ?\nFROM t WHERE a = :v",
+			params: []Param{{Name: "v", Value: int64(5)}},
+			want:   "SELECT ':v', \"?\" -- :v ?\nFROM t WHERE a = $1",
+			args:   []interface{}{int64(5)},
+		},
+		{
+			name:   "mysql reorders named parameters",
+			driver: DriverMySQL,
+			query:  "SELECT * FROM t WHERE b = :b AND a = :a AND c = :b AND d = @b",
+			params: []Param{{Name: "a", Value: int64(1)}, {Name: "b", Value: "two"}},
+			want:   "SELECT * FROM t WHERE b = ? AND a = ? AND c = ? AND d = @b",
+			args:   []interface{}{"two", int64(1), "two"},
+		},
+		{
+			name:   "sqlite numbered",
+			driver: DriverSQLite,
+			query:  "SELECT ?2, ?1",
+			params: []Param{{Value: int64(1)}, {Value: int64(2)}},
+			want:   "SELECT ?2, ?1",
+			args:   []interface{}{int64(1), int64(2)},
+		},
+		{
+			name:   "sqlite named with a dollar sign",
+			driver: DriverSQLite,
+			query:  "SELECT $a, $b",
+			params: []Param{{Name: "$b", Value: int64(2)}, {Name: "a", Value: int64(1)}},
+			want:   "SELECT ?2, ?1",
+			args:   []interface{}{int64(2), int64(1)},
+		},
+		{
+			name:   "array and uuid",
+			driver: DriverPostgres,
+			query:  "SELECT * FROM t WHERE id = ANY(:ids) AND owner = :owner",
+			params: []Param{
+				{Name: "ids", Type: "array", ElementType: "int", Value: []interface{}{int64(1), "2"}},
+				{Name: "owner", Type: "uuid", Value: "{123E4567E89B12D3A456426614174000}"},
+			},
+			want: "SELECT * FROM t WHERE id = ANY($1) AND owner = $2",
+			args: []interface{}{
+				pq.GenericArray{A: []interface{}{int64(1), int64(2)}},
+				"123e4567-e89b-12d3-a456-426614174000",
+			},
+		},
+		{
+			name:   "array of timestamps",
+			driver: DriverPostgres,
+			query:  "SELECT ?",
+			params: []Param{{Type: "array", ElementType: "timestamp", Value: []interface{}{"2024-01-02T03:04:05Z"}}},
+			want:   "SELECT $1",
+			args:   []interface{}{pq.GenericArray{A: []interface{}{"2024-01-02T03:04:05Z"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := bindParams(tt.driver, tt.query, tt.params)
+			if err != nil {
+				t.Fatalf("bindParams: %v", err)
+			}
+			if query != tt.want {
+				t.Errorf("query = %q, want %q", query, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestBindParamsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		query  string
+		params []Param
+		fields []string
+	}{
+		{
+			name:   "mixed positional and named",
+			driver: DriverPostgres,
+			query:  "SELECT ?, :b",
+			params: []Param{{Value: int64(1)}, {Name: "b", Value: int64(2)}},
+			fields: []string{"params"},
+		},
+		{
+			name:   "question marks mixed with numbers",
+			driver: DriverSQLite,
+			query:  "SELECT ?1, ?",
+			params: []Param{{Value: int64(1)}},
+			fields: []string{"sql"},
+		},
+		{
+			name:   "unused positional",
+			driver: DriverPostgres,
+			query:  "SELECT $1",
+			params: []Param{{Value: int64(1)}, {Value: int64(2)}},
+			fields: []string{"params[1]"},
+		},
+		{
+			name:   "unused named",
+			driver: DriverMySQL,
+			query:  "SELECT :a",
+			params: []Param{{Name: "a", Value: int64(1)}, {Name: "extra", Value: int64(2)}},
+			fields: []string{"params.extra"},
+		},
+		{
+			name:   "out of range",
+			driver: DriverPostgres,
+			query:  "SELECT $1, $3",
+			params: []Param{{Value: int64(1)}},
+			fields: []string{"params"},
+		},
+		{
+			name:   "named given twice",
+			driver: DriverPostgres,
+			query:  "SELECT :a",
+			params: []Param{{Name: "a", Value: int64(1)}, {Name: ":a", Value: int64(2)}},
+			fields: []string{"params.:a"},
+		},
+		{
+			name:   "values that do not match their type",
+			driver: DriverPostgres,
+			query:  "SELECT ?, ?, ?",
+			params: []Param{{Type: "int", Value: "x"}, {Type: "uuid", Value: "nope"}, {Type: "date", Value: "2024-13-01"}},
+			fields: []string{"params[0]", "params[1]", "params[2]"},
+		},
+		{
+			name:   "bad array element",
+			driver: DriverPostgres,
+			query:  "SELECT :ids",
+			params: []Param{{Name: "ids", Type: "array", ElementType: "int", Value: []interface{}{int64(1), "x"}}},
+			fields: []string{"params.ids"},
+		},
+		{
+			name:   "arrays outside postgres",
+			driver: DriverMySQL,
+			query:  "SELECT ?",
+			params: []Param{{Value: []interface{}{int64(1)}}},
+			fields: []string{"params[0]"},
+		},
+		{
+			name:   "unknown type",
+			driver: DriverPostgres,
+			query:  "SELECT ?",
+			params: []Param{{Type: "money", Value: nil}},
+			fields: []string{"params[0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := bindParams(tt.driver, tt.query, tt.params)
+			var paramErr *ParamError
+			if !errors.As(err, &paramErr) {
+				t.Fatalf("error = %v, want a ParamError", err)
+			}
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("error does not match ErrInvalidQuery")
+			}
+			var fields []string
+			for _, f := range paramErr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("fields = %v, want %v (%v)", fields, tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestConvertParam(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		param Param
+		want  interface{}
+	}{
+		{Param{Value: uint8(7)}, int64(7)},
+		{Param{Type: "bigint", Value: 3.0}, int64(3)},
+		{Param{Type: "float", Value: "1.5"}, 1.5},
+		{Param{Type: "decimal", Value: "-12.50"}, "-12.50"},
+		{Param{Type: "numeric", Value: 0.1}, "0.1"},
+		{Param{Type: "bool", Value: "true"}, true},
+		{Param{Type: "timestamp", Value: "2024-01-02 03:04:05"}, ts},
+		{Param{Type: "date", Value: ts}, "2024-01-02"},
+		{Param{Type: "time", Value: "10:30:00"}, "10:30:00"},
+		{Param{Type: "uuid", Value: []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}}, "123e4567-e89b-12d3-a456-426614174000"},
+		{Param{Type: "bytes", Value: "AQI="}, []byte{1, 2}},
+		{Param{Type: "json", Value: map[string]interface{}{"a": int64(1)}}, `{"a":1}`},
+		{Param{Type: "string", Value: nil}, nil},
+	}
+	for _, tt := range tests {
+		got, err := convertParam(DriverPostgres, tt.param)
+		if err != nil {
+			t.Errorf("convertParam(%+v): %v", tt.param, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("convertParam(%+v) = %#v, want %#v", tt.param, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePostgresArray reads the text form of a PostgreSQL array, such as
+// {1,NULL,"a b"} or {{1,2},{3,4}}. Elements are strings, nil for NULL, or
+// nested slices for further dimensions.
+func parsePostgresArray(s string) ([]interface{}, bool) {
+	// Arrays with other lower bounds start with their dimensions: [0:1]={1,2}
+	if strings.HasPrefix(s, "[") {
+		_, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, false
+		}
+		s = rest
+	}
+	p := arrayParser{s: s}
+	elements, ok := p.array()
+	if !ok || p.i != len(p.s) {
+		return nil, false
+	}
+	return elements, true
+}
+
+// arrayParser walks the text of an array
+type arrayParser struct {
+	s string
+	i int
+}
+
+// array reads "{...}" at the current position
+func (p *arrayParser) array() ([]interface{}, bool) {
+	if p.i >= len(p.s) || p.s[p.i] != '{' {
+		return nil, false
+	}
+	p.i++
+	elements := []interface{}{}
+	if p.i < len(p.s) && p.s[p.i] == '}' {
+		p.i++
+		return elements, true
+	}
+	for {
+		element, ok := p.element()
+		if !ok {
+			return nil, false
+		}
+		elements = append(elements, element)
+		if p.i >= len(p.s) {
+			return nil, false
+		}
+		switch p.s[p.i] {
+		case ',':
+			p.i++
+		case '}':
+			p.i++
+			return elements, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// element reads a nested array, a quoted string or an unquoted value
+func (p *arrayParser) element() (interface{}, bool) {
+	if p.i >= len(p.s) {
+		return nil, false
+	}
+	switch p.s[p.i] {
+	case '{':
+		return p.array()
+	case '"':
+		var b strings.Builder
+		for p.i++; p.i < len(p.s); p.i++ {
+			switch c := p.s[p.i]; c {
+			case '\\':
+				p.i++
+				if p.i < len(p.s) {
+					b.WriteByte(p.s[p.i])
+				}
+			case '"':
+				p.i++
+				return b.String(), true
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, false
+	}
+	start := p.i
+	for p.i < len(p.s) && p.s[p.i] != ',' && p.s[p.i] != '}' {
+		p.i++
+	}
+	text := strings.TrimSpace(p.s[start:p.i])
+	if strings.EqualFold(text, "NULL") {
+		return nil, true
+	}
+	return text, true
+}
+
+// parsePostgresInterval reads an interval in PostgreSQL's default output
+// style, such as "1 year 2 mons -3 days 04:05:06.5"
+func parsePostgresInterval(s string) (Interval, bool) {
+	out := Interval{Type: KindInterval, Value: s}
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if strings.Contains(field, ":") {
+			us, ok := parseClock(field)
+			if !ok {
+				return Interval{}, false
+			}
+			out.Microseconds += us
+			continue
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || i+1 == len(fields) {
+			return Interval{}, false
+		}
+		i++
+		switch strings.TrimSuffix(fields[i], "s") {
+		case "year":
+			out.Months += n * 12
+		case "mon":
+			out.Months += n
+		case "day":
+			out.Days += n
+		default:
+			return Interval{}, false
+		}
+	}
+	return out, true
+}
+
+// parseClock reads [-]hh:mm:ss[.ffffff] as microseconds
+func parseClock(s string) (int64, bool) {
+	sign := int64(1)
+	switch s[0] {
+	case '-':
+		sign, s = -1, s[1:]
+	case '+':
+		s = s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	// Seconds are read as whole and fractional parts, so the fraction stays exact
+	whole, frac, _ := strings.Cut(parts[2], ".")
+	hours, err1 := strconv.ParseInt(parts[0], 10, 64)
+	minutes, err2 := strconv.ParseInt(parts[1], 10, 64)
+	seconds, err3 := strconv.ParseInt(whole, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || len(frac) > 6 {
+		return 0, false
+	}
+	var micros int64
+	if frac != "" {
+		var err error
+		if micros, err = strconv.ParseInt((frac + "00000")[:6], 10, 64); err != nil {
+			return 0, false
+		}
+	}
+	us := (time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second).Microseconds() + micros
+	return sign * us, true
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NoIdleConnections is the MaxIdle value that keeps no idle connections,
+// since zero falls back to the default
+const NoIdleConnections = -1
+
+// NoStatementCache is the StatementCache value that disables prepared
+// statements, since zero falls back to the default
+const NoStatementCache = -1
+
+// PoolOptions tunes the database/sql pool of a connection.
+// Zero values fall back to the configured defaults.
+type PoolOptions struct {
+	MaxOpen       int   `msgpack:"max_open"`
+	MaxIdle       int   `msgpack:"max_idle"` // NoIdleConnections for none
+	IdleTimeoutMs int64 `msgpack:"idle_timeout_ms"`
+	MaxLifetimeMs int64 `msgpack:"max_lifetime_ms"`
+	// Prepared statements kept per connection before the least recently
+	// used is dropped; NoStatementCache for none
+	StatementCache int `msgpack:"statement_cache"`
+}
+
+// PoolStats exposes sql.DBStats for a connection
+type PoolStats struct {
+	MaxOpen           int   `msgpack:"max_open"`
+	Open              int   `msgpack:"open"`
+	InUse             int   `msgpack:"in_use"`
+	Idle              int   `msgpack:"idle"`
+	WaitCount         int64 `msgpack:"wait_count"`
+	WaitDurationMs    int64 `msgpack:"wait_duration_ms"`
+	MaxIdleClosed     int64 `msgpack:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `msgpack:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `msgpack:"max_lifetime_closed"`
+}
+
+// ConnectionStats describes a connection and its pool
+type ConnectionStats struct {
+	ConnectionID string              `msgpack:"connection_id"`
+	Name         string              `msgpack:"name"`
+	Driver       string              `msgpack:"driver"`
+	ConnectedAt  time.Time           `msgpack:"connected_at"`
+	Pool         PoolOptions         `msgpack:"pool"`
+	Tunnel       string              `msgpack:"tunnel,omitempty"` // SSH tunnel host, if any
+	TLS          TLSInfo             `msgpack:"tls"`
+	ReadOnly     bool                `msgpack:"read_only"`
+	Limits       QueryLimits         `msgpack:"limits"`       // Default query limits
+	Transactions []TransactionInfo   `msgpack:"transactions"` // Open transactions
+	Stats        PoolStats           `msgpack:"stats"`
+	Statements   StatementCacheStats `msgpack:"statements"` // Prepared statement cache
+	Health       Health              `msgpack:"health"`
+}
+
+// Summary aggregates pool usage across all connections
+type Summary struct {
+	Connections     int           `msgpack:"connections"`      // Logical connections
+	OpenConnections int           `msgpack:"open_connections"` // Physical connections across all pools
+	MaxConnections  int           `msgpack:"max_connections"`  // Global cap on physical connections
+	States          map[State]int `msgpack:"states"`           // Connections by health state
+}
+
+// withDefaults fills unset options from defaults
+func (o PoolOptions) withDefaults(defaults PoolOptions) PoolOptions {
+	if o.MaxOpen == 0 {
+		o.MaxOpen = defaults.MaxOpen
+	}
+	if o.MaxIdle == 0 {
+		o.MaxIdle = defaults.MaxIdle
+	}
+	if o.IdleTimeoutMs == 0 {
+		o.IdleTimeoutMs = defaults.IdleTimeoutMs
+	}
+	if o.MaxLifetimeMs == 0 {
+		o.MaxLifetimeMs = defaults.MaxLifetimeMs
+	}
+	if o.StatementCache == 0 {
+		o.StatementCache = defaults.StatementCache
+	}
+	if o.StatementCache == 0 {
+		o.StatementCache = DefaultStatementCache
+	}
+	return o
+}
+
+// validate checks the options against the global connection cap
+func (o PoolOptions) validate(maxConnections int) error {
+	switch {
+	case o.MaxIdle < NoIdleConnections:
+		return fmt.Errorf("pool max_idle must be %d for no idle connections or not negative", NoIdleConnections)
+	case o.StatementCache < NoStatementCache:
+		return fmt.Errorf("pool statement_cache must be %d to disable prepared statements or not negative", NoStatementCache)
+	case o.MaxOpen < 0, o.IdleTimeoutMs < 0, o.MaxLifetimeMs < 0:
+		return fmt.Errorf("pool options must not be negative")
+	case o.MaxOpen > maxConnections:
+		return fmt.Errorf("pool max_open %d exceeds the global limit of %d connections", o.MaxOpen, maxConnections)
+	case o.MaxOpen > 0 && o.MaxIdle > o.MaxOpen:
+		return fmt.Errorf("pool max_idle %d exceeds max_open %d", o.MaxIdle, o.MaxOpen)
+	}
+	return nil
+}
+
+// apply configures db with the options
+func (o PoolOptions) apply(db *sql.DB) {
+	db.SetMaxOpenConns(o.MaxOpen)
+	db.SetMaxIdleConns(max(o.MaxIdle, 0))
+	db.SetConnMaxIdleTime(time.Duration(o.IdleTimeoutMs) * time.Millisecond)
+	db.SetConnMaxLifetime(time.Duration(o.MaxLifetimeMs) * time.Millisecond)
+}
+
+// Stats returns pool statistics for the connection
+func (c *Connection) Stats() ConnectionStats {
+	s := c.DB().Stats()
+	var tunnel string
+	if c.tunnel != nil {
+		tunnel = c.tunnel.String()
+	}
+	return ConnectionStats{
+		ConnectionID: c.ID,
+		Name:         c.Name,
+		Driver:       c.Driver,
+		ConnectedAt:  c.ConnectedAt,
+		Pool:         c.Pool,
+		Tunnel:       tunnel,
+		TLS:          c.TLS,
+		ReadOnly:     c.ReadOnly,
+		Limits:       c.Limits,
+		Transactions: c.Transactions(),
+		Stats: PoolStats{
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitDurationMs:    s.WaitDuration.Milliseconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		},
+		Statements: c.statements.snapshot(),
+		Health:     c.Health(),
+	}
+}
+
+// Stats returns pool statistics for every open connection
+func (m *Manager) Stats() []ConnectionStats {
+	conns := m.List()
+	stats := make([]ConnectionStats, 0, len(conns))
+	for _, conn := range conns {
+		stats = append(stats, conn.Stats())
+	}
+	return stats
+}
+
+// Summary returns pool usage across all connections
+func (m *Manager) Summary() Summary {
+	m.mu.RLock()
+	count := len(m.conns)
+	m.mu.RUnlock()
+
+	return Summary{
+		Connections:     count,
+		OpenConnections: m.limiter.Open(),
+		MaxConnections:  m.limiter.Max(),
+		States:          m.States(),
+	}
+}
@@ -0,0 +1,486 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"litebase-backend/internal/sqlparse"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidQuery is returned for empty or malformed query requests
+var ErrInvalidQuery = errors.New("invalid query")
+
+// querier is implemented by *sql.DB, *sql.Conn and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// QueryOptions controls a query execution
+type QueryOptions struct {
+	ConfirmationToken string      // Allows one refused write on a read-only connection
+	TransactionID     string      // Runs the query in an open transaction
+	Owner             string      // Session the transaction and truncated values belong to
+	Params            []Param     // Bind values for the query's placeholders
+	Limits            QueryLimits // Overrides the connection's default limits
+}
+
+// Column describes a result column
+type Column struct {
+	Name    string `msgpack:"name"`
+	Type    string `msgpack:"type"`              // Database type name, e.g. VARCHAR
+	Kind    Kind   `msgpack:"kind"`              // How the values are encoded
+	Element Kind   `msgpack:"element,omitempty"` // Kind of the elements of arrays
+}
+
+// Result is the outcome of a query
+type Result struct {
+	Columns      []Column        `msgpack:"columns"`
+	Rows         [][]interface{} `msgpack:"rows"`
+	RowsAffected int64           `msgpack:"rows_affected"`
+	Truncated    bool            `msgpack:"truncated"` // More rows were available than max_rows
+	Stats        QueryStats      `msgpack:"stats"`
+	Class        sqlparse.Class  `msgpack:"class"` // Most invasive statement class in the query
+	Confirmed    bool            `msgpack:"confirmed"`
+	DurationMs   int64           `msgpack:"duration_ms"`
+}
+
+// queryPlan is a parsed query that passed the read-only checks
+type queryPlan struct {
+	conn      *Connection
+	tx        *Transaction
+	owner     string
+	stmts     []sqlparse.Statement
+	strictest sqlparse.Statement
+	confirmed bool // A confirmation token allowed a write on a read-only connection
+}
+
+// QueryStats times the phases of a statement. Durations are fractional milliseconds.
+type QueryStats struct {
+	ExecuteMs        float64 `msgpack:"execute_ms"`           // Until the database answered the statement
+	TimeToFirstRowMs float64 `msgpack:"time_to_first_row_ms"` // Until the first row arrived; zero without rows
+	FetchMs          float64 `msgpack:"fetch_ms"`             // Reading and converting the rows
+	Bytes            int64   `msgpack:"bytes"`                // Approximate size of the fetched values
+}
+
+// beginner is implemented by *sql.DB and *sql.Conn
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Query runs SQL on a connection, or in one of its transactions. Read-only
+// connections refuse statements that may write unless opts carries a matching
+// confirmation token; read-only transactions refuse them outright.
+func (m *Manager) Query(ctx context.Context, id, query string, opts QueryOptions) (*Result, error) {
+	plan, err := m.plan(id, query, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	bound, args, err := bindParams(plan.conn.Driver, query, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	returnsRows := false
+	for _, stmt := range plan.stmts {
+		returnsRows = returnsRows || stmt.ReturnsRows
+	}
+
+	limits := m.heldLimits(opts.Limits.withDefaults(plan.conn.Limits))
+	start := time.Now()
+	var result *Result
+	err = m.run(ctx, plan, needsSession(plan.conn.Driver, limits), func(q querier) error {
+		return withTimeout(ctx, plan.conn.Driver, q, limits, func(ctx context.Context) error {
+			var err error
+			result, err = execute(ctx, q, bound, args, returnsRows, m.fetchOptions(plan, limits))
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Class = plan.strictest.Class
+	result.Confirmed = plan.confirmed
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// Stream runs a query like Query but passes its rows to sink as they are
+// read instead of returning them. The connection's max_rows and
+// max_value_size defaults do not apply, since the rows are not held in
+// memory; explicit opts.Limits do.
+func (m *Manager) Stream(ctx context.Context, id, query string, opts QueryOptions, sink RowSink) (*Result, error) {
+	run, err := m.PlanStream(id, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return run(ctx, sink)
+}
+
+// StreamFunc runs a planned query, passing its rows to sink
+type StreamFunc func(ctx context.Context, sink RowSink) (*Result, error)
+
+// PlanStream checks a query for Stream now, including the read-only rules,
+// and returns a function that runs it later
+func (m *Manager) PlanStream(id, query string, opts QueryOptions) (StreamFunc, error) {
+	plan, err := m.plan(id, query, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	bound, args, err := bindParams(plan.conn.Driver, query, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	returnsRows := false
+	for _, stmt := range plan.stmts {
+		returnsRows = returnsRows || stmt.ReturnsRows
+	}
+
+	limits := QueryLimits{
+		TimeoutMs:    opts.Limits.withDefaults(plan.conn.Limits).TimeoutMs,
+		MaxRows:      opts.Limits.MaxRows,
+		MaxValueSize: opts.Limits.MaxValueSize,
+	}
+	return func(ctx context.Context, sink RowSink) (*Result, error) {
+		start := time.Now()
+		var result *Result
+		err := m.run(ctx, plan, needsSession(plan.conn.Driver, limits), func(q querier) error {
+			return withTimeout(ctx, plan.conn.Driver, q, limits, func(ctx context.Context) error {
+				var err error
+				result, err = stream(ctx, q, bound, args, returnsRows, m.fetchOptions(plan, limits), sink)
+				return err
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Class = plan.strictest.Class
+		result.Confirmed = plan.confirmed
+		result.DurationMs = time.Since(start).Milliseconds()
+		return result, nil
+	}, nil
+}
+
+// heldLimits applies the manager's max_value_size to the limits of a query
+// whose rows are held in memory. Streamed rows keep their values whole
+// unless the request sets a max_value_size.
+func (m *Manager) heldLimits(limits QueryLimits) QueryLimits {
+	if limits.MaxValueSize == 0 {
+		m.mu.RLock()
+		limits.MaxValueSize = m.maxValueSize
+		m.mu.RUnlock()
+	}
+	return limits
+}
+
+// fetchOptions returns how a query for plan reads its rows under limits.
+// Truncated values are kept for the plan's owner. A single statement
+// outside a transaction is cancelled once max_rows is reached; cancelling
+// inside a transaction or a multi-statement query would roll back its
+// writes.
+func (m *Manager) fetchOptions(plan *queryPlan, limits QueryLimits) fetchOptions {
+	return fetchOptions{
+		driver:   plan.conn.Driver,
+		maxRows:  limits.MaxRows,
+		maxValue: limits.MaxValueSize,
+		keeper:   m.values,
+		owner:    plan.owner,
+		cancel:   plan.tx == nil && len(plan.stmts) == 1,
+	}
+}
+
+// plan parses query for connection id and applies the read-only rules.
+// Transaction control statements are refused unless txControl is set, for
+// scripts that run on a session of their own.
+func (m *Manager) plan(id, query string, opts QueryOptions, txControl bool) (*queryPlan, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.planParsed(conn, query, sqlparse.Parse(query, sqlparse.Dialect(conn.Driver)), opts, txControl)
+}
+
+// planParsed is plan for a query that has already been split into stmts
+func (m *Manager) planParsed(conn *Connection, query string, stmts []sqlparse.Statement, opts QueryOptions, txControl bool) (*queryPlan, error) {
+	id := conn.ID
+	plan := &queryPlan{conn: conn, owner: opts.Owner}
+	var err error
+
+	if opts.TransactionID != "" {
+		txConn, t, err := m.transaction(opts.TransactionID, opts.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if txConn != conn {
+			return nil, fmt.Errorf("%w: %s is not on connection %s", ErrTransactionNotFound, opts.TransactionID, id)
+		}
+		plan.tx = t
+	}
+
+	if err := opts.Limits.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	plan.stmts = stmts
+	if len(plan.stmts) == 0 {
+		return nil, fmt.Errorf("%w: sql is empty", ErrInvalidQuery)
+	}
+	for _, stmt := range plan.stmts {
+		// A BEGIN or COMMIT sent as a query would leave pooled connections
+		// mid-transaction, and would end a managed transaction behind its back
+		if stmt.Class != sqlparse.ClassTransaction || (txControl && plan.tx == nil) {
+			continue
+		}
+		if plan.tx != nil {
+			return nil, fmt.Errorf("%w: %s is not allowed in an open transaction; use the transaction messages", ErrInvalidQuery, stmt.Keyword)
+		}
+		return nil, fmt.Errorf("%w: %s is only allowed in scripts outside a managed transaction; use the transaction messages", ErrInvalidQuery, stmt.Keyword)
+	}
+	plan.strictest = sqlparse.Strictest(plan.stmts)
+
+	if blocked := firstUnsafe(plan.stmts); blocked != nil {
+		switch {
+		case plan.tx != nil && (conn.ReadOnly || plan.tx.info.ReadOnly):
+			err = &ReadOnlyError{Statement: *blocked}
+		case conn.ReadOnly:
+			err = conn.confirmWrite(query, *blocked, opts.ConfirmationToken)
+			plan.confirmed = err == nil
+		}
+	}
+	if err != nil {
+		m.logger.Info("Statement refused on read-only connection",
+			zap.String("connection_id", id),
+			zap.String("class", string(plan.strictest.Class)),
+			zap.String("keyword", plan.strictest.Keyword),
+		)
+		return nil, err
+	}
+	return plan, nil
+}
+
+// run calls fn with the querier a plan executes on: its transaction, a
+// writable connection for confirmed writes, or the pool. With dedicated set,
+// pooled statements share one connection so session state carries over.
+func (m *Manager) run(ctx context.Context, plan *queryPlan, dedicated bool, fn func(querier) error) error {
+	switch {
+	case plan.tx != nil:
+		plan.tx.mu.Lock()
+		defer plan.tx.mu.Unlock()
+		plan.tx.infoMu.Lock()
+		plan.tx.info.Statements++
+		plan.tx.infoMu.Unlock()
+		return fn(plan.tx.tx)
+	case plan.confirmed:
+		m.logger.Warn("Running confirmed write on read-only connection",
+			zap.String("connection_id", plan.conn.ID),
+			zap.String("class", string(plan.strictest.Class)),
+			zap.String("keyword", plan.strictest.Keyword),
+		)
+		return plan.conn.withWritable(ctx, fn)
+	case dedicated:
+		conn, err := plan.conn.DB().Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return fn(conn)
+	default:
+		return fn(plan.conn.DB())
+	}
+}
+
+// needsSession reports whether statements under limits must share one
+// pooled connection, because the timeout is set on the session
+func needsSession(driverName string, limits QueryLimits) bool {
+	return limits.TimeoutMs > 0 && driverName != DriverSQLite
+}
+
+// RowSink receives a result as it is read: its columns first, then each row
+type RowSink interface {
+	Columns(cols []Column) error
+	Row(row []interface{}) error
+}
+
+// collector is a RowSink that keeps every row in memory
+type collector struct {
+	rows [][]interface{}
+}
+
+// Columns implements RowSink
+func (c *collector) Columns([]Column) error {
+	return nil
+}
+
+// Row implements RowSink
+func (c *collector) Row(row []interface{}) error {
+	c.rows = append(c.rows, row)
+	return nil
+}
+
+// execute runs query with args on q, reading rows when the statement returns
+// them. It stops after fetch.maxRows rows, when that is set, and marks the
+// result truncated if more were available.
+func execute(ctx context.Context, q querier, query string, args []interface{}, returnsRows bool, fetch fetchOptions) (*Result, error) {
+	rows := &collector{rows: [][]interface{}{}}
+	result, err := stream(ctx, q, query, args, returnsRows, fetch, rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Rows = rows.rows
+	return result, nil
+}
+
+// stream runs query like execute but hands the rows to sink instead of
+// keeping them. The returned result has no rows.
+func stream(ctx context.Context, q querier, query string, args []interface{}, returnsRows bool, fetch fetchOptions, sink RowSink) (*Result, error) {
+	start := time.Now()
+	if !returnsRows {
+		res, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		affected, _ := res.RowsAffected()
+		if err := sink.Columns([]Column{}); err != nil {
+			return nil, err
+		}
+		return &Result{
+			Columns:      []Column{},
+			Rows:         [][]interface{}{},
+			RowsAffected: affected,
+			Stats:        QueryStats{ExecuteMs: millis(time.Since(start))},
+		}, nil
+	}
+
+	if _, inTx := q.(*sql.Tx); inTx || fetch.maxRows == 0 {
+		fetch.cancel = false
+	}
+	var cancel context.CancelFunc
+	if fetch.cancel {
+		// Closing rows early reads the rest of the result; cancelling the
+		// statement first stops the server from sending it
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+	}
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	answered := time.Now()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Columns: make([]Column, len(types)),
+		Rows:    [][]interface{}{},
+		Stats:   QueryStats{ExecuteMs: millis(answered.Sub(start))},
+	}
+	codecs := make([]codec, len(types))
+	for i, t := range types {
+		codecs[i] = columnCodec(fetch.driver, t)
+		result.Columns[i] = Column{Name: t.Name(), Type: t.DatabaseTypeName(), Kind: codecs[i].kind, Element: codecs[i].element}
+	}
+	if err := sink.Columns(result.Columns); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(types))
+	dest := make([]interface{}, len(types))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var count int64
+	for rows.Next() {
+		if fetch.maxRows > 0 && count == int64(fetch.maxRows) {
+			result.Truncated = true
+			if cancel != nil {
+				cancel()
+			}
+			break
+		}
+		if count == 0 {
+			result.Stats.TimeToFirstRowMs = millis(time.Since(start))
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(values))
+		for i, v := range values {
+			row[i] = fetch.truncate(codecs[i].convert(v))
+			result.Stats.Bytes += valueSize(row[i])
+		}
+		if err := sink.Row(row); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	// A cancelled statement reports the cancellation, not a failure
+	if err := rows.Err(); err != nil && !(result.Truncated && fetch.cancel) {
+		return nil, err
+	}
+	result.RowsAffected = count
+	result.Stats.FetchMs = millis(time.Since(answered))
+	return result, nil
+}
+
+// millis converts d to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// valueSize estimates the bytes a fetched value took on the wire
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case bool:
+		return 1
+	case int64, uint64, float64, time.Time:
+		return 8
+	case []interface{}:
+		var n int64
+		for _, e := range v {
+			n += valueSize(e)
+		}
+		return n
+	case Tagged:
+		return valueSize(v.Scalar())
+	default:
+		return int64(len(fmt.Sprint(v)))
+	}
+}
+
+// convertValue turns driver text values into strings; binary columns and
+// bytes that are not valid UTF-8 stay raw
+func convertValue(v interface{}, binary bool) interface{} {
+	if b, ok := v.([]byte); ok {
+		if binary || !utf8.Valid(b) {
+			return append([]byte(nil), b...)
+		}
+		return string(b)
+	}
+	return v
+}
+
+// isBinaryType reports whether a database type name holds raw bytes
+func isBinaryType(name string) bool {
+	name = strings.ToUpper(name)
+	return name == "BYTEA" || strings.HasSuffix(name, "BLOB") || strings.HasSuffix(name, "BINARY")
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/sqlparse"
+)
+
+// ErrReadOnly is returned when a read-only connection or transaction refuses a statement
+var ErrReadOnly = errors.New("read-only")
+
+// confirmationTTL is how long a write confirmation token stays valid
+const confirmationTTL = 2 * time.Minute
+
+// ReadOnlyError describes a refused statement. When Token is set, repeating
+// the same query with it as confirmation token runs it once with writes allowed.
+// Statements refused inside a read-only transaction cannot be confirmed.
+type ReadOnlyError struct {
+	Statement sqlparse.Statement
+	Token     string
+	ExpiresAt time.Time
+	Rejected  bool // A confirmation token was given but is invalid, expired or for another query
+}
+
+// Error implements error
+func (e *ReadOnlyError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s: %s statement (%s) is not allowed in a read-only transaction", ErrReadOnly, e.Statement.Class, e.Statement.Keyword)
+	}
+	msg := fmt.Sprintf("%s: %s statement (%s) requires confirmation", ErrReadOnly, e.Statement.Class, e.Statement.Keyword)
+	if e.Rejected {
+		msg += "; the confirmation token is invalid or expired"
+	}
+	return msg
+}
+
+// Unwrap returns ErrReadOnly
+func (e *ReadOnlyError) Unwrap() error {
+	return ErrReadOnly
+}
+
+// confirmation is an issued write confirmation token
+type confirmation struct {
+	query     [sha256.Size]byte
+	expiresAt time.Time
+}
+
+// readOnlyDSN adds the driver's read-only session defaults to dsn.
+// MySQL has no such DSN parameter and uses readOnlyConnector instead.
+func readOnlyDSN(driverName, dsn string) string {
+	switch driverName {
+	case DriverPostgres:
+		// Sent as a startup parameter, so RESET and DISCARD ALL keep it
+		return overrideParams(driverName, dsn, map[string]string{"default_transaction_read_only": "on"})
+	case DriverSQLite:
+		// go-sqlite3 only honours mode for file: URIs
+		if !strings.HasPrefix(dsn, "file:") {
+			dsn = "file:" + dsn
+		}
+		return overrideParams(driverName, dsn, map[string]string{"mode": "ro", "_query_only": "true"})
+	default:
+		return dsn
+	}
+}
+
+// readOnlyConnector runs statements on every new physical connection
+type readOnlyConnector struct {
+	base       driver.Connector
+	statements []string
+}
+
+// mysqlReadOnly makes transactions of a MySQL session read-only by default
+const mysqlReadOnly = "SET SESSION TRANSACTION READ ONLY"
+
+// Connect implements driver.Connector
+func (c *readOnlyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("driver cannot set read-only session defaults")
+	}
+	for _, stmt := range c.statements {
+		if _, err := execer.ExecContext(ctx, stmt, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to make session read-only: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *readOnlyConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// firstUnsafe returns the first statement not allowed in read-only mode, or nil
+func firstUnsafe(stmts []sqlparse.Statement) *sqlparse.Statement {
+	for i := range stmts {
+		if !stmts[i].ReadOnlySafe() {
+			return &stmts[i]
+		}
+	}
+	return nil
+}
+
+// confirmWrite refuses a blocked statement of query unless token confirms
+// exactly this query, in which case the write may go ahead
+func (c *Connection) confirmWrite(query string, blocked sqlparse.Statement, token string) error {
+	hash := sha256.Sum256([]byte(query))
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, conf := range c.confirmations {
+		if now.After(conf.expiresAt) {
+			delete(c.confirmations, t)
+		}
+	}
+	if token != "" {
+		conf, ok := c.confirmations[token]
+		delete(c.confirmations, token)
+		if ok && conf.query == hash {
+			return nil
+		}
+	}
+
+	newToken, err := ids.NewToken("confirm_")
+	if err != nil {
+		return err
+	}
+	if c.confirmations == nil {
+		c.confirmations = make(map[string]confirmation)
+	}
+	c.confirmations[newToken] = confirmation{query: hash, expiresAt: now.Add(confirmationTTL)}
+	return &ReadOnlyError{
+		Statement: blocked,
+		Token:     newToken,
+		ExpiresAt: now.Add(confirmationTTL),
+		Rejected:  token != "",
+	}
+}
+
+// withWritable runs fn on a connection that accepts writes despite the
+// read-only session defaults, restoring them afterwards
+func (c *Connection) withWritable(ctx context.Context, fn func(querier) error) error {
+	if c.Driver == DriverSQLite {
+		// The pool opened the file read-only, so confirmed writes get their own handle
+		connector, err := openConnector(DriverSQLite, c.writeDSN, nil)
+		if err != nil {
+			return err
+		}
+		db := sql.OpenDB(&limitedConnector{base: connector, limiter: c.limiter})
+		db.SetMaxOpenConns(1)
+		defer db.Close()
+		return fn(db)
+	}
+
+	conn, err := c.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	enable, restore := "SET default_transaction_read_only = off", "RESET default_transaction_read_only"
+	if c.Driver == DriverMySQL {
+		enable, restore = "SET SESSION TRANSACTION READ WRITE", mysqlReadOnly
+	}
+	if _, err := conn.ExecContext(ctx, enable); err != nil {
+		return fmt.Errorf("failed to allow writes: %w", err)
+	}
+	fnErr := fn(conn)
+	if _, err := conn.ExecContext(context.Background(), restore); err != nil {
+		// Never hand a writable session back to the pool
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	return fnErr
+}
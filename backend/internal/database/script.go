@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"litebase-backend/internal/sqlparse"
+
+	"go.uber.org/zap"
+)
+
+// Statement outcomes in a script result
+const (
+	StatementOK      = "ok"
+	StatementFailed  = "error"
+	StatementSkipped = "skipped"
+)
+
+// ScriptOptions controls a script execution
+type ScriptOptions struct {
+	QueryOptions
+	ContinueOnError bool // Run the remaining statements after a failure
+	Atomic          bool // Wrap the script in a transaction that is rolled back if any statement fails
+}
+
+// StatementResult is the outcome of one statement of a script
+type StatementResult struct {
+	Index      int            `msgpack:"index"`
+	Keyword    string         `msgpack:"keyword"`
+	Class      sqlparse.Class `msgpack:"class"`
+	Start      int            `msgpack:"start"` // Byte offsets in the script
+	End        int            `msgpack:"end"`
+	StartLine  int            `msgpack:"start_line"`
+	EndLine    int            `msgpack:"end_line"`
+	Status     string         `msgpack:"status"` // ok, error or skipped
+	Result     *Result        `msgpack:"result"` // Set when the statement succeeded
+	Error      string         `msgpack:"error"`
+	DurationMs int64          `msgpack:"duration_ms"`
+}
+
+// ScriptResult is the outcome of a script
+type ScriptResult struct {
+	Statements []StatementResult `msgpack:"statements"`
+	Succeeded  int               `msgpack:"succeeded"`
+	Failed     int               `msgpack:"failed"`
+	Skipped    int               `msgpack:"skipped"`
+	RolledBack bool              `msgpack:"rolled_back"` // An atomic script failed and nothing was kept
+	Class      sqlparse.Class    `msgpack:"class"`
+	Confirmed  bool              `msgpack:"confirmed"`
+	DurationMs int64             `msgpack:"duration_ms"`
+}
+
+// RunScript splits a script into statements and runs them in order on one
+// session, collecting a result or error for each. It stops at the first
+// failure unless opts.ContinueOnError is set. Read-only rules apply to the
+// script as a whole, as for Query.
+func (m *Manager) RunScript(ctx context.Context, id, script string, opts ScriptOptions) (*ScriptResult, error) {
+	if len(opts.Params) > 0 {
+		return nil, fmt.Errorf("%w: params are not supported in scripts", ErrInvalidQuery)
+	}
+	if opts.Atomic && opts.TransactionID != "" {
+		return nil, fmt.Errorf("%w: a script in an open transaction cannot also be atomic", ErrInvalidQuery)
+	}
+	// The script's own BEGIN and COMMIT are fine on its dedicated session, but
+	// not inside a transaction managed for it
+	plan, err := m.plan(id, script, opts.QueryOptions, !opts.Atomic)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScriptResult{
+		Statements: make([]StatementResult, len(plan.stmts)),
+		Class:      plan.strictest.Class,
+		Confirmed:  plan.confirmed,
+	}
+	for i, stmt := range plan.stmts {
+		result.Statements[i] = StatementResult{
+			Index:     i,
+			Keyword:   stmt.Keyword,
+			Class:     stmt.Class,
+			Start:     stmt.Start,
+			End:       stmt.End,
+			StartLine: stmt.StartLine,
+			EndLine:   stmt.EndLine,
+			Status:    StatementSkipped,
+		}
+	}
+
+	limits := m.heldLimits(opts.Limits.withDefaults(plan.conn.Limits))
+	start := time.Now()
+	err = m.run(ctx, plan, true, func(q querier) error {
+		var tx *sql.Tx
+		if opts.Atomic {
+			starter, ok := q.(beginner)
+			if !ok {
+				return fmt.Errorf("cannot start a transaction for the script")
+			}
+			var err error
+			if tx, err = starter.BeginTx(ctx, nil); err != nil {
+				return err
+			}
+			q = tx
+		}
+
+		txControl := false
+		for i, stmt := range plan.stmts {
+			sr := &result.Statements[i]
+			txControl = txControl || stmt.Class == sqlparse.ClassTransaction
+			stmtStart := time.Now()
+			var res *Result
+			err := withTimeout(ctx, plan.conn.Driver, q, limits, func(ctx context.Context) error {
+				var err error
+				res, err = execute(ctx, q, stmt.Text, nil, stmt.ReturnsRows, m.fetchOptions(plan, limits))
+				return err
+			})
+			sr.DurationMs = time.Since(stmtStart).Milliseconds()
+			if err != nil {
+				sr.Status, sr.Error = StatementFailed, err.Error()
+				result.Failed++
+				if !opts.ContinueOnError {
+					break
+				}
+				continue
+			}
+			res.Class, res.DurationMs = stmt.Class, sr.DurationMs
+			sr.Status, sr.Result = StatementOK, res
+			result.Succeeded++
+		}
+
+		if tx == nil {
+			if txControl && plan.tx == nil {
+				// The session goes back to the pool, so a transaction the
+				// script left open must not outlive it
+				q.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+			}
+			return nil
+		}
+		if result.Failed > 0 {
+			tx.Rollback()
+			result.RolledBack = true
+			return nil
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit script: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped = len(plan.stmts) - result.Succeeded - result.Failed
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	m.logger.Info("Script finished",
+		zap.String("connection_id", id),
+		zap.Int("statements", len(plan.stmts)),
+		zap.Int("failed", result.Failed),
+		zap.Bool("rolled_back", result.RolledBack),
+	)
+	return result, nil
+}
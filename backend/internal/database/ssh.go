@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHHost describes one SSH server on the way to the database
+type SSHHost struct {
+	Host           string `msgpack:"host"` // host or host:port; the port defaults to 22
+	User           string `msgpack:"user"`
+	Password       string `msgpack:"password"`
+	PrivateKey     string `msgpack:"private_key"`      // PEM encoded key
+	PrivateKeyPath string `msgpack:"private_key_path"` // Used when PrivateKey is empty
+	Passphrase     string `msgpack:"passphrase"`       // Decrypts the private key
+	Agent          bool   `msgpack:"agent"`            // Authenticate with the keys in $SSH_AUTH_SOCK
+
+	// IDs of stored secrets that supply the fields above at connect time
+	PasswordSecret   string `msgpack:"password_secret"`
+	PrivateKeySecret string `msgpack:"private_key_secret"`
+	PassphraseSecret string `msgpack:"passphrase_secret"`
+}
+
+// SSHOptions tunnels database connections through an SSH server,
+// optionally reached through a chain of jump hosts
+type SSHOptions struct {
+	SSHHost        `msgpack:",inline"`
+	JumpHosts      []SSHHost `msgpack:"jump_hosts"`      // Dialled in order before Host
+	KnownHosts     string    `msgpack:"known_hosts"`     // known_hosts file; defaults to ~/.ssh/known_hosts
+	ConnectTimeout int64     `msgpack:"connect_timeout"` // Milliseconds per SSH handshake; 0 uses the driver connect timeout
+}
+
+// sshTunnel dials database connections through an SSH client chain.
+// The chain is established on first use and re-established once it breaks.
+type sshTunnel struct {
+	opts    SSHOptions
+	timeout time.Duration
+
+	mu         sync.Mutex
+	clients    []*ssh.Client // Jump hosts first, the tunnel host last
+	agents     []net.Conn    // SSH agent connections the clients sign with
+	generation int           // Incremented whenever the chain is closed
+	closed     bool
+}
+
+// newSSHTunnel validates the options and prepares a tunnel.
+// No connection is made until the first dial.
+func newSSHTunnel(opts SSHOptions, defaultTimeout time.Duration) (*sshTunnel, error) {
+	hosts := append(append([]SSHHost{}, opts.JumpHosts...), opts.SSHHost)
+	for i, host := range hosts {
+		if host.Host == "" {
+			return nil, fmt.Errorf("ssh host %d: host is required", i+1)
+		}
+		if host.User == "" {
+			return nil, fmt.Errorf("ssh host %s: user is required", host.Host)
+		}
+		if host.Password == "" && host.PrivateKey == "" && host.PrivateKeyPath == "" && !host.Agent {
+			return nil, fmt.Errorf("ssh host %s: a password, private key or agent is required", host.Host)
+		}
+	}
+
+	timeout := defaultTimeout
+	if opts.ConnectTimeout > 0 {
+		timeout = time.Duration(opts.ConnectTimeout) * time.Millisecond
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &sshTunnel{opts: opts, timeout: timeout}, nil
+}
+
+// DialContext opens a connection to addr as seen from the SSH server
+func (t *sshTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s through ssh tunnel: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// Dial implements pq.Dialer
+func (t *sshTunnel) Dial(network, addr string) (net.Conn, error) {
+	return t.DialContext(context.Background(), network, addr)
+}
+
+// DialTimeout implements pq.Dialer
+func (t *sshTunnel) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.DialContext(ctx, network, addr)
+}
+
+// String describes the tunnel host as user@host:port
+func (t *sshTunnel) String() string {
+	return t.opts.User + "@" + t.opts.Host
+}
+
+// Close closes every SSH client of the chain
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.closeClients()
+	return nil
+}
+
+// client returns the SSH client of the tunnel host, connecting the chain if needed
+func (t *sshTunnel) client(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("ssh tunnel is closed")
+	}
+	if len(t.clients) > 0 {
+		return t.clients[len(t.clients)-1], nil
+	}
+
+	hostKeys, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := append(append([]SSHHost{}, t.opts.JumpHosts...), t.opts.SSHHost)
+	var previous *ssh.Client
+	for _, host := range hosts {
+		client, agentConn, err := t.connect(ctx, previous, host, hostKeys)
+		if err != nil {
+			t.closeClients()
+			return nil, err
+		}
+		t.clients = append(t.clients, client)
+		if agentConn != nil {
+			t.agents = append(t.agents, agentConn)
+		}
+		previous = client
+	}
+
+	// Forget the chain once any hop goes away so the next dial rebuilds it
+	generation := t.generation
+	for _, client := range t.clients {
+		go func(client *ssh.Client) {
+			client.Wait()
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.generation == generation {
+				t.closeClients()
+			}
+		}(client)
+	}
+
+	return t.clients[len(t.clients)-1], nil
+}
+
+// connect opens an SSH client to host, through previous when it is a later
+// hop. The agent connection it authenticates with, if any, must stay open
+// while the client is in use and be closed with it.
+func (t *sshTunnel) connect(ctx context.Context, previous *ssh.Client, host SSHHost, hostKeys ssh.HostKeyCallback) (*ssh.Client, net.Conn, error) {
+	var agentConn net.Conn
+	if host.Agent {
+		var err error
+		if agentConn, err = dialAgent(); err != nil {
+			return nil, nil, fmt.Errorf("ssh host %s: %w", host.Host, err)
+		}
+	}
+	client, err := t.handshake(ctx, previous, host, hostKeys, agentConn)
+	if err != nil {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, nil, err
+	}
+	return client, agentConn, nil
+}
+
+// handshake dials host and authenticates, signing with the agent on
+// agentConn when it is set
+func (t *sshTunnel) handshake(ctx context.Context, previous *ssh.Client, host SSHHost, hostKeys ssh.HostKeyCallback, agentConn net.Conn) (*ssh.Client, error) {
+	auth, err := host.authMethods(agentConn)
+	if err != nil {
+		return nil, fmt.Errorf("ssh host %s: %w", host.Host, err)
+	}
+
+	addr := host.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	config := &ssh.ClientConfig{
+		User:            host.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         t.timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var conn net.Conn
+	if previous == nil {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = previous.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ssh host %s: %w", addr, err)
+	}
+
+	// The handshake itself does not watch ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// hostKeyCallback verifies host keys against the known_hosts file
+func (t *sshTunnel) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := expandHome(t.opts.KnownHosts)
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// closeClients closes the chain, tunnel host first, and the agent
+// connections it signed with. Callers hold t.mu.
+func (t *sshTunnel) closeClients() {
+	for i := len(t.clients) - 1; i >= 0; i-- {
+		t.clients[i].Close()
+	}
+	for _, conn := range t.agents {
+		conn.Close()
+	}
+	t.clients = nil
+	t.agents = nil
+	t.generation++
+}
+
+// dialAgent connects to the SSH agent at $SSH_AUTH_SOCK
+func dialAgent() (net.Conn, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("ssh agent requested but SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ssh agent: %w", err)
+	}
+	return conn, nil
+}
+
+// authMethods returns the configured ways to authenticate with the host.
+// Agent keys are used when agentConn is set; the signers read from it keep
+// using it for every signature.
+func (h SSHHost) authMethods(agentConn net.Conn) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if agentConn != nil {
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	if h.PrivateKey != "" || h.PrivateKeyPath != "" {
+		key := []byte(h.PrivateKey)
+		if len(key) == 0 {
+			var err error
+			if key, err = os.ReadFile(expandHome(h.PrivateKeyPath)); err != nil {
+				return nil, fmt.Errorf("failed to read private key: %w", err)
+			}
+		}
+
+		var signer ssh.Signer
+		var err error
+		if h.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(h.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if h.Password != "" {
+		methods = append(methods, ssh.Password(h.Password))
+	}
+
+	return methods, nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that forwards direct-tcpip
+// channels, the way sshd serves ssh -L and ProxyJump
+type testSSHServer struct {
+	addr      string
+	hostKey   ssh.Signer
+	forwarded atomic.Int32 // Channels opened through the server
+}
+
+// newSigner returns a fresh ed25519 key
+func newSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+// startSSHServer serves SSH on a local port, accepting user "app" with
+// password "secret" or any of the given keys
+func startSSHServer(t *testing.T, keys ...ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	hostKey, _ := newSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "app" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, k := range keys {
+				if c.User() == "app" && string(k.Marshal()) == string(key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &testSSHServer{addr: l.Addr().String(), hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+// serve handles one SSH connection
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for ch := range chans {
+		if ch.ChannelType() != "direct-tcpip" {
+			ch.Reject(ssh.UnknownChannelType, "only direct-tcpip is served")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(ch.ExtraData(), &target); err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, chReqs, err := ch.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		s.forwarded.Add(1)
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			io.Copy(channel, upstream)
+			channel.CloseWrite()
+		}()
+		go func() {
+			io.Copy(upstream, channel)
+			upstream.Close()
+		}()
+	}
+}
+
+// startEcho serves a TCP echo on a local port, standing in for the database
+func startEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// writeKnownHosts writes a known_hosts file listing key for each address
+func writeKnownHosts(t *testing.T, entries map[string]ssh.PublicKey) string {
+	t.Helper()
+	var lines []string
+	for addr, key := range entries {
+		lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key))
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// echoThrough dials target through the tunnel and checks the reply
+func echoThrough(t *testing.T, tunnel *sshTunnel, target string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tunnel.DialContext(ctx, "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "ping" {
+		t.Errorf("reply = %q, want ping", reply)
+	}
+}
+
+func TestSSHTunnelDirect(t *testing.T) {
+	server := startSSHServer(t)
+	target := startEcho(t)
+
+	tunnel, err := newSSHTunnel(SSHOptions{
+		SSHHost:    SSHHost{Host: server.addr, User: "app", Password: "secret"},
+		KnownHosts: writeKnownHosts(t, map[string]ssh.PublicKey{server.addr: server.hostKey.PublicKey()}),
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	echoThrough(t, tunnel, target)
+	echoThrough(t, tunnel, target)
+	if n := server.forwarded.Load(); n != 2 {
+		t.Errorf("forwarded %d channels, want 2", n)
+	}
+}
+
+func TestSSHTunnelJumpHosts(t *testing.T) {
+	signer, key := newSigner(t)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jump := startSSHServer(t)
+	host := startSSHServer(t, signer.PublicKey())
+	target := startEcho(t)
+
+	tunnel, err := newSSHTunnel(SSHOptions{
+		SSHHost:   SSHHost{Host: host.addr, User: "app", PrivateKey: string(pem.EncodeToMemory(block))},
+		JumpHosts: []SSHHost{{Host: jump.addr, User: "app", Password: "secret"}},
+		KnownHosts: writeKnownHosts(t, map[string]ssh.PublicKey{
+			jump.addr: jump.hostKey.PublicKey(),
+			host.addr: host.hostKey.PublicKey(),
+		}),
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	echoThrough(t, tunnel, target)
+	// The jump host carries the connection to the tunnel host, which
+	// carries the one to the target
+	if n := jump.forwarded.Load(); n != 1 {
+		t.Errorf("jump host forwarded %d channels, want 1", n)
+	}
+	if n := host.forwarded.Load(); n != 1 {
+		t.Errorf("tunnel host forwarded %d channels, want 1", n)
+	}
+}
+
+func TestSSHTunnelHostKeyMismatch(t *testing.T) {
+	server := startSSHServer(t)
+	other, _ := newSigner(t)
+
+	tunnel, err := newSSHTunnel(SSHOptions{
+		SSHHost:    SSHHost{Host: server.addr, User: "app", Password: "secret"},
+		KnownHosts: writeKnownHosts(t, map[string]ssh.PublicKey{server.addr: other.PublicKey()}),
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	_, err = tunnel.DialContext(context.Background(), "tcp", startEcho(t))
+	if err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Fatalf("DialContext error = %v, want a host key mismatch", err)
+	}
+	if n := server.forwarded.Load(); n != 0 {
+		t.Errorf("forwarded %d channels after a host key mismatch", n)
+	}
+}
+
+func TestSSHTunnelAgent(t *testing.T) {
+	signer, key := newSigner(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	server := startSSHServer(t, signer.PublicKey())
+	tunnel, err := newSSHTunnel(SSHOptions{
+		SSHHost:    SSHHost{Host: server.addr, User: "app", Agent: true},
+		KnownHosts: writeKnownHosts(t, map[string]ssh.PublicKey{server.addr: server.hostKey.PublicKey()}),
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	echoThrough(t, tunnel, startEcho(t))
+}
+
+func TestNewSSHTunnelRequiresCredentials(t *testing.T) {
+	for _, opts := range []SSHOptions{
+		{SSHHost: SSHHost{User: "app", Password: "secret"}},
+		{SSHHost: SSHHost{Host: "db", Password: "secret"}},
+		{SSHHost: SSHHost{Host: "db", User: "app"}},
+		{SSHHost: SSHHost{Host: "db", User: "app", Password: "secret"}, JumpHosts: []SSHHost{{Host: "jump", User: "app"}}},
+	} {
+		if _, err := newSSHTunnel(opts, time.Second); err == nil {
+			t.Errorf("newSSHTunnel(%+v) succeeded, want an error", opts)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/sqlparse"
+
+	"go.uber.org/zap"
+)
+
+// ErrStatementNotFound is returned for unknown or evicted prepared statement IDs
+var ErrStatementNotFound = errors.New("prepared statement not found")
+
+// DefaultStatementCache is the number of prepared statements a connection
+// keeps when neither its profile nor the pool defaults say
+const DefaultStatementCache = 100
+
+// StatementInfo describes a prepared statement
+type StatementInfo struct {
+	ID           string         `msgpack:"id"`
+	ConnectionID string         `msgpack:"connection_id"`
+	SQL          string         `msgpack:"sql"`
+	Class        sqlparse.Class `msgpack:"class"`
+	Params       int            `msgpack:"params"`   // Placeholders in the SQL
+	Prepared     bool           `msgpack:"prepared"` // Prepared on the database; statements with placeholders are prepared at their first execution
+	Executions   int64          `msgpack:"executions"`
+	CreatedAt    time.Time      `msgpack:"created_at"`
+	LastUsedAt   time.Time      `msgpack:"last_used_at"`
+}
+
+// StatementCacheStats counts the use of a connection's statement cache
+type StatementCacheStats struct {
+	Size          int   `msgpack:"size"`
+	Capacity      int   `msgpack:"capacity"`
+	Hits          int64 `msgpack:"hits"`          // Prepare requests that found the statement
+	Misses        int64 `msgpack:"misses"`        // Prepare requests that had to add it
+	Prepares      int64 `msgpack:"prepares"`      // Statements prepared on the database
+	Evictions     int64 `msgpack:"evictions"`     // Least recently used statements dropped for new ones
+	Invalidations int64 `msgpack:"invalidations"` // Database statements dropped when the pool was reopened
+}
+
+// cachedStatement is an entry of a statement cache
+type cachedStatement struct {
+	info  StatementInfo
+	key   string // Normalized SQL
+	stmts []sqlparse.Statement
+
+	// The database statement, prepared from the bound SQL on db. Replaced
+	// statements are retired and closed once no execution is using the entry.
+	stmt    *sql.Stmt
+	db      *sql.DB
+	bound   string
+	retired []*sql.Stmt
+	active  int
+	dropped bool
+}
+
+// statementCache keeps a connection's prepared statements, dropping the
+// least recently used beyond its capacity
+type statementCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Of *cachedStatement, most recently used first
+	byKey    map[string]*list.Element
+	byID     map[string]*list.Element
+	stats    StatementCacheStats
+}
+
+// newStatementCache creates a cache holding up to capacity statements
+func newStatementCache(capacity int) *statementCache {
+	return &statementCache{
+		capacity: capacity,
+		order:    list.New(),
+		byKey:    make(map[string]*list.Element),
+		byID:     make(map[string]*list.Element),
+	}
+}
+
+// lookup returns the entry for key, adding it with add if it is missing,
+// with a copy of its description taken while it is certainly cached, and
+// reports whether it was found. This is where hits and misses are counted.
+func (c *statementCache) lookup(key string, add func() *cachedStatement) (*cachedStatement, StatementInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.byKey[key]; ok {
+		c.stats.Hits++
+		c.order.MoveToFront(el)
+		e := el.Value.(*cachedStatement)
+		return e, e.info, true
+	}
+	c.stats.Misses++
+	e := add()
+	e.key = key
+	el := c.order.PushFront(e)
+	c.byKey[key], c.byID[e.info.ID] = el, el
+	for c.order.Len() > c.capacity {
+		c.removeLocked(c.order.Back())
+		c.stats.Evictions++
+	}
+	return e, e.info, false
+}
+
+// acquire returns the entry with id, marked in use until it is released
+func (c *statementCache) acquire(id string) (*cachedStatement, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatementNotFound, id)
+	}
+	c.order.MoveToFront(el)
+	e := el.Value.(*cachedStatement)
+	e.active++
+	e.info.Executions++
+	e.info.LastUsedAt = time.Now()
+	return e, nil
+}
+
+// release ends a use of e started by acquire
+func (c *statementCache) release(e *cachedStatement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.active--
+	if e.active == 0 {
+		e.closeRetired()
+	}
+}
+
+// prepared returns e's database statement for bound on db, preparing it
+// if there is none yet, it was prepared for other SQL or on another pool
+func (c *statementCache) prepared(ctx context.Context, e *cachedStatement, db *sql.DB, bound string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	if e.stmt != nil && e.db == db && e.bound == bound {
+		stmt := e.stmt
+		c.mu.Unlock()
+		return stmt, nil
+	}
+	c.mu.Unlock()
+
+	stmt, err := db.PrepareContext(ctx, bound)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Prepares++
+	e.retire()
+	e.stmt, e.db, e.bound = stmt, db, bound
+	e.info.Prepared = true
+	if e.dropped {
+		// Evicted meanwhile; the statement only serves the executions under way
+		e.retire()
+		e.closeRetired()
+	}
+	return stmt, nil
+}
+
+// remove drops the entry with id
+func (c *statementCache) remove(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byID[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStatementNotFound, id)
+	}
+	c.removeLocked(el)
+	return nil
+}
+
+// removeLocked drops an entry; c.mu must be held
+func (c *statementCache) removeLocked(el *list.Element) {
+	e := c.order.Remove(el).(*cachedStatement)
+	delete(c.byKey, e.key)
+	delete(c.byID, e.info.ID)
+	e.dropped = true
+	e.retire()
+	e.closeRetired()
+}
+
+// invalidate drops the database statements, which belong to a pool that is
+// being replaced. The entries stay and are prepared again when next executed.
+func (c *statementCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*cachedStatement)
+		if e.stmt != nil {
+			e.retire()
+			e.closeRetired()
+			e.info.Prepared = false
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// clear drops every entry
+func (c *statementCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.removeLocked(c.order.Front())
+	}
+}
+
+// snapshot returns the cache counters
+func (c *statementCache) snapshot() StatementCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size, stats.Capacity = c.order.Len(), c.capacity
+	return stats
+}
+
+// retire takes the database statement out of use; the cache's lock must be held
+func (e *cachedStatement) retire() {
+	if e.stmt != nil {
+		e.retired = append(e.retired, e.stmt)
+		e.stmt, e.db, e.bound = nil, nil, ""
+	}
+}
+
+// closeRetired closes the retired statements unless an execution may still
+// be using them; the cache's lock must be held
+func (e *cachedStatement) closeRetired() {
+	if e.active > 0 {
+		return
+	}
+	for _, stmt := range e.retired {
+		stmt.Close()
+	}
+	e.retired = nil
+}
+
+// stmtQuerier runs a prepared statement in place of the SQL it is given
+type stmtQuerier struct {
+	stmt *sql.Stmt
+}
+
+// ExecContext implements querier
+func (q stmtQuerier) ExecContext(ctx context.Context, _ string, args ...any) (sql.Result, error) {
+	return q.stmt.ExecContext(ctx, args...)
+}
+
+// QueryContext implements querier
+func (q stmtQuerier) QueryContext(ctx context.Context, _ string, args ...any) (*sql.Rows, error) {
+	return q.stmt.QueryContext(ctx, args...)
+}
+
+// Prepare adds a statement to the connection's cache, or finds it there if
+// the same SQL, ignoring layout, was prepared before, and reports which.
+// The statement is prepared on the database now when it has no
+// placeholders or params are given to bind them; otherwise at its first
+// execution. A connection with the statement cache disabled refuses them.
+func (m *Manager) Prepare(ctx context.Context, id, query string, params []Param) (StatementInfo, bool, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return StatementInfo{}, false, err
+	}
+	if conn.statements.capacity == 0 {
+		return StatementInfo{}, false, fmt.Errorf("%w: prepared statements are disabled on this connection (statement_cache %d)", ErrInvalidQuery, NoStatementCache)
+	}
+	dialect := sqlparse.Dialect(conn.Driver)
+	stmts := sqlparse.Parse(query, dialect)
+	switch {
+	case len(stmts) == 0:
+		return StatementInfo{}, false, fmt.Errorf("%w: sql is empty", ErrInvalidQuery)
+	case len(stmts) > 1:
+		return StatementInfo{}, false, fmt.Errorf("%w: a prepared statement holds a single statement, got %d", ErrInvalidQuery, len(stmts))
+	case stmts[0].Class == sqlparse.ClassTransaction:
+		return StatementInfo{}, false, fmt.Errorf("%w: %s is not allowed in a query; use the transaction messages", ErrInvalidQuery, stmts[0].Keyword)
+	}
+
+	placeholders := len(sqlparse.Placeholders(query, dialect))
+	stmtID, err := ids.New("stmt_")
+	if err != nil {
+		return StatementInfo{}, false, err
+	}
+	e, info, hit := conn.statements.lookup(sqlparse.Normalize(query, dialect), func() *cachedStatement {
+		now := time.Now()
+		return &cachedStatement{
+			info: StatementInfo{
+				ID:           stmtID,
+				ConnectionID: conn.ID,
+				SQL:          query,
+				Class:        stmts[0].Class,
+				Params:       placeholders,
+				CreatedAt:    now,
+				LastUsedAt:   now,
+			},
+			stmts: stmts,
+		}
+	})
+
+	if !info.Prepared && (placeholders == 0 || len(params) > 0) {
+		bound, _, err := bindParams(conn.Driver, info.SQL, params)
+		if err != nil {
+			conn.statements.remove(info.ID)
+			return StatementInfo{}, false, err
+		}
+		if _, err := conn.statements.prepared(ctx, e, conn.DB(), bound); err != nil {
+			conn.statements.remove(info.ID)
+			return StatementInfo{}, false, err
+		}
+		info.Prepared = true
+	}
+	return info, hit, nil
+}
+
+// ExecutePrepared runs a prepared statement like Query. In a transaction
+// the statement is bound to it; confirmed writes on read-only connections
+// run as plain SQL.
+func (m *Manager) ExecutePrepared(ctx context.Context, id, statementID string, opts QueryOptions) (*Result, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	e, err := conn.statements.acquire(statementID)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.statements.release(e)
+
+	plan, err := m.planParsed(conn, e.info.SQL, e.stmts, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	bound, args, err := bindParams(conn.Driver, e.info.SQL, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+	returnsRows := e.stmts[0].ReturnsRows
+	limits := m.heldLimits(opts.Limits.withDefaults(conn.Limits))
+
+	start := time.Now()
+	var result *Result
+	exec := func(ctx context.Context, q querier) error {
+		var err error
+		result, err = execute(ctx, q, bound, args, returnsRows, m.fetchOptions(plan, limits))
+		return err
+	}
+	switch {
+	case plan.tx != nil:
+		err = m.run(ctx, plan, false, func(q querier) error {
+			tx := q.(*sql.Tx)
+			stmt, err := conn.statements.prepared(ctx, e, conn.DB(), bound)
+			if err != nil {
+				return err
+			}
+			txStmt := tx.StmtContext(ctx, stmt)
+			defer txStmt.Close()
+			return withTimeout(ctx, conn.Driver, q, limits, func(ctx context.Context) error {
+				return exec(ctx, stmtQuerier{txStmt})
+			})
+		})
+	case plan.confirmed:
+		err = m.run(ctx, plan, false, func(q querier) error {
+			return withTimeout(ctx, conn.Driver, q, limits, func(ctx context.Context) error {
+				return exec(ctx, q)
+			})
+		})
+	default:
+		// Pooled statements run on any connection, so the timeout is only
+		// the context deadline rather than a session setting
+		var stmt *sql.Stmt
+		if stmt, err = conn.statements.prepared(ctx, e, conn.DB(), bound); err != nil {
+			return nil, err
+		}
+		if limits.TimeoutMs > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, limits.timeout())
+			defer cancel()
+		}
+		err = timeoutError(ctx, exec(ctx, stmtQuerier{stmt}))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Class = plan.strictest.Class
+	result.Confirmed = plan.confirmed
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// Deallocate removes a prepared statement from the connection's cache
+func (m *Manager) Deallocate(id, statementID string) error {
+	conn, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := conn.statements.remove(statementID); err != nil {
+		return err
+	}
+	m.logger.Debug("Prepared statement deallocated", zap.String("connection_id", id), zap.String("statement_id", statementID))
+	return nil
+}
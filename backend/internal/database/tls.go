@@ -0,0 +1,404 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes, named after PostgreSQL's sslmode values
+const (
+	TLSDisable    = "disable"     // Plain connection
+	TLSPrefer     = "prefer"      // TLS when the server offers it, without verification (MySQL only)
+	TLSRequire    = "require"     // TLS without certificate verification
+	TLSVerifyCA   = "verify-ca"   // TLS with a certificate signed by a trusted CA
+	TLSVerifyFull = "verify-full" // verify-ca plus a host name check
+)
+
+// TLSOptions configures transport encryption for PostgreSQL and MySQL.
+// PEM material can be given inline or as file paths.
+type TLSOptions struct {
+	Mode       string `msgpack:"mode"`
+	CA         string `msgpack:"ca"` // PEM bundle of trusted CAs
+	CAPath     string `msgpack:"ca_path"`
+	Cert       string `msgpack:"cert"` // PEM client certificate
+	CertPath   string `msgpack:"cert_path"`
+	Key        string `msgpack:"key"` // PEM client key
+	KeyPath    string `msgpack:"key_path"`
+	KeySecret  string `msgpack:"key_secret"`  // ID of a stored secret holding the PEM client key
+	ServerName string `msgpack:"server_name"` // Name to verify instead of the DSN host (MySQL only)
+	MinVersion string `msgpack:"min_version"` // "1.2" or "1.3"
+}
+
+// TLSInfo describes the encryption negotiated for a connection
+type TLSInfo struct {
+	Enabled bool   `msgpack:"enabled"`
+	Version string `msgpack:"version,omitempty"` // e.g. "TLSv1.3"
+	Cipher  string `msgpack:"cipher,omitempty"`
+}
+
+// tlsMaterial is the validated, loaded form of TLSOptions
+type tlsMaterial struct {
+	mode       string
+	ca         []byte
+	cert       []byte
+	key        []byte
+	caPath     string
+	serverName string
+	minVersion uint16
+	tempFiles  []string // Written for lib/pq, removed by cleanup
+}
+
+// loadTLS validates the options and reads the referenced files
+func loadTLS(opts TLSOptions) (*tlsMaterial, error) {
+	m := &tlsMaterial{mode: strings.ToLower(opts.Mode), serverName: opts.ServerName}
+	switch m.mode {
+	case "":
+		m.mode = TLSVerifyFull
+	case TLSDisable, TLSPrefer, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return nil, fmt.Errorf("unsupported tls mode %q (use disable, prefer, require, verify-ca or verify-full)", opts.Mode)
+	}
+
+	switch opts.MinVersion {
+	case "":
+	case "1.2":
+		m.minVersion = tls.VersionTLS12
+	case "1.3":
+		m.minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported tls min_version %q (use 1.2 or 1.3)", opts.MinVersion)
+	}
+
+	var err error
+	if m.ca, err = pemFrom(opts.CA, opts.CAPath, "ca"); err != nil {
+		return nil, err
+	}
+	if opts.CAPath != "" {
+		m.caPath = expandHome(opts.CAPath)
+	}
+	if m.cert, err = pemFrom(opts.Cert, opts.CertPath, "cert"); err != nil {
+		return nil, err
+	}
+	if m.key, err = pemFrom(opts.Key, opts.KeyPath, "key"); err != nil {
+		return nil, err
+	}
+
+	if (m.cert == nil) != (m.key == nil) {
+		return nil, fmt.Errorf("tls cert and key must be given together")
+	}
+	if m.cert != nil {
+		if _, err := tls.X509KeyPair(m.cert, m.key); err != nil {
+			return nil, fmt.Errorf("invalid tls client certificate: %w", err)
+		}
+	}
+	if m.ca != nil && !x509.NewCertPool().AppendCertsFromPEM(m.ca) {
+		return nil, fmt.Errorf("tls ca contains no PEM certificates")
+	}
+	if m.mode == TLSVerifyCA && m.ca == nil {
+		return nil, fmt.Errorf("tls mode verify-ca needs a ca")
+	}
+	if m.mode == TLSDisable && (m.cert != nil || m.minVersion != 0) {
+		return nil, fmt.Errorf("tls options are set but mode is disable")
+	}
+
+	return m, nil
+}
+
+// pemFrom returns inline PEM data or the contents of path
+func pemFrom(inline, path, name string) ([]byte, error) {
+	if inline != "" && path != "" {
+		return nil, fmt.Errorf("tls %s and %s_path are mutually exclusive", name, name)
+	}
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// postgresParams maps the options to lib/pq sslmode parameters.
+// lib/pq only accepts inline PEM together with a client certificate, so an
+// inline CA on its own is written to a temporary file.
+func (m *tlsMaterial) postgresParams() (map[string]string, error) {
+	if m.serverName != "" {
+		return nil, fmt.Errorf("tls server_name is not supported for postgres; use the certificate's host name in the dsn")
+	}
+	if m.mode == TLSPrefer {
+		// lib/pq rejects sslmode=prefer, and falling back silently would hide a downgrade
+		return nil, fmt.Errorf("tls mode prefer is not supported for postgres; use require or disable")
+	}
+
+	params := map[string]string{"sslmode": m.mode}
+	if m.mode == TLSDisable {
+		return params, nil
+	}
+
+	if m.cert != nil {
+		params["sslinline"] = "true"
+		params["sslcert"] = string(m.cert)
+		params["sslkey"] = string(m.key)
+		if m.ca != nil {
+			params["sslrootcert"] = string(m.ca)
+		}
+		return params, nil
+	}
+
+	if m.ca != nil {
+		path := m.caPath
+		if path == "" {
+			f, err := os.CreateTemp("", "litebase-ca-*.pem")
+			if err != nil {
+				return nil, fmt.Errorf("failed to store tls ca: %w", err)
+			}
+			m.tempFiles = append(m.tempFiles, f.Name())
+			_, err = f.Write(m.ca)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				m.cleanup()
+				return nil, fmt.Errorf("failed to store tls ca: %w", err)
+			}
+			path = f.Name()
+		}
+		params["sslrootcert"] = path
+	}
+	return params, nil
+}
+
+// cleanup removes the temporary files written for the driver
+func (m *tlsMaterial) cleanup() {
+	for _, path := range m.tempFiles {
+		os.Remove(path)
+	}
+	m.tempFiles = nil
+}
+
+// mysqlConfig builds the tls.Config registered with the MySQL driver.
+// It returns nil for modes the driver handles by name.
+func (m *tlsMaterial) mysqlConfig(host string) (*tls.Config, error) {
+	if m.mode == TLSDisable || (m.mode == TLSPrefer && m.minVersion == 0 && m.cert == nil) {
+		return nil, nil
+	}
+
+	conf := &tls.Config{MinVersion: m.minVersion, ServerName: m.serverName}
+	if conf.ServerName == "" {
+		conf.ServerName = host
+	}
+
+	if m.ca != nil {
+		conf.RootCAs = x509.NewCertPool()
+		conf.RootCAs.AppendCertsFromPEM(m.ca)
+	}
+	if m.cert != nil {
+		cert, err := tls.X509KeyPair(m.cert, m.key)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	switch m.mode {
+	case TLSPrefer, TLSRequire:
+		conf.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// Verify the chain but not the host name
+		conf.InsecureSkipVerify = true
+		conf.VerifyConnection = func(state tls.ConnectionState) error {
+			opts := x509.VerifyOptions{Roots: conf.RootCAs, Intermediates: x509.NewCertPool()}
+			for _, cert := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return conf, nil
+}
+
+// mysqlTLSParam returns the value of the MySQL DSN tls parameter for the
+// options, registering a custom config under name when one is needed
+func (m *tlsMaterial) mysqlTLSParam(name, host string) (string, error) {
+	conf, err := m.mysqlConfig(host)
+	if err != nil {
+		return "", err
+	}
+	if conf == nil {
+		if m.mode == TLSDisable {
+			return "false", nil
+		}
+		return "preferred", nil
+	}
+	if err := mysql.RegisterTLSConfig(name, conf); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// checkMinVersion rejects a negotiated version below the configured minimum
+func (m *tlsMaterial) checkMinVersion(info TLSInfo) error {
+	if m.minVersion == 0 {
+		return nil
+	}
+	want := tls.VersionName(m.minVersion)
+	if !info.Enabled {
+		return fmt.Errorf("connection is not encrypted but %s is required", want)
+	}
+	if tlsVersionNumber(info.Version) < m.minVersion {
+		return fmt.Errorf("negotiated %s is below the required %s", info.Version, want)
+	}
+	return nil
+}
+
+// postgresTLSConnector checks the TLS version of every new PostgreSQL
+// connection, since lib/pq cannot be told a minimum version
+type postgresTLSConnector struct {
+	base driver.Connector
+	tls  *tlsMaterial
+}
+
+// Connect implements driver.Connector
+func (c *postgresTLSConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info, err := postgresConnTLS(ctx, conn)
+	if err == nil {
+		err = c.tls.checkMinVersion(info)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *postgresTLSConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// postgresConnTLS reads the encryption of a single PostgreSQL connection
+func postgresConnTLS(ctx context.Context, conn driver.Conn) (TLSInfo, error) {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return TLSInfo{}, fmt.Errorf("driver cannot report the tls version")
+	}
+	rows, err := queryer.QueryContext(ctx, "SELECT ssl, version FROM pg_stat_ssl WHERE pid = pg_backend_pid()", nil)
+	if err != nil {
+		return TLSInfo{}, fmt.Errorf("failed to read tls version: %w", err)
+	}
+	defer rows.Close()
+	values := make([]driver.Value, 2)
+	if err := rows.Next(values); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("no pg_stat_ssl entry for the session")
+		}
+		return TLSInfo{}, fmt.Errorf("failed to read tls version: %w", err)
+	}
+	var info TLSInfo
+	info.Enabled, _ = values[0].(bool)
+	switch version := values[1].(type) {
+	case string:
+		info.Version = version
+	case []byte:
+		info.Version = string(version)
+	}
+	return info, nil
+}
+
+// tlsVersionNumber parses names such as "TLSv1.3" (PostgreSQL, MySQL) or "TLS 1.3" (Go)
+func tlsVersionNumber(name string) uint16 {
+	normalized := strings.NewReplacer("v", " ", "V", " ").Replace(name)
+	for _, v := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		if strings.EqualFold(strings.Join(strings.Fields(normalized), " "), tls.VersionName(v)) {
+			return v
+		}
+	}
+	return 0
+}
+
+// queryTLSInfo asks the server which encryption the connection negotiated
+func queryTLSInfo(ctx context.Context, db *sql.DB, driverName string) (TLSInfo, error) {
+	var info TLSInfo
+	switch driverName {
+	case DriverPostgres:
+		var version, cipher sql.NullString
+		err := db.QueryRowContext(ctx,
+			"SELECT ssl, version, cipher FROM pg_stat_ssl WHERE pid = pg_backend_pid()",
+		).Scan(&info.Enabled, &version, &cipher)
+		if err != nil {
+			return info, err
+		}
+		info.Version, info.Cipher = version.String, cipher.String
+	case DriverMySQL:
+		rows, err := db.QueryContext(ctx, "SHOW SESSION STATUS WHERE Variable_name IN ('Ssl_version', 'Ssl_cipher')")
+		if err != nil {
+			return info, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, value string
+			if err := rows.Scan(&name, &value); err != nil {
+				return info, err
+			}
+			switch strings.ToLower(name) {
+			case "ssl_version":
+				info.Version = value
+			case "ssl_cipher":
+				info.Cipher = value
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return info, err
+		}
+		info.Enabled = info.Version != ""
+	}
+	return info, nil
+}
+
+// applyTLS adds the driver's TLS parameters to dsn. MySQL configs are
+// registered under name, which the caller deregisters when done.
+func applyTLS(driverName, dsn string, m *tlsMaterial, name string) (string, error) {
+	switch driverName {
+	case DriverPostgres:
+		params, err := m.postgresParams()
+		if err != nil {
+			return "", err
+		}
+		return overrideParams(driverName, dsn, params), nil
+	case DriverMySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid dsn: %w", err)
+		}
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			host = cfg.Addr
+		}
+		value, err := m.mysqlTLSParam(name, host)
+		if err != nil {
+			return "", err
+		}
+		return overrideParams(driverName, dsn, map[string]string{"tls": value}), nil
+	default:
+		return "", fmt.Errorf("tls options are not supported for %s", driverName)
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/ids"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrTransactionNotFound is returned for unknown transaction IDs or
+	// transactions owned by another session
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrInvalidTransaction is returned for malformed transaction requests
+	ErrInvalidTransaction = errors.New("invalid transaction request")
+)
+
+// savepointPattern matches savepoint names that need no quoting
+var savepointPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// isolationLevels maps accepted isolation names to database/sql levels
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                 sql.LevelDefault,
+	"read_uncommitted": sql.LevelReadUncommitted,
+	"read_committed":   sql.LevelReadCommitted,
+	"repeatable_read":  sql.LevelRepeatableRead,
+	"serializable":     sql.LevelSerializable,
+}
+
+// TxOptions configures a new transaction
+type TxOptions struct {
+	Isolation string `msgpack:"isolation"` // read_uncommitted, read_committed, repeatable_read or serializable; empty for the database default
+	ReadOnly  bool   `msgpack:"read_only"`
+}
+
+// TransactionInfo describes an open transaction
+type TransactionInfo struct {
+	ID           string    `msgpack:"id"`
+	ConnectionID string    `msgpack:"connection_id"`
+	Owner        string    `msgpack:"owner"` // Session that began the transaction
+	Isolation    string    `msgpack:"isolation"`
+	ReadOnly     bool      `msgpack:"read_only"`
+	StartedAt    time.Time `msgpack:"started_at"`
+	Statements   int       `msgpack:"statements"`
+	Savepoints   []string  `msgpack:"savepoints"`
+}
+
+// Transaction is an open transaction bound to the session that began it.
+// Statements in it run one at a time.
+type Transaction struct {
+	mu    sync.Mutex // Held while a statement runs
+	tx    *sql.Tx
+	owner string
+
+	// infoMu guards info, which changes with both locks held, so Info need
+	// not wait for a running statement
+	infoMu sync.Mutex
+	info   TransactionInfo
+}
+
+// Info returns a snapshot of the transaction state
+func (t *Transaction) Info() TransactionInfo {
+	t.infoMu.Lock()
+	defer t.infoMu.Unlock()
+	info := t.info
+	info.Savepoints = append([]string{}, t.info.Savepoints...)
+	return info
+}
+
+// Begin starts a transaction on a connection for owner. It is rolled back
+// automatically when ctx ends, so ctx should live as long as the owner.
+func (m *Manager) Begin(ctx context.Context, id, owner string, opts TxOptions) (TransactionInfo, error) {
+	conn, err := m.Get(id)
+	if err != nil {
+		return TransactionInfo{}, err
+	}
+
+	isolation := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(opts.Isolation)))
+	level, ok := isolationLevels[isolation]
+	if !ok {
+		return TransactionInfo{}, fmt.Errorf("%w: unknown isolation level %q", ErrInvalidTransaction, opts.Isolation)
+	}
+	// SQLite transactions are always serializable and ignore the options
+	if conn.Driver == DriverSQLite && level != sql.LevelDefault && level != sql.LevelSerializable {
+		return TransactionInfo{}, fmt.Errorf("%w: sqlite3 only supports serializable transactions", ErrInvalidTransaction)
+	}
+	readOnly := opts.ReadOnly || conn.ReadOnly
+
+	txID, err := ids.New("tx_")
+	if err != nil {
+		return TransactionInfo{}, err
+	}
+	tx, err := conn.DB().BeginTx(ctx, &sql.TxOptions{Isolation: level, ReadOnly: readOnly})
+	if err != nil {
+		return TransactionInfo{}, err
+	}
+
+	t := &Transaction{
+		tx:    tx,
+		owner: owner,
+		info: TransactionInfo{
+			ID:           txID,
+			ConnectionID: conn.ID,
+			Owner:        owner,
+			Isolation:    isolation,
+			ReadOnly:     readOnly,
+			StartedAt:    time.Now(),
+			Savepoints:   []string{},
+		},
+	}
+
+	conn.mu.Lock()
+	if conn.txs == nil {
+		conn.txs = make(map[string]*Transaction)
+	}
+	conn.txs[t.info.ID] = t
+	conn.mu.Unlock()
+
+	m.logger.Info("Transaction started",
+		zap.String("connection_id", conn.ID),
+		zap.String("transaction_id", t.info.ID),
+		zap.String("owner", owner),
+		zap.String("isolation", isolation),
+		zap.Bool("read_only", readOnly),
+	)
+	return t.Info(), nil
+}
+
+// Commit commits a transaction
+func (m *Manager) Commit(id, owner string) error {
+	return m.finish(id, owner, true)
+}
+
+// Rollback rolls back a transaction
+func (m *Manager) Rollback(id, owner string) error {
+	return m.finish(id, owner, false)
+}
+
+// RollbackOwner rolls back every transaction owned by owner, e.g. after its
+// client disconnected. It returns the number of transactions rolled back.
+func (m *Manager) RollbackOwner(owner string) int {
+	count := 0
+	for _, conn := range m.List() {
+		for _, info := range conn.Transactions() {
+			if info.Owner != owner {
+				continue
+			}
+			if err := m.finish(info.ID, owner, false); err != nil {
+				m.logger.Warn("Failed to roll back abandoned transaction",
+					zap.String("transaction_id", info.ID), zap.Error(err))
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// HasTransactions reports whether owner has any open transaction. It does
+// not wait for running statements.
+func (m *Manager) HasTransactions(owner string) bool {
+	for _, conn := range m.List() {
+		conn.mu.RLock()
+		for _, t := range conn.txs {
+			if t.owner == owner {
+				conn.mu.RUnlock()
+				return true
+			}
+		}
+		conn.mu.RUnlock()
+	}
+	return false
+}
+
+// Savepoint sets a savepoint in a transaction
+func (m *Manager) Savepoint(ctx context.Context, id, owner, name string) (TransactionInfo, error) {
+	return m.savepoint(ctx, id, owner, name, "SAVEPOINT ", func(points []string, i int) []string {
+		return append(points, name)
+	})
+}
+
+// RollbackTo rolls a transaction back to a savepoint, which stays set
+func (m *Manager) RollbackTo(ctx context.Context, id, owner, name string) (TransactionInfo, error) {
+	return m.savepoint(ctx, id, owner, name, "ROLLBACK TO SAVEPOINT ", func(points []string, i int) []string {
+		return points[:i+1]
+	})
+}
+
+// Release releases a savepoint and every savepoint set after it
+func (m *Manager) Release(ctx context.Context, id, owner, name string) (TransactionInfo, error) {
+	return m.savepoint(ctx, id, owner, name, "RELEASE SAVEPOINT ", func(points []string, i int) []string {
+		return points[:i]
+	})
+}
+
+// savepoint runs a savepoint statement and updates the savepoint stack
+func (m *Manager) savepoint(ctx context.Context, id, owner, name, stmt string, update func([]string, int) []string) (TransactionInfo, error) {
+	if !savepointPattern.MatchString(name) {
+		return TransactionInfo{}, fmt.Errorf("%w: invalid savepoint name %q", ErrInvalidTransaction, name)
+	}
+	_, t, err := m.transaction(id, owner)
+	if err != nil {
+		return TransactionInfo{}, err
+	}
+
+	t.mu.Lock()
+	// Savepoints other than new ones must exist; the innermost one of a name wins
+	index := -1
+	for i, point := range t.info.Savepoints {
+		if point == name {
+			index = i
+		}
+	}
+	if index < 0 && stmt != "SAVEPOINT " {
+		t.mu.Unlock()
+		return TransactionInfo{}, fmt.Errorf("%w: unknown savepoint %q", ErrInvalidTransaction, name)
+	}
+	if _, err := t.tx.ExecContext(ctx, stmt+name); err != nil {
+		t.mu.Unlock()
+		return TransactionInfo{}, err
+	}
+	t.infoMu.Lock()
+	t.info.Savepoints = update(t.info.Savepoints, index)
+	t.infoMu.Unlock()
+	t.mu.Unlock()
+
+	return t.Info(), nil
+}
+
+// transaction finds a transaction owned by owner
+func (m *Manager) transaction(id, owner string) (*Connection, *Transaction, error) {
+	for _, conn := range m.List() {
+		conn.mu.RLock()
+		t, ok := conn.txs[id]
+		conn.mu.RUnlock()
+		if ok && t.owner == owner {
+			return conn, t, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, id)
+}
+
+// finish commits or rolls back a transaction and forgets it
+func (m *Manager) finish(id, owner string, commit bool) error {
+	conn, t, err := m.transaction(id, owner)
+	if err != nil {
+		return err
+	}
+
+	conn.mu.Lock()
+	delete(conn.txs, id)
+	conn.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	action := "rolled back"
+	if commit {
+		action = "committed"
+		err = t.tx.Commit()
+	} else {
+		err = t.tx.Rollback()
+	}
+	if errors.Is(err, sql.ErrTxDone) && !commit {
+		// Already rolled back because its context ended
+		err = nil
+	}
+
+	m.logger.Info("Transaction "+action,
+		zap.String("connection_id", conn.ID),
+		zap.String("transaction_id", id),
+		zap.Int("statements", t.info.Statements),
+		zap.Error(err),
+	)
+	return err
+}
+
+// Transactions describes the open transactions of the connection, oldest first
+func (c *Connection) Transactions() []TransactionInfo {
+	c.mu.RLock()
+	txs := make([]*Transaction, 0, len(c.txs))
+	for _, t := range c.txs {
+		txs = append(txs, t)
+	}
+	c.mu.RUnlock()
+
+	infos := make([]TransactionInfo, len(txs))
+	for i, t := range txs {
+		infos[i] = t.Info()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.Before(infos[j].StartedAt) })
+	return infos
+}
+
+// rollbackAll rolls back every open transaction of the connection
+func (c *Connection) rollbackAll() {
+	c.mu.Lock()
+	txs := c.txs
+	c.txs = nil
+	c.mu.Unlock()
+
+	for _, t := range txs {
+		t.mu.Lock()
+		t.tx.Rollback()
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,512 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Kind says how the values of a result column are encoded. Text, integer,
+// float, boolean, binary, timestamp, date, time and array values use the
+// matching msgpack type; the other kinds are sent as tagged maps whose
+// "$type" key holds the kind. Values that cannot be read as their column's
+// kind are sent as they came from the driver.
+type Kind string
+
+// Column kinds
+const (
+	KindAny         Kind = "any" // Each value has its own type, as in SQLite expressions
+	KindText        Kind = "text"
+	KindInteger     Kind = "integer"
+	KindFloat       Kind = "float"
+	KindBoolean     Kind = "boolean"
+	KindBinary      Kind = "binary"
+	KindTimestamp   Kind = "timestamp" // Without a zone
+	KindDate        Kind = "date"      // Midnight UTC of the day
+	KindTime        Kind = "time"      // Time of day as text, with its offset if it has one
+	KindArray       Kind = "array"     // Elements of Column.Element, nested for more dimensions
+	KindDecimal     Kind = "decimal"
+	KindTimestampTZ Kind = "timestamptz"
+	KindInterval    Kind = "interval"
+	KindJSON        Kind = "json"
+	KindUUID        Kind = "uuid"
+	KindNetwork     Kind = "network" // inet, cidr and MAC addresses
+	KindBit         Kind = "bit"
+	KindGeometry    Kind = "geometry"
+	KindTruncated   Kind = "truncated" // Only as the tag of a cut-off value
+)
+
+// Decimal is an exact numeric value
+type Decimal struct {
+	Type  Kind   `msgpack:"$type"`
+	Value string `msgpack:"value"` // Digits as the database printed them, e.g. "-12.50"
+}
+
+// TimestampTZ is a point in time with the UTC offset it was given in
+type TimestampTZ struct {
+	Type   Kind      `msgpack:"$type"`
+	Value  time.Time `msgpack:"value"`
+	Offset int       `msgpack:"offset"` // Seconds east of UTC
+}
+
+// Interval is a PostgreSQL interval. Months and days are kept apart from
+// the time, since their length varies.
+type Interval struct {
+	Type         Kind   `msgpack:"$type"`
+	Months       int64  `msgpack:"months"`
+	Days         int64  `msgpack:"days"`
+	Microseconds int64  `msgpack:"microseconds"`
+	Value        string `msgpack:"value"` // As the database printed it
+}
+
+// JSON is a JSON document as text, so numbers keep their precision
+type JSON struct {
+	Type  Kind   `msgpack:"$type"`
+	Value string `msgpack:"value"`
+}
+
+// UUID is a UUID in its canonical text form
+type UUID struct {
+	Type  Kind   `msgpack:"$type"`
+	Value string `msgpack:"value"`
+}
+
+// Network is an IP address, network or MAC address
+type Network struct {
+	Type  Kind   `msgpack:"$type"`
+	Value string `msgpack:"value"`
+}
+
+// Bit is a bit string of '0' and '1' characters
+type Bit struct {
+	Type  Kind   `msgpack:"$type"`
+	Value string `msgpack:"value"`
+}
+
+// Geometry is a spatial value as well-known binary
+type Geometry struct {
+	Type Kind   `msgpack:"$type"`
+	SRID uint32 `msgpack:"srid"`
+	WKB  []byte `msgpack:"wkb"`
+}
+
+// Truncated is the start of a text, binary or JSON value larger than the
+// max_value_size limit
+type Truncated struct {
+	Type  Kind        `msgpack:"$type"`
+	Kind  Kind        `msgpack:"kind"`          // Kind of the full value: text, binary or json
+	Value interface{} `msgpack:"value"`         // Leading bytes, cut at a character boundary for text
+	Size  int64       `msgpack:"size"`          // Bytes in the full value
+	Ref   string      `msgpack:"ref,omitempty"` // Fetches the full value with value_fetch; empty if it was not kept
+}
+
+// Tagged is implemented by the values sent as tagged maps
+type Tagged interface {
+	// Scalar returns a plain value that stands in for the tagged value when
+	// spooled rows are sorted or filtered, or a result is compared
+	Scalar() interface{}
+}
+
+// Scalar implements Tagged, so decimals sort as numbers
+func (d Decimal) Scalar() interface{} {
+	if f, err := strconv.ParseFloat(d.Value, 64); err == nil {
+		return f
+	}
+	return d.Value
+}
+
+// Scalar implements Tagged
+func (t TimestampTZ) Scalar() interface{} {
+	return t.Value
+}
+
+// Scalar implements Tagged with the length in microseconds. Months count as
+// 30 days, as PostgreSQL does when comparing intervals.
+func (i Interval) Scalar() interface{} {
+	return (i.Months*30+i.Days)*int64(24*time.Hour/time.Microsecond) + i.Microseconds
+}
+
+// Scalar implements Tagged
+func (j JSON) Scalar() interface{} {
+	return j.Value
+}
+
+// Scalar implements Tagged
+func (u UUID) Scalar() interface{} {
+	return u.Value
+}
+
+// Scalar implements Tagged
+func (n Network) Scalar() interface{} {
+	return n.Value
+}
+
+// Scalar implements Tagged
+func (b Bit) Scalar() interface{} {
+	return b.Value
+}
+
+// Scalar implements Tagged
+func (g Geometry) Scalar() interface{} {
+	return g.WKB
+}
+
+// Scalar implements Tagged with the leading part of the value
+func (t Truncated) Scalar() interface{} {
+	return t.Value
+}
+
+// ValueKeeper keeps the full form of truncated values and returns a
+// reference that only owner can fetch them by
+type ValueKeeper interface {
+	Keep(owner, kind string, data []byte) (string, error)
+}
+
+// fetchOptions controls how rows are read and encoded
+type fetchOptions struct {
+	driver   string
+	maxRows  int
+	maxValue int         // Larger text, binary and JSON values are truncated; zero keeps them whole
+	keeper   ValueKeeper // Keeps truncated values; nil drops them
+	owner    string      // Session the kept values belong to
+	cancel   bool        // Cancel the statement at maxRows rather than drain it
+}
+
+// codec converts the values of one result column
+type codec struct {
+	kind    Kind
+	element Kind // For arrays
+	packed  bool // Bit values arrive as bytes rather than digits (MySQL)
+	text    bool // Values are PostgreSQL text output, as array elements are
+}
+
+// columnCodec chooses how the values of a column are encoded
+func columnCodec(driverName string, t *sql.ColumnType) codec {
+	name := strings.ToUpper(t.DatabaseTypeName())
+	switch driverName {
+	case DriverPostgres:
+		if strings.HasPrefix(name, "_") {
+			element := postgresKind(name[1:])
+			if name == "_BOX" {
+				// Box arrays use ';' between elements
+				return codec{kind: KindText}
+			}
+			return codec{kind: KindArray, element: element}
+		}
+		return codec{kind: postgresKind(name)}
+	case DriverMySQL:
+		return codec{kind: mysqlKind(name), packed: true}
+	default:
+		return codec{kind: sqliteKind(name)}
+	}
+}
+
+// postgresKind maps a PostgreSQL type name. Types without a fixed ID, such
+// as hstore or PostGIS geometry, have no name and arrive as text.
+func postgresKind(name string) Kind {
+	switch name {
+	case "INT2", "INT4", "INT8", "OID":
+		return KindInteger
+	case "FLOAT4", "FLOAT8":
+		return KindFloat
+	case "NUMERIC":
+		return KindDecimal
+	case "BOOL":
+		return KindBoolean
+	case "BYTEA":
+		return KindBinary
+	case "TIMESTAMP":
+		return KindTimestamp
+	case "TIMESTAMPTZ":
+		return KindTimestampTZ
+	case "DATE":
+		return KindDate
+	case "TIME", "TIMETZ":
+		return KindTime
+	case "INTERVAL":
+		return KindInterval
+	case "JSON", "JSONB":
+		return KindJSON
+	case "UUID":
+		return KindUUID
+	case "INET", "CIDR", "MACADDR", "MACADDR8":
+		return KindNetwork
+	case "BIT", "VARBIT":
+		return KindBit
+	default:
+		return KindText
+	}
+}
+
+// mysqlKind maps a MySQL type name
+func mysqlKind(name string) Kind {
+	name = strings.TrimPrefix(name, "UNSIGNED ")
+	switch name {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return KindInteger
+	case "FLOAT", "DOUBLE":
+		return KindFloat
+	case "DECIMAL":
+		return KindDecimal
+	case "DATE":
+		return KindDate
+	case "DATETIME", "TIMESTAMP":
+		return KindTimestamp
+	case "TIME":
+		return KindTime
+	case "JSON":
+		return KindJSON
+	case "BIT":
+		return KindBit
+	case "GEOMETRY":
+		return KindGeometry
+	case "NULL":
+		return KindAny
+	}
+	if isBinaryType(name) {
+		return KindBinary
+	}
+	return KindText
+}
+
+// sqliteKind maps a declared SQLite column type using SQLite's affinity
+// rules. Expressions have no declared type.
+func sqliteKind(name string) Kind {
+	name, _, _ = strings.Cut(name, "(")
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return KindAny
+	case name == "BOOLEAN" || name == "BOOL":
+		return KindBoolean
+	case name == "DATE":
+		return KindDate
+	case name == "DATETIME" || name == "TIMESTAMP":
+		return KindTimestamp
+	case name == "JSON":
+		return KindJSON
+	case name == "UUID":
+		return KindUUID
+	case strings.Contains(name, "INT"):
+		return KindInteger
+	case strings.Contains(name, "CHAR"), strings.Contains(name, "CLOB"), strings.Contains(name, "TEXT"):
+		return KindText
+	case strings.Contains(name, "BLOB"):
+		return KindBinary
+	case strings.Contains(name, "REAL"), strings.Contains(name, "FLOA"), strings.Contains(name, "DOUB"):
+		return KindFloat
+	case name == "DECIMAL" || name == "NUMERIC":
+		return KindDecimal
+	default:
+		return KindAny
+	}
+}
+
+// convert encodes a scanned value for the wire
+func (c codec) convert(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if c.kind == KindArray {
+		if text, ok := textOf(v); ok {
+			if elements, ok := parsePostgresArray(text); ok {
+				return convertElements(elements, codec{kind: c.element, text: true})
+			}
+		}
+		return convertValue(v, false)
+	}
+	if out, ok := c.convertKind(v); ok {
+		return out
+	}
+	return convertValue(v, c.kind == KindBinary)
+}
+
+// convertElements converts the text elements of a parsed array
+func convertElements(elements []interface{}, c codec) []interface{} {
+	for i, e := range elements {
+		switch e := e.(type) {
+		case []interface{}:
+			elements[i] = convertElements(e, c)
+		case string:
+			elements[i] = c.convert(e)
+		}
+	}
+	return elements
+}
+
+// convertKind converts v to the codec's kind, reporting whether it could
+func (c codec) convertKind(v interface{}) (interface{}, bool) {
+	text, isText := textOf(v)
+	switch c.kind {
+	case KindInteger:
+		if !isText {
+			return nil, false
+		}
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, true
+		}
+		if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return n, true
+		}
+	case KindFloat:
+		if isText {
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f, true
+			}
+		}
+	case KindBoolean:
+		if n, ok := v.(int64); ok {
+			return n != 0, true
+		}
+		if c.text && (text == "t" || text == "f") {
+			return text == "t", true
+		}
+	case KindBinary:
+		// PostgreSQL's hex output; the escape format is left as text
+		if c.text && strings.HasPrefix(text, `\x`) {
+			if b, err := hex.DecodeString(text[2:]); err == nil {
+				return b, true
+			}
+		}
+	case KindDecimal:
+		switch n := v.(type) {
+		case int64:
+			return Decimal{Type: KindDecimal, Value: strconv.FormatInt(n, 10)}, true
+		case float64:
+			return Decimal{Type: KindDecimal, Value: strconv.FormatFloat(n, 'f', -1, 64)}, true
+		}
+		if isText {
+			return Decimal{Type: KindDecimal, Value: text}, true
+		}
+	case KindTimestamp, KindDate:
+		if isText {
+			for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+				if t, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+					return t, true
+				}
+			}
+		}
+	case KindTimestampTZ:
+		if t, ok := v.(time.Time); ok {
+			_, offset := t.Zone()
+			return TimestampTZ{Type: KindTimestampTZ, Value: t, Offset: offset}, true
+		}
+		if c.text && isText {
+			// PostgreSQL leaves out the minutes and seconds of the offset when zero
+			for _, layout := range []string{"2006-01-02 15:04:05.999999999Z07", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z07:00:00"} {
+				if t, err := time.Parse(layout, text); err == nil {
+					_, offset := t.Zone()
+					return TimestampTZ{Type: KindTimestampTZ, Value: t, Offset: offset}, true
+				}
+			}
+		}
+	case KindTime:
+		if t, ok := v.(time.Time); ok {
+			if t.Location() == time.UTC {
+				return t.Format("15:04:05.999999"), true
+			}
+			return t.Format("15:04:05.999999Z07:00"), true
+		}
+	case KindInterval:
+		if isText {
+			if i, ok := parsePostgresInterval(text); ok {
+				return i, true
+			}
+		}
+	case KindJSON:
+		if isText {
+			return JSON{Type: KindJSON, Value: text}, true
+		}
+	case KindUUID:
+		if b, ok := v.([]byte); ok && len(b) == 16 {
+			h := hex.EncodeToString(b)
+			return UUID{Type: KindUUID, Value: h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]}, true
+		}
+		if isText {
+			return UUID{Type: KindUUID, Value: text}, true
+		}
+	case KindNetwork:
+		if isText {
+			return Network{Type: KindNetwork, Value: text}, true
+		}
+	case KindBit:
+		if b, ok := v.([]byte); ok && c.packed {
+			var s strings.Builder
+			for _, octet := range b {
+				s.WriteString(strconv.FormatUint(uint64(octet)|0x100, 2)[1:])
+			}
+			return Bit{Type: KindBit, Value: s.String()}, true
+		}
+		if isText {
+			return Bit{Type: KindBit, Value: text}, true
+		}
+	case KindGeometry:
+		// MySQL stores a little-endian SRID before the well-known binary
+		if b, ok := v.([]byte); ok && len(b) >= 4 {
+			return Geometry{Type: KindGeometry, SRID: binary.LittleEndian.Uint32(b), WKB: append([]byte(nil), b[4:]...)}, true
+		}
+	}
+	return nil, false
+}
+
+// textOf returns v as text if the driver sent it as text or bytes
+func textOf(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v), true
+		}
+	}
+	return "", false
+}
+
+// truncate cuts a converted value down to fetch.maxValue bytes, keeping
+// the full value with the keeper
+func (f fetchOptions) truncate(v interface{}) interface{} {
+	if f.maxValue <= 0 {
+		return v
+	}
+	var kind Kind
+	var data []byte
+	switch t := v.(type) {
+	case string:
+		if len(t) <= f.maxValue {
+			return v
+		}
+		kind, data = KindText, []byte(t)
+	case []byte:
+		if len(t) <= f.maxValue {
+			return v
+		}
+		kind, data = KindBinary, t
+	case JSON:
+		if len(t.Value) <= f.maxValue {
+			return v
+		}
+		kind, data = KindJSON, []byte(t.Value)
+	default:
+		return v
+	}
+
+	out := Truncated{Type: KindTruncated, Kind: kind, Size: int64(len(data))}
+	if kind == KindBinary {
+		out.Value = append([]byte(nil), data[:f.maxValue]...)
+	} else {
+		end := f.maxValue
+		for end > 0 && !utf8.RuneStart(data[end]) {
+			end--
+		}
+		out.Value = string(data[:end])
+	}
+	if f.keeper != nil {
+		// A value that cannot be kept is still sent cut off, without a ref
+		out.Ref, _ = f.keeper.Keep(f.owner, string(kind), data)
+	}
+	return out
+}
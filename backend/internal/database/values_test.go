@@ -0,0 +1,153 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sameValue compares converted values, treating times in equal instants
+// and offsets as equal whatever their *time.Location
+func sameValue(got, want interface{}) bool {
+	switch w := want.(type) {
+	case time.Time:
+		g, ok := got.(time.Time)
+		return ok && g.Equal(w)
+	case TimestampTZ:
+		g, ok := got.(TimestampTZ)
+		return ok && g.Type == w.Type && g.Value.Equal(w.Value) && g.Offset == w.Offset
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !sameValue(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestConvert(t *testing.T) {
+	date := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05.999", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tz := func(s string, offset int) TimestampTZ {
+		return TimestampTZ{Type: KindTimestampTZ, Value: date(s).Add(-time.Duration(offset) * time.Second), Offset: offset}
+	}
+
+	tests := []struct {
+		name  string
+		codec codec
+		in    interface{}
+		want  interface{}
+	}{
+		{"integer text", codec{kind: KindInteger}, []byte("42"), int64(42)},
+		{"unsigned beyond int64", codec{kind: KindInteger}, "18446744073709551615", uint64(18446744073709551615)},
+		{"float text", codec{kind: KindFloat}, "1.5", 1.5},
+		{"boolean integer", codec{kind: KindBoolean}, int64(1), true},
+		{"boolean driver value", codec{kind: KindBoolean}, false, false},
+		{"boolean text outside arrays", codec{kind: KindBoolean}, "t", "t"},
+		{"decimal", codec{kind: KindDecimal}, []byte("12.50"), Decimal{Type: KindDecimal, Value: "12.50"}},
+		{"timestamp", codec{kind: KindTimestamp}, "2024-01-02 03:04:05.123", date("2024-01-02 03:04:05.123")},
+		{"date", codec{kind: KindDate}, "2024-01-02", date("2024-01-02 00:00:00")},
+		{"timestamptz driver value", codec{kind: KindTimestampTZ}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 7200)), tz("2024-01-02 03:04:05", 7200)},
+		{"time", codec{kind: KindTime}, time.Date(0, 1, 1, 10, 30, 0, 0, time.UTC), "10:30:00"},
+		{"json", codec{kind: KindJSON}, []byte(`{"a":1}`), JSON{Type: KindJSON, Value: `{"a":1}`}},
+		{"uuid bytes", codec{kind: KindUUID}, []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}, UUID{Type: KindUUID, Value: "123e4567-e89b-12d3-a456-426614174000"}},
+		{"packed bit", codec{kind: KindBit, packed: true}, []byte{0x05}, Bit{Type: KindBit, Value: "00000101"}},
+		// Raw bytes that happen to look like the hex output stay bytes
+		{"binary", codec{kind: KindBinary}, []byte(`\x41`), []byte(`\x41`)},
+		{"unreadable value", codec{kind: KindInteger}, "abc", "abc"},
+		{"text", codec{kind: KindText}, []byte("héllo"), "héllo"},
+		{"null", codec{kind: KindText}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.codec.convert(tt.in); !sameValue(got, tt.want) {
+				t.Errorf("convert(%#v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		element Kind
+		in      string
+		want    []interface{}
+	}{
+		{"integers", KindInteger, "{1,NULL,3}", []interface{}{int64(1), nil, int64(3)}},
+		{"nested", KindInteger, "{{1,2},{3,4}}", []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{int64(3), int64(4)}}},
+		{"text", KindText, `{a,"b c",NULL}`, []interface{}{"a", "b c", nil}},
+		{"booleans", KindBoolean, "{t,f,NULL}", []interface{}{true, false, nil}},
+		{"bytea", KindBinary, `{"\\x0102ff",NULL}`, []interface{}{[]byte{0x01, 0x02, 0xff}, nil}},
+		{"dates", KindDate, "{2024-01-02,NULL}", []interface{}{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), nil}},
+		{"timestamps", KindTimestamp, `{"2024-01-02 03:04:05.5"}`, []interface{}{time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC)}},
+		{"timestamptz", KindTimestampTZ, `{"2024-01-02 03:04:05.123+02","2024-01-02 03:04:05+05:30","1890-01-01 00:00:00+00:53:28"}`, []interface{}{
+			TimestampTZ{Type: KindTimestampTZ, Value: time.Date(2024, 1, 2, 1, 4, 5, 123e6, time.UTC), Offset: 7200},
+			TimestampTZ{Type: KindTimestampTZ, Value: time.Date(2024, 1, 1, 21, 34, 5, 0, time.UTC), Offset: 19800},
+			TimestampTZ{Type: KindTimestampTZ, Value: time.Date(1889, 12, 31, 23, 6, 32, 0, time.UTC), Offset: 3208},
+		}},
+		{"intervals", KindInterval, `{"1 day"}`, []interface{}{Interval{Type: KindInterval, Days: 1, Value: "1 day"}}},
+		{"unreadable element", KindBoolean, "{maybe}", []interface{}{"maybe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := codec{kind: KindArray, element: tt.element}
+			if got := c.convert([]byte(tt.in)); !sameValue(got, tt.want) {
+				t.Errorf("convert(%s) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// keeper records the values it keeps
+type keeper struct {
+	owner, kind, data string
+}
+
+func (k *keeper) Keep(owner, kind string, data []byte) (string, error) {
+	k.owner, k.kind, k.data = owner, kind, string(data)
+	return "val_1", nil
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxValue int
+		in       interface{}
+		want     interface{}
+	}{
+		{"whole without a limit", 0, strings.Repeat("a", 100), strings.Repeat("a", 100)},
+		{"short text", 4, "abcd", "abcd"},
+		{"long text", 4, "abcdef", Truncated{Type: KindTruncated, Kind: KindText, Value: "abcd", Size: 6, Ref: "val_1"}},
+		// "é" takes two bytes and would be split at four
+		{"text cut at a character boundary", 4, "abcé", Truncated{Type: KindTruncated, Kind: KindText, Value: "abc", Size: 5, Ref: "val_1"}},
+		{"binary", 2, []byte{1, 2, 3}, Truncated{Type: KindTruncated, Kind: KindBinary, Value: []byte{1, 2}, Size: 3, Ref: "val_1"}},
+		{"json", 3, JSON{Type: KindJSON, Value: `{"a":1}`}, Truncated{Type: KindTruncated, Kind: KindJSON, Value: `{"a`, Size: 7, Ref: "val_1"}},
+		{"other kinds stay whole", 1, int64(123456), int64(123456)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &keeper{}
+			f := fetchOptions{maxValue: tt.maxValue, keeper: k, owner: "sess_1"}
+			got := f.truncate(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("truncate = %#v, want %#v", got, tt.want)
+			}
+			if _, ok := tt.want.(Truncated); ok && k.owner != "sess_1" {
+				t.Errorf("value kept for %q, want sess_1", k.owner)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+// Package fanout runs one query against many connections concurrently,
+// reporting each connection's outcome as it completes.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for unknown or finished fan-outs, fan-outs owned
+	// by another session and connections that are not part of a fan-out
+	ErrNotFound = errors.New("fan-out not found")
+	// ErrInvalid is returned for malformed fan-out requests
+	ErrInvalid = errors.New("invalid fan-out request")
+)
+
+const (
+	// DefaultParallelism is the number of connections queried at once when
+	// the request does not say
+	DefaultParallelism = 4
+	// MaxParallelism caps the connections queried at once
+	MaxParallelism = 32
+	// MaxTargets caps the connections of one fan-out
+	MaxTargets = 256
+	// DefaultMaxRows caps the rows returned per connection when neither the
+	// request nor the connection sets max_rows
+	DefaultMaxRows = 1000
+)
+
+// Outcomes of one connection
+const (
+	StatusOK        = "ok"
+	StatusFailed    = "error"
+	StatusCancelled = "cancelled" // Cancelled while running or before it started
+)
+
+// Exec runs the query on one connection
+type Exec func(ctx context.Context, connectionID string) (*database.Result, error)
+
+// Outcome is the result of the query on one connection
+type Outcome struct {
+	FanoutID     string
+	ConnectionID string
+	Status       string
+	Result       *database.Result // Set when the query succeeded
+	Err          error            // Set when it failed or was cancelled
+	DurationMs   int64
+}
+
+// ConnectionSummary is the outcome of one connection in a summary
+type ConnectionSummary struct {
+	ConnectionID string `msgpack:"connection_id"`
+	Status       string `msgpack:"status"`
+	Rows         int64  `msgpack:"rows"` // Rows returned or affected
+	Error        string `msgpack:"error"`
+	DurationMs   int64  `msgpack:"duration_ms"`
+}
+
+// Summary aggregates the outcomes of a fan-out
+type Summary struct {
+	FanoutID    string              `msgpack:"fanout_id"`
+	Total       int                 `msgpack:"total"`
+	Succeeded   int                 `msgpack:"succeeded"`
+	Failed      int                 `msgpack:"failed"`
+	Cancelled   int                 `msgpack:"cancelled"`
+	DurationMs  int64               `msgpack:"duration_ms"` // Wall time of the whole fan-out
+	MinMs       int64               `msgpack:"min_ms"`      // Timings of the connections the query ran on
+	MaxMs       int64               `msgpack:"max_ms"`
+	AvgMs       int64               `msgpack:"avg_ms"`
+	Slowest     string              `msgpack:"slowest"` // Connection ID
+	Connections []ConnectionSummary `msgpack:"connections"`
+}
+
+// Info describes a running fan-out
+type Info struct {
+	ID            string    `msgpack:"id"`
+	ConnectionIDs []string  `msgpack:"connection_ids"`
+	Parallelism   int       `msgpack:"parallelism"`
+	StartedAt     time.Time `msgpack:"started_at"`
+}
+
+// run is a fan-out in progress
+type run struct {
+	info    Info
+	owner   string
+	cancel  context.CancelFunc
+	targets map[string]context.CancelFunc // By connection ID
+}
+
+// Manager tracks the running fan-outs so they can be cancelled
+type Manager struct {
+	logger logger.Logger
+	ctx    context.Context // Parent of every fan-out
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	runs map[string]*run
+	wg   sync.WaitGroup
+}
+
+// NewManager creates a fan-out manager
+func NewManager(log logger.Logger) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		logger: log,
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[string]*run),
+	}
+}
+
+// Prepare checks a fan-out and registers it for owner. Nothing runs until
+// the returned start function is called; report then receives each outcome
+// as it completes, concurrently, and done the summary once all have.
+func (m *Manager) Prepare(owner string, connectionIDs []string, parallelism int, exec Exec, report func(Outcome), done func(Summary)) (Info, func(), error) {
+	if len(connectionIDs) == 0 || len(connectionIDs) > MaxTargets {
+		return Info{}, nil, fmt.Errorf("%w: between 1 and %d connection IDs are required", ErrInvalid, MaxTargets)
+	}
+	seen := make(map[string]bool, len(connectionIDs))
+	for i, id := range connectionIDs {
+		if id == "" || seen[id] {
+			return Info{}, nil, fmt.Errorf("%w: connection_ids[%d] is empty or repeated", ErrInvalid, i)
+		}
+		seen[id] = true
+	}
+	if parallelism == 0 {
+		parallelism = DefaultParallelism
+	}
+	if parallelism < 1 || parallelism > MaxParallelism {
+		return Info{}, nil, fmt.Errorf("%w: parallelism must be between 1 and %d", ErrInvalid, MaxParallelism)
+	}
+	if parallelism > len(connectionIDs) {
+		parallelism = len(connectionIDs)
+	}
+
+	runID, err := ids.New("fan_")
+	if err != nil {
+		return Info{}, nil, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	r := &run{
+		info: Info{
+			ID:            runID,
+			ConnectionIDs: connectionIDs,
+			Parallelism:   parallelism,
+			StartedAt:     time.Now(),
+		},
+		owner:   owner,
+		cancel:  cancel,
+		targets: make(map[string]context.CancelFunc, len(connectionIDs)),
+	}
+	targetCtx := make(map[string]context.Context, len(connectionIDs))
+	for _, id := range connectionIDs {
+		targetCtx[id], r.targets[id] = context.WithCancel(ctx)
+	}
+
+	m.mu.Lock()
+	m.runs[r.info.ID] = r
+	m.mu.Unlock()
+	m.wg.Add(1)
+
+	start := func() {
+		go func() {
+			defer m.wg.Done()
+			defer m.forget(r)
+			done(m.execute(r, targetCtx, exec, report))
+		}()
+	}
+	return r.info, start, nil
+}
+
+// execute runs the query on every connection of r and summarizes the outcomes
+func (m *Manager) execute(r *run, targetCtx map[string]context.Context, exec Exec, report func(Outcome)) Summary {
+	m.logger.Info("Fan-out started",
+		zap.String("fanout_id", r.info.ID),
+		zap.Int("connections", len(r.info.ConnectionIDs)),
+		zap.Int("parallelism", r.info.Parallelism),
+	)
+
+	outcomes := make([]Outcome, len(r.info.ConnectionIDs))
+	sem := make(chan struct{}, r.info.Parallelism)
+	var wg sync.WaitGroup
+	for i, id := range r.info.ConnectionIDs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i] = runOne(targetCtx[id], r.info.ID, id, exec)
+			report(outcomes[i])
+			// The summary only needs the row count
+			if res := outcomes[i].Result; res != nil {
+				outcomes[i].Result = &database.Result{RowsAffected: res.RowsAffected}
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	summary := summarize(r, outcomes)
+	m.logger.Info("Fan-out finished",
+		zap.String("fanout_id", r.info.ID),
+		zap.Int("succeeded", summary.Succeeded),
+		zap.Int("failed", summary.Failed),
+		zap.Int("cancelled", summary.Cancelled),
+	)
+	return summary
+}
+
+// runOne runs the query on one connection unless it was cancelled first
+func runOne(ctx context.Context, fanoutID, connectionID string, exec Exec) Outcome {
+	o := Outcome{FanoutID: fanoutID, ConnectionID: connectionID}
+	if err := ctx.Err(); err != nil {
+		o.Status, o.Err = StatusCancelled, err
+		return o
+	}
+
+	start := time.Now()
+	res, err := exec(ctx, connectionID)
+	o.DurationMs = time.Since(start).Milliseconds()
+	switch {
+	case err != nil && ctx.Err() != nil:
+		o.Status, o.Err = StatusCancelled, err
+	case err != nil:
+		o.Status, o.Err = StatusFailed, err
+	default:
+		o.Status, o.Result = StatusOK, res
+	}
+	return o
+}
+
+// summarize aggregates the outcomes of r
+func summarize(r *run, outcomes []Outcome) Summary {
+	s := Summary{
+		FanoutID:    r.info.ID,
+		Total:       len(outcomes),
+		DurationMs:  time.Since(r.info.StartedAt).Milliseconds(),
+		Connections: make([]ConnectionSummary, len(outcomes)),
+	}
+	var ran int
+	var total int64
+	for i, o := range outcomes {
+		cs := ConnectionSummary{ConnectionID: o.ConnectionID, Status: o.Status, DurationMs: o.DurationMs}
+		switch o.Status {
+		case StatusOK:
+			s.Succeeded++
+			cs.Rows = o.Result.RowsAffected
+		case StatusFailed:
+			s.Failed++
+		case StatusCancelled:
+			s.Cancelled++
+		}
+		if o.Err != nil {
+			cs.Error = o.Err.Error()
+		}
+		s.Connections[i] = cs
+
+		// Connections cancelled before they started have no timing
+		if o.Status == StatusCancelled && o.DurationMs == 0 {
+			continue
+		}
+		if ran == 0 || o.DurationMs < s.MinMs {
+			s.MinMs = o.DurationMs
+		}
+		if ran == 0 || o.DurationMs > s.MaxMs {
+			s.MaxMs, s.Slowest = o.DurationMs, o.ConnectionID
+		}
+		total += o.DurationMs
+		ran++
+	}
+	if ran > 0 {
+		s.AvgMs = total / int64(ran)
+	}
+	return s
+}
+
+// Cancel stops a fan-out of owner. With a connection ID only that
+// connection's query is stopped, or skipped if it has not started yet.
+func (m *Manager) Cancel(id, owner, connectionID string) error {
+	m.mu.Lock()
+	r, ok := m.runs[id]
+	m.mu.Unlock()
+	if !ok || r.owner != owner {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	if connectionID == "" {
+		r.cancel()
+	} else {
+		cancel, ok := r.targets[connectionID]
+		if !ok {
+			return fmt.Errorf("%w: %s is not part of %s", ErrNotFound, connectionID, id)
+		}
+		cancel()
+	}
+	m.logger.Info("Fan-out cancelled", zap.String("fanout_id", id), zap.String("connection_id", connectionID))
+	return nil
+}
+
+// CancelOwner stops every fan-out of owner and returns how many there were
+func (m *Manager) CancelOwner(owner string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.runs {
+		if r.owner == owner {
+			r.cancel()
+			n++
+		}
+	}
+	return n
+}
+
+// HasRuns reports whether owner has a fan-out in progress
+func (m *Manager) HasRuns(owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.runs {
+		if r.owner == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// Shutdown cancels every fan-out and waits for them to finish
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// forget unregisters a finished fan-out
+func (m *Manager) forget(r *run) {
+	m.mu.Lock()
+	delete(m.runs, r.info.ID)
+	m.mu.Unlock()
+	r.cancel()
+}
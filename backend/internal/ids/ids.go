@@ -0,0 +1,29 @@
+// Package ids generates the random identifiers handed out by the backend.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// New returns prefix followed by 8 random bytes in hex, such as
+// "conn_1f2e3d4c5b6a7980"
+func New(prefix string) (string, error) {
+	return random(prefix, 8)
+}
+
+// NewToken is New with 16 random bytes, for references that grant access to
+// something and must not be guessed
+func NewToken(prefix string) (string, error) {
+	return random(prefix, 16)
+}
+
+// random returns prefix followed by n random bytes in hex
+func random(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate %sid: %w", prefix, err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
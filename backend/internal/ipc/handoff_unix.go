@@ -0,0 +1,230 @@
+//go:build !windows
+
+package ipc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Handoff protocol messages exchanged over the control socket
+const (
+	handoffRequest = "HANDOFF"
+	handoffReady   = "READY"
+)
+
+// handoffTimeout bounds each step of the handoff exchange
+const handoffTimeout = 10 * time.Second
+
+// handoffPathFor returns the control socket path used to hand over socketPath
+func handoffPathFor(socketPath string) string {
+	return socketPath + ".handoff"
+}
+
+// serveHandoff listens on the control socket and hands the listening socket
+// (and the instance lock) to a newer backend process that asks for it.
+func (s *Server) serveHandoff(socketPath string) {
+	controlPath := handoffPathFor(socketPath)
+
+	// We hold the instance lock, so any existing control socket is stale
+	if err := os.Remove(controlPath); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("Failed to remove stale handoff socket", zap.Error(err))
+		return
+	}
+
+	control, err := net.ListenUnix("unix", &net.UnixAddr{Name: controlPath, Net: "unix"})
+	if err != nil {
+		s.logger.Warn("Failed to create handoff socket, upgrades will drop connections", zap.Error(err))
+		return
+	}
+	if err := os.Chmod(controlPath, 0600); err != nil {
+		s.logger.Warn("Failed to restrict handoff socket permissions", zap.Error(err))
+	}
+
+	go func() {
+		<-s.ctx.Done()
+		control.Close()
+	}()
+
+	for {
+		conn, err := control.AcceptUnix()
+		if err != nil {
+			return
+		}
+
+		handedOff, err := s.handoffTo(conn)
+		conn.Close()
+		if err != nil {
+			s.logger.Error("Listener handoff failed", zap.Error(err))
+			continue
+		}
+		if handedOff {
+			// Leave the control socket file for the new process, which replaces it
+			control.SetUnlinkOnClose(false)
+			control.Close()
+			return
+		}
+	}
+}
+
+// handoffTo sends the listener and lock descriptors to the requesting process
+// and stops accepting once it confirms that it is serving the socket.
+func (s *Server) handoffTo(conn *net.UnixConn) (bool, error) {
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read handoff request: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != handoffRequest {
+		return false, fmt.Errorf("invalid handoff request: %q", strings.TrimSpace(line))
+	}
+
+	unixListener, ok := s.listener.(*net.UnixListener)
+	if !ok {
+		return false, fmt.Errorf("listener does not support handoff")
+	}
+	listenerFile, err := unixListener.File()
+	if err != nil {
+		return false, fmt.Errorf("failed to get listener descriptor: %w", err)
+	}
+	defer listenerFile.Close()
+
+	rights := syscall.UnixRights(int(listenerFile.Fd()), int(s.lock.file.Fd()))
+	if _, _, err := conn.WriteMsgUnix([]byte("OK\n"), rights, nil); err != nil {
+		return false, fmt.Errorf("failed to send descriptors: %w", err)
+	}
+
+	line, err = reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != handoffReady {
+		return false, fmt.Errorf("new backend (pid %s) did not confirm handoff", fields[1])
+	}
+
+	s.logger.Info("Handed listener over to new backend", zap.String("pid", fields[1]))
+
+	// The socket file and lock now belong to the new process
+	unixListener.SetUnlinkOnClose(false)
+	s.lock.handOver()
+	s.markHandedOff()
+	unixListener.Close()
+
+	return true, nil
+}
+
+// receiveHandoff asks the backend currently serving socketPath for its
+// listening socket and instance lock.
+func receiveHandoff(socketPath string) (*net.UnixListener, *instanceLock, func() error, error) {
+	controlPath := handoffPathFor(socketPath)
+
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: controlPath, Net: "unix"})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("no running backend accepts handoff on %s: %w", controlPath, err)
+	}
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+
+	if _, err := fmt.Fprintf(conn, "%s %d\n", handoffRequest, os.Getpid()); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to send handoff request: %w", err)
+	}
+
+	buf := make([]byte, 16)
+	oob := make([]byte, syscall.CmsgSpace(2*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to receive descriptors: %w", err)
+	}
+	if strings.TrimSpace(string(buf[:n])) != "OK" {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("unexpected handoff reply: %q", buf[:n])
+	}
+
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	if len(fds) != 2 {
+		closeFds(fds)
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("expected 2 descriptors, got %d", len(fds))
+	}
+
+	listenerFile := os.NewFile(uintptr(fds[0]), "handoff-listener")
+	listener, err := net.FileListener(listenerFile)
+	listenerFile.Close()
+	if err != nil {
+		syscall.Close(fds[1])
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("received descriptor is not a listener: %w", err)
+	}
+	unixListener, ok := listener.(*net.UnixListener)
+	if !ok {
+		listener.Close()
+		syscall.Close(fds[1])
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("received listener is not a Unix socket")
+	}
+
+	lockFile := os.NewFile(uintptr(fds[1]), lockPathFor(socketPath))
+	lock := &instanceLock{file: lockFile, path: lockFile.Name()}
+
+	// confirm tells the old process to stop accepting once we are serving
+	confirm := func() error {
+		defer conn.Close()
+		if _, err := fmt.Fprintf(conn, "%s\n", handoffReady); err != nil {
+			return fmt.Errorf("failed to confirm handoff: %w", err)
+		}
+		return nil
+	}
+
+	return unixListener, lock, confirm, nil
+}
+
+// parseRights extracts file descriptors from SCM_RIGHTS control messages
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control message: %w", err)
+	}
+
+	var fds []int
+	for _, msg := range msgs {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			closeFds(fds)
+			return nil, fmt.Errorf("failed to parse descriptors: %w", err)
+		}
+		fds = append(fds, rights...)
+	}
+	for _, fd := range fds {
+		syscall.CloseOnExec(fd)
+	}
+	return fds, nil
+}
+
+// closeFds closes raw descriptors received from another process
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+// handOver marks the lock as owned by another process: closing our copy of
+// the descriptor keeps the flock held and the new owner's PID intact.
+func (l *instanceLock) handOver() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Close()
+	l.file = nil
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package ipc
+
+import (
+	"fmt"
+	"net"
+)
+
+// serveHandoff is not supported on Windows
+func (s *Server) serveHandoff(socketPath string) {}
+
+// receiveHandoff is not supported on Windows
+func receiveHandoff(socketPath string) (*net.UnixListener, *instanceLock, func() error, error) {
+	return nil, nil, nil, fmt.Errorf("listener handoff is not supported on Windows")
+}
@@ -0,0 +1,171 @@
+//go:build !windows
+
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// takeoverTimeout bounds how long we wait for a running instance to release the socket
+const takeoverTimeout = 35 * time.Second
+
+// instanceLock is an exclusive flock held next to the socket for the lifetime of the server
+type instanceLock struct {
+	file *os.File
+	path string
+}
+
+// lockPathFor returns the lock file path used for the given socket path
+func lockPathFor(socketPath string) string {
+	return socketPath + ".lock"
+}
+
+// acquireInstanceLock makes sure no other backend is serving socketPath.
+// If one is, it either fails with the conflicting PID or, when takeover is set,
+// asks the running instance to shut down and waits for it to release the lock.
+func acquireInstanceLock(socketPath string, takeover bool) (*instanceLock, error) {
+	lockPath := lockPathFor(socketPath)
+
+	// Detect a live instance by connecting to the socket first
+	live := socketInUse(socketPath)
+	pid := 0
+	if live {
+		pid = readLockPID(lockPath)
+		if !takeover {
+			return nil, conflictError(socketPath, pid)
+		}
+		if err := signalInstance(socketPath, pid); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+
+		// Someone holds the lock but may not be accepting connections yet
+		if !live {
+			pid = readLockPID(lockPath)
+			if !takeover {
+				file.Close()
+				return nil, conflictError(socketPath, pid)
+			}
+			if err := signalInstance(socketPath, pid); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		if err := waitForLock(file, pid); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	lock := &instanceLock{file: file, path: lockPath}
+	if err := lock.writePID(os.Getpid()); err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// writePID records the owning process in the lock file
+func (l *instanceLock) writePID(pid int) error {
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate lock file: %w", err)
+	}
+	if _, err := l.file.WriteAt([]byte(strconv.Itoa(pid)+"\n"), 0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Release drops the lock. The file itself is left in place so that a
+// concurrently starting instance never locks an unlinked inode.
+func (l *instanceLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// socketInUse reports whether something is accepting connections on socketPath
+func socketInUse(socketPath string) bool {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// readLockPID returns the PID stored in the lock file, or 0 if unknown
+func readLockPID(lockPath string) int {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// conflictError describes a running instance that owns the socket
+func conflictError(socketPath string, pid int) error {
+	if pid > 0 {
+		return fmt.Errorf("another backend instance (pid %d) is already serving %s; use -takeover to replace it", pid, socketPath)
+	}
+	return fmt.Errorf("another process is already serving %s", socketPath)
+}
+
+// signalInstance asks the running instance to shut down gracefully
+func signalInstance(socketPath string, pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("cannot take over %s: owning process is unknown", socketPath)
+	}
+	if pid == os.Getpid() {
+		return fmt.Errorf("cannot take over %s: already owned by this process", socketPath)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to signal backend instance (pid %d): %w", pid, err)
+	}
+	return nil
+}
+
+// waitForLock polls the lock until the previous owner has exited
+func waitForLock(file *os.File, pid int) error {
+	deadline := time.Now().Add(takeoverTimeout)
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return fmt.Errorf("failed to lock %s: %w", file.Name(), err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("backend instance (pid %d) did not release the socket within %s", pid, takeoverTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package ipc
+
+// instanceLock is a no-op on Windows, where the listener is not a socket file
+type instanceLock struct{}
+
+// acquireInstanceLock is not needed on Windows
+func acquireInstanceLock(socketPath string, takeover bool) (*instanceLock, error) {
+	return &instanceLock{}, nil
+}
+
+// Release is a no-op on Windows
+func (l *instanceLock) Release() error {
+	return nil
+}
+
+// writePID is a no-op on Windows
+func (l *instanceLock) writePID(pid int) error {
+	return nil
+}
@@ -3,12 +3,15 @@ package ipc
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"litebase-backend/internal/logger"
@@ -20,26 +23,52 @@ import (
 
 // Server represents an IPC server
 type Server struct {
-	config   *Config
-	listener net.Listener
-	logger   logger.Logger
-	handlers map[protocol.MessageType]MessageHandler
-	ctx      context.Context
-	cancel   context.CancelFunc
+	config     *Config
+	listener   net.Listener
+	socketPath string
+	lock       *instanceLock
+	logger     logger.Logger
+	handlers   map[protocol.MessageType]MessageHandler
+	limits     atomic.Pointer[Limits]
+	ready      chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	sessionsMu sync.Mutex
+	sessions   map[string]*Session
+	onListen   func(handoff bool) error
+
+	// Listener handoff state
+	confirmHandoff func() error
+	handedOff      chan struct{}
+	handoffOnce    sync.Once
+	conns          sync.WaitGroup
 }
 
 // Config holds the server configuration
 type Config struct {
-	SocketPath   string
-	PipeName     string
-	Logger       logger.Logger
-	DebugMode    bool // Enable debug mode (longer timeouts, no connection deadlines)
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	SocketPath     string
+	PipeName       string
+	Logger         logger.Logger
+	DebugMode      bool // Enable debug mode (longer timeouts, no connection deadlines)
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxMessageSize int          // Largest accepted message frame, in bytes
+	Takeover       bool         // Replace a running instance on the same socket instead of refusing to start
+	Listener       net.Listener // Pre-opened listener (e.g. from socket activation); used instead of creating one
+	Upgrade        bool         // Receive the listening socket from a running instance instead of creating one
 }
 
-// MessageHandler is a function that handles incoming messages
-type MessageHandler func(*protocol.Message) (*protocol.Message, error)
+// Limits holds the connection settings that can be changed while running
+type Limits struct {
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxMessageSize int
+}
+
+// MessageHandler is a function that handles incoming messages.
+// The context carries the client's Session and is cancelled when the client
+// disconnects or the server stops.
+type MessageHandler func(ctx context.Context, msg *protocol.Message) (*protocol.Message, error)
 
 // New creates a new IPC server
 func New(config *Config) (*Server, error) {
@@ -54,17 +83,29 @@ func New(config *Config) (*Server, error) {
 	if config.WriteTimeout == 0 {
 		config.WriteTimeout = 30 * time.Second
 	}
+	if config.MaxMessageSize == 0 {
+		config.MaxMessageSize = 64 << 20
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	server := &Server{
-		config:   config,
-		logger:   config.Logger,
-		handlers: make(map[protocol.MessageType]MessageHandler),
-		ctx:      ctx,
-		cancel:   cancel,
+		config:    config,
+		logger:    config.Logger,
+		handlers:  make(map[protocol.MessageType]MessageHandler),
+		sessions:  make(map[string]*Session),
+		ready:     make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		handedOff: make(chan struct{}),
 	}
 
+	server.limits.Store(&Limits{
+		ReadTimeout:    config.ReadTimeout,
+		WriteTimeout:   config.WriteTimeout,
+		MaxMessageSize: config.MaxMessageSize,
+	})
+
 	// Register default handlers
 	server.registerDefaultHandlers()
 
@@ -76,7 +117,10 @@ func (s *Server) Start() error {
 	var listener net.Listener
 	var err error
 
-	if runtime.GOOS == "windows" {
+	if s.config.Listener != nil {
+		// Inherited listener: the socket is owned by whoever passed it to us
+		listener = s.config.Listener
+	} else if runtime.GOOS == "windows" {
 		// Windows: Use Named Pipes
 		listener, err = s.createNamedPipeListener()
 	} else {
@@ -89,7 +133,30 @@ func (s *Server) Start() error {
 	}
 
 	s.listener = listener
-	s.logger.Info("IPC server started", zap.String("address", listener.Addr().String()))
+	s.logger.Info("IPC server started",
+		zap.String("address", listener.Addr().String()),
+		zap.Bool("inherited", s.config.Listener != nil),
+		zap.Bool("upgrade", s.confirmHandoff != nil),
+	)
+
+	// Tell the previous instance to stop accepting now that we serve the socket
+	if s.confirmHandoff != nil {
+		if err := s.confirmHandoff(); err != nil {
+			s.logger.Warn("Failed to confirm listener handoff", zap.Error(err))
+		}
+	}
+
+	if s.onListen != nil {
+		if err := s.onListen(s.confirmHandoff != nil); err != nil {
+			return err
+		}
+	}
+	close(s.ready)
+
+	// Allow a future upgrade to take the socket over from us
+	if s.socketPath != "" {
+		go s.serveHandoff(s.socketPath)
+	}
 
 	// Accept connections
 	for {
@@ -98,29 +165,94 @@ func (s *Server) Start() error {
 			select {
 			case <-s.ctx.Done():
 				return nil
+			case <-s.handedOff:
+				return nil
 			default:
 				s.logger.Error("Failed to accept connection", zap.Error(err))
 				continue
 			}
 		}
 
+		s.conns.Add(1)
 		go func() {
+			defer s.conns.Done()
+
 			// Set connection deadline only if not in debug mode
 			if !s.config.DebugMode {
-				conn.SetDeadline(time.Now().Add(s.config.ReadTimeout))
+				conn.SetDeadline(time.Now().Add(s.limits.Load().ReadTimeout))
 			}
 			s.handleConnection(conn)
 		}()
 	}
 }
 
+// Ready returns a channel that is closed once the server is accepting connections
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// SetLimits replaces the connection limits; they apply to the next read or write
+func (s *Server) SetLimits(limits Limits) {
+	s.limits.Store(&limits)
+}
+
+// RegisterHandler registers a handler for a message type, replacing any existing one.
+// Handlers must be registered before Start is called.
+func (s *Server) RegisterHandler(msgType protocol.MessageType, handler MessageHandler) {
+	s.handlers[msgType] = handler
+}
+
+// OnListen registers fn to run once the server owns its listener and, for
+// an upgrade, the previous instance has been told to stop accepting. handoff
+// reports an upgrade, whose predecessor may still be draining. fn runs
+// before the first connection is accepted; an error stops Start. It must be
+// registered before Start is called.
+func (s *Server) OnListen(fn func(handoff bool) error) {
+	s.onListen = fn
+}
+
+// HandedOff returns a channel that is closed once the listening socket has
+// been handed over to a newer backend process
+func (s *Server) HandedOff() <-chan struct{} {
+	return s.handedOff
+}
+
+// markHandedOff records that another process now serves the socket
+func (s *Server) markHandedOff() {
+	s.handoffOnce.Do(func() { close(s.handedOff) })
+}
+
+// Drain waits for open client connections to finish, or for ctx to expire
+func (s *Server) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("clients still connected: %w", ctx.Err())
+	}
+}
+
 // Stop stops the IPC server
 func (s *Server) Stop() error {
 	s.cancel()
+
+	var err error
 	if s.listener != nil {
-		return s.listener.Close()
+		// The listener is already closed if it was handed off
+		if err = s.listener.Close(); errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
 	}
-	return nil
+	if lockErr := s.lock.Release(); lockErr != nil && err == nil {
+		err = fmt.Errorf("failed to release instance lock: %w", lockErr)
+	}
+	return err
 }
 
 // createUnixSocketListener creates a Unix Domain Socket listener
@@ -131,9 +263,9 @@ func (s *Server) createUnixSocketListener() (net.Listener, error) {
 		socketPath = filepath.Join(os.TempDir(), "litebase.sock")
 	}
 
-	// Remove existing socket file if it exists
-	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to remove existing socket: %w", err)
+	// Take the listener over from a running instance without dropping connections
+	if s.config.Upgrade {
+		return s.receiveUnixSocketListener(socketPath)
 	}
 
 	// Create directory if it doesn't exist
@@ -141,15 +273,53 @@ func (s *Server) createUnixSocketListener() (net.Listener, error) {
 		return nil, fmt.Errorf("failed to create socket directory: %w", err)
 	}
 
+	// Make sure we are the only instance serving this socket
+	lock, err := acquireInstanceLock(socketPath, s.config.Takeover)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove stale socket file left behind by a previous instance
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		lock.Release()
+		return nil, fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+
 	listener, err := net.Listen("unix", socketPath)
 	if err != nil {
+		lock.Release()
 		return nil, fmt.Errorf("failed to create Unix socket listener: %w", err)
 	}
+	s.lock = lock
 
 	// Set socket permissions
 	if unixListener, ok := listener.(*net.UnixListener); ok {
 		unixListener.SetUnlinkOnClose(true)
 	}
+	s.socketPath = socketPath
+
+	return listener, nil
+}
+
+// receiveUnixSocketListener receives the listening socket and instance lock
+// from the backend currently serving socketPath
+func (s *Server) receiveUnixSocketListener(socketPath string) (net.Listener, error) {
+	listener, lock, confirm, err := receiveHandoff(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock.writePID(os.Getpid()); err != nil {
+		listener.Close()
+		lock.Release()
+		return nil, err
+	}
+
+	// We own the socket file from now on
+	listener.SetUnlinkOnClose(true)
+	s.lock = lock
+	s.socketPath = socketPath
+	s.confirmHandoff = confirm
 
 	return listener, nil
 }
@@ -176,18 +346,29 @@ func (s *Server) createNamedPipeListener() (net.Listener, error) {
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	s.logger.Debug("New connection established", zap.String("remote", conn.RemoteAddr().String()))
+	session, err := s.newSession(conn)
+	if err != nil {
+		s.logger.Error("Failed to start session", zap.Error(err))
+		return
+	}
+	defer session.close()
+
+	s.logger.Debug("New connection established",
+		zap.String("remote", conn.RemoteAddr().String()),
+		zap.String("session", session.ID),
+	)
 
 	for {
 		select {
-		case <-s.ctx.Done():
+		case <-session.ctx.Done():
 			return
 		default:
 			// Read message
-			msg, err := s.readMessage(conn)
+			// Subscribers and sessions holding state may stay quiet
+			msg, err := s.readMessage(conn, session.mayIdle())
 			if err != nil {
-				if err == io.EOF {
-					s.logger.Debug("Connection closed by client")
+				if errors.Is(err, io.EOF) {
+					s.logger.Debug("Connection closed by client", zap.String("session", session.ID))
 					return
 				}
 				s.logger.Error("Failed to read message", zap.Error(err))
@@ -195,7 +376,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 			}
 
 			// Handle message
-			response, err := s.handleMessage(msg)
+			response, err := s.handleMessage(session.ctx, msg)
 			if err != nil {
 				s.logger.Error("Failed to handle message", zap.Error(err))
 				errorResp := protocol.NewErrorResponse(err, 500, "Internal server error")
@@ -203,7 +384,9 @@ func (s *Server) handleConnection(conn net.Conn) {
 			}
 
 			// Send response
-			if err := s.writeMessage(conn, response); err != nil {
+			err = session.Send(response)
+			session.runAfterReply()
+			if err != nil {
 				s.logger.Error("Failed to write response", zap.Error(err))
 				return
 			}
@@ -211,11 +394,16 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
-// readMessage reads a MessagePack message from the connection
-func (s *Server) readMessage(conn net.Conn) (*protocol.Message, error) {
+// readMessage reads a MessagePack message from the connection.
+// With idle set, the client may take as long as it likes to send it.
+func (s *Server) readMessage(conn net.Conn, idle bool) (*protocol.Message, error) {
+	limits := s.limits.Load()
+
 	// Set read deadline if not in debug mode
-	if !s.config.DebugMode {
-		conn.SetReadDeadline(time.Now().Add(s.config.ReadTimeout))
+	if idle {
+		conn.SetReadDeadline(time.Time{})
+	} else if !s.config.DebugMode {
+		conn.SetReadDeadline(time.Now().Add(limits.ReadTimeout))
 	}
 
 	// Read length prefix (4 bytes)
@@ -225,6 +413,9 @@ func (s *Server) readMessage(conn net.Conn) (*protocol.Message, error) {
 	}
 
 	length := binary.BigEndian.Uint32(lengthBytes)
+	if uint64(length) > uint64(limits.MaxMessageSize) {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit of %d bytes", length, limits.MaxMessageSize)
+	}
 
 	// Read message data
 	data := make([]byte, length)
@@ -245,7 +436,7 @@ func (s *Server) readMessage(conn net.Conn) (*protocol.Message, error) {
 func (s *Server) writeMessage(conn net.Conn, msg interface{}) error {
 	// Set write deadline if not in debug mode
 	if !s.config.DebugMode {
-		conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+		conn.SetWriteDeadline(time.Now().Add(s.limits.Load().WriteTimeout))
 	}
 
 	// Serialize message
@@ -271,7 +462,7 @@ func (s *Server) writeMessage(conn net.Conn, msg interface{}) error {
 }
 
 // handleMessage routes messages to appropriate handlers
-func (s *Server) handleMessage(msg *protocol.Message) (*protocol.Message, error) {
+func (s *Server) handleMessage(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
 	handler, exists := s.handlers[msg.Type]
 	if !exists {
 		errorResp := protocol.NewErrorResponse(
@@ -282,19 +473,76 @@ func (s *Server) handleMessage(msg *protocol.Message) (*protocol.Message, error)
 		return &errorResp.Message, nil
 	}
 
-	return handler(msg)
+	return handler(ctx, msg)
 }
 
 // registerDefaultHandlers registers the default message handlers
 func (s *Server) registerDefaultHandlers() {
 	// Health check handler
 	s.handlers[protocol.MessageTypeHealthCheck] = s.handleHealthCheck
+
+	// Event subscriptions
+	s.handlers[protocol.MessageTypeSubscribe] = s.handleSubscribe
+	s.handlers[protocol.MessageTypeUnsubscribe] = s.handleUnsubscribe
 }
 
 // handleHealthCheck handles health check requests
-func (s *Server) handleHealthCheck(msg *protocol.Message) (*protocol.Message, error) {
+func (s *Server) handleHealthCheck(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
 	s.logger.Debug("Health check request received", zap.String("id", msg.ID))
 
 	response := protocol.NewHealthCheckResponse("healthy", "1.0.0")
 	return &response.Message, nil
 }
+
+// subscriptionRequest lists event topics
+type subscriptionRequest struct {
+	Topics []string `msgpack:"topics"`
+}
+
+// subscriptionError builds the error response of an invalid subscription request
+func subscriptionError(err error) *protocol.Message {
+	return protocol.NewMessage(protocol.MessageTypeError, map[string]interface{}{
+		"error":   err.Error(),
+		"code":    400,
+		"details": "Invalid subscription request",
+	})
+}
+
+// handleSubscribe subscribes the client to event topics
+func (s *Server) handleSubscribe(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	session, ok := SessionFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no session for subscription")
+	}
+
+	var req subscriptionRequest
+	if err := msg.DecodeData(&req); err != nil || len(req.Topics) == 0 {
+		if err == nil {
+			err = fmt.Errorf("topics are required")
+		}
+		return subscriptionError(err), nil
+	}
+
+	session.Subscribe(req.Topics...)
+	return protocol.NewMessage(protocol.MessageTypeSubscribeResponse, map[string]interface{}{
+		"topics": session.Topics(),
+	}), nil
+}
+
+// handleUnsubscribe removes event subscriptions; no topics removes all of them
+func (s *Server) handleUnsubscribe(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	session, ok := SessionFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no session for subscription")
+	}
+
+	var req subscriptionRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return subscriptionError(err), nil
+	}
+
+	session.Unsubscribe(req.Topics...)
+	return protocol.NewMessage(protocol.MessageTypeUnsubscribeResponse, map[string]interface{}{
+		"topics": session.Topics(),
+	}), nil
+}
@@ -0,0 +1,250 @@
+package ipc
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// eventQueueSize is the number of events a session buffers for a slow
+// client; further events are dropped until it catches up
+const eventQueueSize = 256
+
+// sessionKey is the context key under which handlers find their session
+type sessionKey struct{}
+
+// Session is a connected client. Handlers reach it through their context to
+// push messages outside the request/response cycle.
+type Session struct {
+	ID string
+
+	server  *Server
+	conn    net.Conn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	writeMu sync.Mutex
+	events  chan *protocol.Message // Published events, written in order by deliverEvents
+
+	mu      sync.Mutex
+	topics  map[string]bool
+	onClose []func()
+	idle    []func() bool
+	replied []func()
+}
+
+// SessionFromContext returns the session a handler is serving
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(*Session)
+	return session, ok
+}
+
+// newSession registers a session for conn
+func (s *Server) newSession(conn net.Conn) (*Session, error) {
+	id, err := ids.New("sess_")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	session := &Session{
+		ID:     id,
+		server: s,
+		conn:   conn,
+		cancel: cancel,
+		events: make(chan *protocol.Message, eventQueueSize),
+		topics: make(map[string]bool),
+	}
+	session.ctx = context.WithValue(ctx, sessionKey{}, session)
+	go session.deliverEvents()
+
+	s.sessionsMu.Lock()
+	s.sessions[session.ID] = session
+	s.sessionsMu.Unlock()
+	return session, nil
+}
+
+// Context returns the session context, which is cancelled when the client disconnects
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Send writes a message to the client. It is safe to call concurrently with
+// the responses written by the connection loop.
+func (s *Session) Send(msg *protocol.Message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.server.writeMessage(s.conn, msg)
+}
+
+// deliverEvents writes queued events to the client in the order they were
+// published until the session closes
+func (s *Session) deliverEvents() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case msg := <-s.events:
+			if err := s.Send(msg); err != nil {
+				s.server.logger.Debug("Failed to deliver event", zap.String("session", s.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// queueEvent queues an event for delivery without waiting for the client
+func (s *Session) queueEvent(msg *protocol.Message) {
+	select {
+	case s.events <- msg:
+	default:
+		s.server.logger.Warn("Dropped event for slow client", zap.String("session", s.ID))
+	}
+}
+
+// Subscribe adds topics the client receives events for
+func (s *Session) Subscribe(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+}
+
+// Unsubscribe removes topics; no topics removes every subscription
+func (s *Session) Unsubscribe(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(topics) == 0 {
+		s.topics = make(map[string]bool)
+		return
+	}
+	for _, topic := range topics {
+		delete(s.topics, topic)
+	}
+}
+
+// Topics returns the subscribed topics in sorted order
+func (s *Session) Topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// subscribed reports whether the session receives events for topic
+func (s *Session) subscribed(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.topics[topic]
+}
+
+// AllowIdle lets the client stay quiet past the read timeout while cond
+// returns true, e.g. while it holds server-side state such as a transaction
+func (s *Session) AllowIdle(cond func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle = append(s.idle, cond)
+}
+
+// mayIdle reports whether the session waits for events or holds state the
+// client may come back to at any time
+func (s *Session) mayIdle() bool {
+	s.mu.Lock()
+	conds := s.idle
+	subscribed := len(s.topics) > 0
+	s.mu.Unlock()
+	if subscribed {
+		return true
+	}
+	for _, cond := range conds {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+// AfterReply registers a function that runs once the response to the
+// message being handled has been written, so that messages it pushes
+// arrive after that response
+func (s *Session) AfterReply(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replied = append(s.replied, fn)
+}
+
+// runAfterReply runs the functions registered while handling the last message
+func (s *Session) runAfterReply() {
+	s.mu.Lock()
+	hooks := s.replied
+	s.replied = nil
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// OnClose registers a function that runs after the client disconnects
+func (s *Session) OnClose(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = append(s.onClose, fn)
+}
+
+// close unregisters the session and runs its close hooks
+func (s *Session) close() {
+	s.cancel()
+
+	s.server.sessionsMu.Lock()
+	delete(s.server.sessions, s.ID)
+	s.server.sessionsMu.Unlock()
+
+	s.mu.Lock()
+	hooks := s.onClose
+	s.onClose = nil
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// Publish sends an event to every session subscribed to topic.
+// The payload is sent as the data of an "event" message with the topic added.
+// Each session receives its events in the order they were published.
+func (s *Server) Publish(topic string, data map[string]interface{}) {
+	payload := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["topic"] = topic
+
+	s.sessionsMu.Lock()
+	var targets []*Session
+	for _, session := range s.sessions {
+		if session.subscribed(topic) {
+			targets = append(targets, session)
+		}
+	}
+	s.sessionsMu.Unlock()
+
+	for _, session := range targets {
+		// A slow client must not hold up the publisher
+		session.queueEvent(protocol.NewMessage(protocol.MessageTypeEvent, payload))
+	}
+}
+
+// SessionCount returns the number of connected clients
+func (s *Server) SessionCount() int {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	return len(s.sessions)
+}
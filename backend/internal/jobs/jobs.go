@@ -0,0 +1,447 @@
+// Package jobs runs queries in the background, detached from the client that
+// submitted them, and keeps their results on disk for a retention period.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+	"litebase-backend/internal/spool"
+	"litebase-backend/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+	// ErrInvalid is returned for malformed job requests
+	ErrInvalid = errors.New("invalid job request")
+	// ErrFinished is returned when cancelling a job that is no longer running
+	ErrFinished = errors.New("job has already finished")
+)
+
+const (
+	// MaxFetch is the largest number of rows one fetch returns
+	MaxFetch = 10000
+	// progressInterval spaces out the progress notifications of a job
+	progressInterval = time.Second
+	// purgeInterval is how often expired jobs are deleted
+	purgeInterval = time.Minute
+)
+
+// Config configures the job manager
+type Config struct {
+	Logger    logger.Logger
+	Store     *storage.Store
+	Dir       string        // Holds the result files
+	Retention time.Duration // Finished jobs are deleted this long after they end
+	Notify    func(storage.Job)
+}
+
+// run is a job in progress
+type run struct {
+	job       storage.Job // Guarded by Manager.mu
+	cancel    context.CancelFunc
+	cancelled bool
+	done      chan struct{}
+}
+
+// Manager runs jobs and keeps their records in local storage
+type Manager struct {
+	logger logger.Logger
+	store  *storage.Store
+	dir    string
+	notify func(storage.Job)
+	ctx    context.Context // Parent of every job; cancelled on shutdown
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	running   map[string]*run
+	retention time.Duration
+
+	wg sync.WaitGroup
+}
+
+// NewManager creates the result directory. Jobs are neither recovered nor
+// expired until Start.
+func NewManager(config Config) (*Manager, error) {
+	if config.Logger == nil || config.Store == nil {
+		return nil, fmt.Errorf("logger and store are required")
+	}
+	if config.Retention <= 0 {
+		return nil, fmt.Errorf("retention must be positive")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	if config.Notify == nil {
+		config.Notify = func(storage.Job) {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		logger:    config.Logger,
+		store:     config.Store,
+		dir:       config.Dir,
+		notify:    config.Notify,
+		ctx:       ctx,
+		cancel:    cancel,
+		running:   make(map[string]*run),
+		retention: config.Retention,
+	}
+	return m, nil
+}
+
+// Start deletes expired jobs and keeps doing so. With recoverRunning, jobs
+// that were running when the backend last stopped are marked interrupted and
+// result files without a record are deleted; an instance we take over from
+// on an upgrade still runs its jobs, so it is not set then.
+func (m *Manager) Start(recoverRunning bool) error {
+	if recoverRunning {
+		jobs, err := m.store.ListJobs(m.ctx)
+		if err != nil {
+			return err
+		}
+		known := make(map[string]bool, len(jobs))
+		for _, j := range jobs {
+			known[m.path(j.ID)] = true
+			if j.Status != storage.JobRunning {
+				continue
+			}
+			now := time.Now().UTC()
+			j.Status, j.Error, j.FinishedAt = storage.JobInterrupted, "the backend stopped while the job was running", &now
+			if err := m.store.SaveJob(m.ctx, j); err != nil {
+				return err
+			}
+		}
+		// Result files without a record cannot be reached
+		files, _ := filepath.Glob(filepath.Join(m.dir, "job_*.db"))
+		for _, path := range files {
+			if !known[path] {
+				spool.RemoveFiles(path)
+			}
+		}
+	}
+	m.purge()
+
+	m.wg.Add(1)
+	go m.expire()
+	return nil
+}
+
+// SetRetention changes how long finished jobs are kept
+func (m *Manager) SetRetention(retention time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retention = retention
+}
+
+// Submit starts a job running src on connectionID and returns its record
+func (m *Manager) Submit(connectionID, label, sql string, src database.StreamFunc) (storage.Job, error) {
+	id, err := ids.New("job_")
+	if err != nil {
+		return storage.Job{}, err
+	}
+	j := storage.Job{
+		ID:           id,
+		Label:        strings.TrimSpace(label),
+		ConnectionID: connectionID,
+		SQL:          sql,
+		Status:       storage.JobRunning,
+		Columns:      []database.Column{},
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := m.store.SaveJob(m.ctx, j); err != nil {
+		return storage.Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	r := &run{job: j, cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.running[j.ID] = r
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.execute(ctx, r, src)
+
+	m.logger.Info("Job submitted",
+		zap.String("job_id", j.ID),
+		zap.String("connection_id", connectionID),
+		zap.String("label", j.Label),
+	)
+	m.notify(j)
+	return j, nil
+}
+
+// execute runs a job and records its outcome
+func (m *Manager) execute(ctx context.Context, r *run, src database.StreamFunc) {
+	defer m.wg.Done()
+	defer close(r.done)
+
+	var lastProgress time.Time
+	// Job results are kept after the query, so they must survive a crash
+	sink := spool.NewSink(ctx, m.path(r.job.ID), spool.Options{Durable: true}, func(sp *spool.Spool, cols []database.Column) error {
+		m.mu.Lock()
+		r.job.Columns = cols
+		j := r.job
+		m.mu.Unlock()
+		m.notify(j)
+		return nil
+	}, func(rows, bytes int64) error {
+		m.mu.Lock()
+		r.job.Rows, r.job.Bytes = rows, bytes
+		j := r.job
+		m.mu.Unlock()
+		if time.Since(lastProgress) >= progressInterval {
+			lastProgress = time.Now()
+			m.notify(j)
+		}
+		return nil
+	})
+
+	res, err := src(ctx, sink)
+	if flushErr := sink.Flush(); err == nil {
+		err = flushErr
+	}
+	if sp := sink.Spool(); sp != nil {
+		sp.Close()
+	}
+
+	m.mu.Lock()
+	j := &r.job
+	now := time.Now().UTC()
+	j.FinishedAt = &now
+	switch {
+	case err == nil:
+		j.Status, j.Class, j.RowsAffected, j.Truncated = storage.JobSucceeded, res.Class, res.RowsAffected, res.Truncated
+	case r.cancelled:
+		j.Status, j.Error = storage.JobCancelled, "cancelled by request"
+	case m.ctx.Err() != nil && errors.Is(err, context.Canceled):
+		// Failures that happened to end during shutdown are still failures
+		j.Status, j.Error = storage.JobInterrupted, "the backend stopped while the job was running"
+	default:
+		j.Status, j.Error = storage.JobFailed, err.Error()
+	}
+	if info, statErr := os.Stat(m.path(j.ID)); statErr == nil {
+		j.Bytes = info.Size()
+	}
+	final := *j
+	m.mu.Unlock()
+
+	if err := m.store.SaveJob(context.Background(), final); err != nil {
+		m.logger.Error("Failed to save job", zap.String("job_id", final.ID), zap.Error(err))
+	}
+	m.mu.Lock()
+	delete(m.running, final.ID)
+	m.mu.Unlock()
+
+	m.logger.Info("Job finished",
+		zap.String("job_id", final.ID),
+		zap.String("status", final.Status),
+		zap.Int64("rows", final.Rows),
+	)
+	m.notify(m.withExpiry(final))
+}
+
+// Get returns a job's current record
+func (m *Manager) Get(ctx context.Context, id string) (storage.Job, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	var j storage.Job
+	if ok {
+		j = r.job
+	}
+	m.mu.Unlock()
+	if ok {
+		return j, nil
+	}
+
+	j, err := m.store.GetJob(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return storage.Job{}, err
+	}
+	return m.withExpiry(j), nil
+}
+
+// Wait blocks until a job has finished, or ctx ends, and returns its record
+func (m *Manager) Wait(ctx context.Context, id string) (storage.Job, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return storage.Job{}, ctx.Err()
+		}
+	}
+	return m.Get(ctx, id)
+}
+
+// List returns every job, newest first
+func (m *Manager) List(ctx context.Context) ([]storage.Job, error) {
+	jobs, err := m.store.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, j := range jobs {
+		if r, ok := m.running[j.ID]; ok {
+			jobs[i] = r.job
+		} else {
+			jobs[i] = m.withExpiryLocked(j)
+		}
+	}
+	return jobs, nil
+}
+
+// Fetch returns up to limit result rows of a job starting at offset. Rows
+// of a running job can be read as they arrive.
+func (m *Manager) Fetch(ctx context.Context, id string, offset, limit int64) ([][]interface{}, storage.Job, error) {
+	if offset < 0 || limit < 1 || limit > MaxFetch {
+		return nil, storage.Job{}, fmt.Errorf("%w: offset must not be negative and limit must be between 1 and %d", ErrInvalid, MaxFetch)
+	}
+	j, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, storage.Job{}, err
+	}
+	if j.Rows == 0 {
+		return [][]interface{}{}, j, nil
+	}
+
+	// A separate handle, so reads never wait for the writer
+	sp, err := spool.Open(m.path(id))
+	if err != nil {
+		return nil, storage.Job{}, fmt.Errorf("failed to open job result: %w", err)
+	}
+	defer sp.Close()
+	rows, err := sp.Read(ctx, offset, limit)
+	if err != nil {
+		return nil, storage.Job{}, fmt.Errorf("failed to read job result: %w", err)
+	}
+	return rows, j, nil
+}
+
+// Cancel stops a running job and returns its final record
+func (m *Manager) Cancel(ctx context.Context, id string) (storage.Job, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	if ok {
+		r.cancelled = true
+		r.cancel()
+	}
+	m.mu.Unlock()
+	if !ok {
+		if _, err := m.Get(ctx, id); err != nil {
+			return storage.Job{}, err
+		}
+		return storage.Job{}, fmt.Errorf("%w: %s", ErrFinished, id)
+	}
+
+	m.logger.Info("Job cancelled", zap.String("job_id", id))
+	return m.Wait(ctx, id)
+}
+
+// Delete removes a job and its result, cancelling it first if it is running
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	if ok {
+		r.cancelled = true
+		r.cancel()
+	}
+	m.mu.Unlock()
+	if ok {
+		<-r.done
+	}
+
+	if err := m.store.DeleteJob(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return err
+	}
+	if err := spool.RemoveFiles(m.path(id)); err != nil {
+		m.logger.Warn("Failed to delete job result", zap.String("job_id", id), zap.Error(err))
+	}
+	m.logger.Info("Job deleted", zap.String("job_id", id))
+	return nil
+}
+
+// Shutdown stops the running jobs, which are recorded as interrupted
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// path returns the result file of a job
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.dir, id+".db")
+}
+
+// withExpiry sets when a finished job will be deleted
+func (m *Manager) withExpiry(j storage.Job) storage.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.withExpiryLocked(j)
+}
+
+// withExpiryLocked is withExpiry with m.mu held
+func (m *Manager) withExpiryLocked(j storage.Job) storage.Job {
+	if j.FinishedAt != nil {
+		expires := j.FinishedAt.Add(m.retention)
+		j.ExpiresAt = &expires
+	}
+	return j
+}
+
+// purge deletes the finished jobs past their retention
+func (m *Manager) purge() {
+	jobs, err := m.store.ListJobs(m.ctx)
+	if err != nil {
+		m.logger.Warn("Failed to list jobs for expiry", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	for _, j := range jobs {
+		j = m.withExpiry(j)
+		if j.ExpiresAt == nil || now.Before(*j.ExpiresAt) {
+			continue
+		}
+		if err := m.Delete(m.ctx, j.ID); err != nil {
+			m.logger.Warn("Failed to delete expired job", zap.String("job_id", j.ID), zap.Error(err))
+			continue
+		}
+		m.logger.Info("Job expired", zap.String("job_id", j.ID))
+	}
+}
+
+// expire periodically deletes expired jobs
+func (m *Manager) expire() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.purge()
+		}
+	}
+}
@@ -15,27 +15,37 @@ type Logger interface {
 	Error(msg string, fields ...zap.Field)
 	Fatal(msg string, fields ...zap.Field)
 	Sync() error
+
+	// SetLevel changes the minimum level at runtime
+	SetLevel(level string) error
+	// SetRedact replaces the set of field names whose values are redacted
+	SetRedact(fields []string)
+}
+
+// Options configures a logger
+type Options struct {
+	Level  string   // debug, info, warn or error
+	Format string   // json (default) or console
+	Redact []string // Field names whose values are replaced before logging
 }
 
 // logger implements the Logger interface
 type logger struct {
-	zap *zap.Logger
+	zap    *zap.Logger
+	level  zap.AtomicLevel
+	redact *atomicRedactSet
 }
 
 // New creates a new logger instance
 func New(level string) Logger {
+	return NewWithOptions(Options{Level: level})
+}
+
+// NewWithOptions creates a new logger instance from options
+func NewWithOptions(opts Options) Logger {
 	// Parse log level
-	var zapLevel zapcore.Level
-	switch level {
-	case "debug":
-		zapLevel = zapcore.DebugLevel
-	case "info":
-		zapLevel = zapcore.InfoLevel
-	case "warn":
-		zapLevel = zapcore.WarnLevel
-	case "error":
-		zapLevel = zapcore.ErrorLevel
-	default:
+	zapLevel, err := parseLevel(opts.Level)
+	if err != nil {
 		zapLevel = zapcore.InfoLevel
 	}
 
@@ -47,12 +57,25 @@ func New(level string) Logger {
 
 	// Create logger with custom level
 	config := zap.NewProductionConfig()
-	config.Level = zap.NewAtomicLevelAt(zapLevel)
+	level := zap.NewAtomicLevelAt(zapLevel)
+	config.Level = level
+	if opts.Format == "console" {
+		config.Encoding = "console"
+		config.EncoderConfig = encoderConfig
+	}
 
-	zapLogger, err := config.Build(
+	redact := &atomicRedactSet{}
+	redact.Store(newRedactSet(opts.Redact))
+
+	buildOpts := []zap.Option{
 		zap.AddCaller(),
 		zap.AddStacktrace(zapcore.ErrorLevel),
-	)
+		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &redactingCore{Core: core, redact: redact}
+		}),
+	}
+
+	zapLogger, err := config.Build(buildOpts...)
 	if err != nil {
 		// Fallback to basic logger if production config fails
 		zapLogger = zap.NewExample()
@@ -60,7 +83,23 @@ func New(level string) Logger {
 		fmt.Printf("Failed to create production logger: %v, using fallback\n", err)
 	}
 
-	return &logger{zap: zapLogger}
+	return &logger{zap: zapLogger, level: level, redact: redact}
+}
+
+// parseLevel converts a level name to a zap level
+func parseLevel(level string) (zapcore.Level, error) {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "warn":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	default:
+		return zapcore.InfoLevel, fmt.Errorf("unknown log level %q", level)
+	}
 }
 
 // Debug logs a debug message
@@ -92,3 +131,18 @@ func (l *logger) Fatal(msg string, fields ...zap.Field) {
 func (l *logger) Sync() error {
 	return l.zap.Sync()
 }
+
+// SetLevel changes the minimum level at runtime
+func (l *logger) SetLevel(level string) error {
+	zapLevel, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.SetLevel(zapLevel)
+	return nil
+}
+
+// SetRedact replaces the set of redacted field names
+func (l *logger) SetRedact(fields []string) {
+	l.redact.Store(newRedactSet(fields))
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactedValue replaces the value of redacted fields
+const redactedValue = "[REDACTED]"
+
+// redactSet holds lower-cased field names that must not be logged
+type redactSet map[string]struct{}
+
+// newRedactSet builds a redact set from field names
+func newRedactSet(keys []string) redactSet {
+	set := make(redactSet, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = struct{}{}
+	}
+	return set
+}
+
+// apply returns fields with the values of redacted keys replaced
+func (r redactSet) apply(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, field := range fields {
+		if _, ok := r[strings.ToLower(field.Key)]; !ok {
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		out[i] = zap.String(field.Key, redactedValue)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// atomicRedactSet allows the redact set to be replaced at runtime
+type atomicRedactSet struct {
+	v atomic.Pointer[redactSet]
+}
+
+// Store replaces the current redact set
+func (a *atomicRedactSet) Store(set redactSet) {
+	a.v.Store(&set)
+}
+
+// apply redacts fields using the current redact set
+func (a *atomicRedactSet) apply(fields []zapcore.Field) []zapcore.Field {
+	set := a.v.Load()
+	if set == nil || len(*set) == 0 {
+		return fields
+	}
+	return set.apply(fields)
+}
+
+// redactingCore wraps a zapcore.Core and redacts sensitive fields
+type redactingCore struct {
+	zapcore.Core
+	redact *atomicRedactSet
+}
+
+// With adds structured context, redacting sensitive fields
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redact.apply(fields)), redact: c.redact}
+}
+
+// Check adds this core to the checked entry if the level is enabled
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write redacts sensitive fields before writing the entry
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.redact.apply(fields))
+}
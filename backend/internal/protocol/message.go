@@ -1,7 +1,11 @@
 package protocol
 
 import (
+	"fmt"
+	"math"
 	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // MessageType represents the type of IPC message
@@ -16,10 +20,208 @@ const (
 	MessageTypeDBConnect MessageType = "db_connect"
 	// Database connection response
 	MessageTypeDBConnectResponse MessageType = "db_connect_response"
+	// Database disconnect request
+	MessageTypeDBDisconnect MessageType = "db_disconnect"
+	// Database disconnect response
+	MessageTypeDBDisconnectResponse MessageType = "db_disconnect_response"
+	// Database reconnect request
+	MessageTypeDBReconnect MessageType = "db_reconnect"
+	// Database reconnect response
+	MessageTypeDBReconnectResponse MessageType = "db_reconnect_response"
+	// Connection pool statistics request
+	MessageTypePoolStats MessageType = "pool_stats"
+	// Connection pool statistics response
+	MessageTypePoolStatsResponse MessageType = "pool_stats_response"
+	// Saved profile creation request
+	MessageTypeProfileCreate MessageType = "profile_create"
+	// Saved profile creation response
+	MessageTypeProfileCreateResponse MessageType = "profile_create_response"
+	// Saved profile update request
+	MessageTypeProfileUpdate MessageType = "profile_update"
+	// Saved profile update response
+	MessageTypeProfileUpdateResponse MessageType = "profile_update_response"
+	// Saved profile deletion request
+	MessageTypeProfileDelete MessageType = "profile_delete"
+	// Saved profile deletion response
+	MessageTypeProfileDeleteResponse MessageType = "profile_delete_response"
+	// Saved profile listing request
+	MessageTypeProfileList MessageType = "profile_list"
+	// Saved profile listing response
+	MessageTypeProfileListResponse MessageType = "profile_list_response"
+	// Saved profile duplication request
+	MessageTypeProfileDuplicate MessageType = "profile_duplicate"
+	// Saved profile duplication response
+	MessageTypeProfileDuplicateResponse MessageType = "profile_duplicate_response"
+	// Saved profile grouping request
+	MessageTypeProfileGroup MessageType = "profile_group"
+	// Saved profile grouping response
+	MessageTypeProfileGroupResponse MessageType = "profile_group_response"
+	// Secret storage request
+	MessageTypeSecretSet MessageType = "secret_set"
+	// Secret storage response
+	MessageTypeSecretSetResponse MessageType = "secret_set_response"
+	// Secret deletion request
+	MessageTypeSecretDelete MessageType = "secret_delete"
+	// Secret deletion response
+	MessageTypeSecretDeleteResponse MessageType = "secret_delete_response"
+	// Secret listing request
+	MessageTypeSecretList MessageType = "secret_list"
+	// Secret listing response
+	MessageTypeSecretListResponse MessageType = "secret_list_response"
+	// Secret store unlock request
+	MessageTypeSecretUnlock MessageType = "secret_unlock"
+	// Secret store unlock response
+	MessageTypeSecretUnlockResponse MessageType = "secret_unlock_response"
+	// Secret store lock request
+	MessageTypeSecretLock MessageType = "secret_lock"
+	// Secret store lock response
+	MessageTypeSecretLockResponse MessageType = "secret_lock_response"
+	// Connection string parse request
+	MessageTypeDSNParse MessageType = "dsn_parse"
+	// Connection string parse response
+	MessageTypeDSNParseResponse MessageType = "dsn_parse_response"
+	// Connection string format request
+	MessageTypeDSNFormat MessageType = "dsn_format"
+	// Connection string format response
+	MessageTypeDSNFormatResponse MessageType = "dsn_format_response"
 	// Query execution request
 	MessageTypeQuery MessageType = "query"
 	// Query execution response
 	MessageTypeQueryResponse MessageType = "query_response"
+	// Prepared statement create request
+	MessageTypeStmtPrepare MessageType = "stmt_prepare"
+	// Prepared statement create response
+	MessageTypeStmtPrepareResponse MessageType = "stmt_prepare_response"
+	// Prepared statement execution request
+	MessageTypeStmtExecute MessageType = "stmt_execute"
+	// Prepared statement execution response
+	MessageTypeStmtExecuteResponse MessageType = "stmt_execute_response"
+	// Prepared statement removal request
+	MessageTypeStmtDeallocate MessageType = "stmt_deallocate"
+	// Prepared statement removal response
+	MessageTypeStmtDeallocateResponse MessageType = "stmt_deallocate_response"
+	// Transaction begin request
+	MessageTypeTxBegin MessageType = "tx_begin"
+	// Transaction begin response
+	MessageTypeTxBeginResponse MessageType = "tx_begin_response"
+	// Transaction commit request
+	MessageTypeTxCommit MessageType = "tx_commit"
+	// Transaction commit response
+	MessageTypeTxCommitResponse MessageType = "tx_commit_response"
+	// Transaction rollback request
+	MessageTypeTxRollback MessageType = "tx_rollback"
+	// Transaction rollback response
+	MessageTypeTxRollbackResponse MessageType = "tx_rollback_response"
+	// Transaction savepoint request
+	MessageTypeTxSavepoint MessageType = "tx_savepoint"
+	// Transaction savepoint response
+	MessageTypeTxSavepointResponse MessageType = "tx_savepoint_response"
+	// Savepoint release request
+	MessageTypeTxRelease MessageType = "tx_release"
+	// Savepoint release response
+	MessageTypeTxReleaseResponse MessageType = "tx_release_response"
+	// Cursor open request
+	MessageTypeCursorOpen MessageType = "cursor_open"
+	// Cursor open response
+	MessageTypeCursorOpenResponse MessageType = "cursor_open_response"
+	// Cursor row fetch request
+	MessageTypeCursorFetch MessageType = "cursor_fetch"
+	// Cursor row fetch response
+	MessageTypeCursorFetchResponse MessageType = "cursor_fetch_response"
+	// Cursor row count request
+	MessageTypeCursorCount MessageType = "cursor_count"
+	// Cursor row count response
+	MessageTypeCursorCountResponse MessageType = "cursor_count_response"
+	// Cursor view request
+	MessageTypeCursorView MessageType = "cursor_view"
+	// Cursor view response
+	MessageTypeCursorViewResponse MessageType = "cursor_view_response"
+	// Cursor close request
+	MessageTypeCursorClose MessageType = "cursor_close"
+	// Cursor close response
+	MessageTypeCursorCloseResponse MessageType = "cursor_close_response"
+	// Fan-out query request
+	MessageTypeFanout MessageType = "fanout"
+	// Fan-out query response
+	MessageTypeFanoutResponse MessageType = "fanout_response"
+	// Server-pushed outcome of a fan-out on one connection
+	MessageTypeFanoutResult MessageType = "fanout_result"
+	// Server-pushed summary once a fan-out has finished
+	MessageTypeFanoutDone MessageType = "fanout_done"
+	// Fan-out cancel request
+	MessageTypeFanoutCancel MessageType = "fanout_cancel"
+	// Fan-out cancel response
+	MessageTypeFanoutCancelResponse MessageType = "fanout_cancel_response"
+	// Job submit request
+	MessageTypeJobSubmit MessageType = "job_submit"
+	// Job submit response
+	MessageTypeJobSubmitResponse MessageType = "job_submit_response"
+	// Job list request
+	MessageTypeJobList MessageType = "job_list"
+	// Job list response
+	MessageTypeJobListResponse MessageType = "job_list_response"
+	// Job status request
+	MessageTypeJobStatus MessageType = "job_status"
+	// Job status response
+	MessageTypeJobStatusResponse MessageType = "job_status_response"
+	// Job result fetch request
+	MessageTypeJobFetch MessageType = "job_fetch"
+	// Job result fetch response
+	MessageTypeJobFetchResponse MessageType = "job_fetch_response"
+	// Job cancel request
+	MessageTypeJobCancel MessageType = "job_cancel"
+	// Job cancel response
+	MessageTypeJobCancelResponse MessageType = "job_cancel_response"
+	// Job delete request
+	MessageTypeJobDelete MessageType = "job_delete"
+	// Job delete response
+	MessageTypeJobDeleteResponse MessageType = "job_delete_response"
+	// Schedule create request
+	MessageTypeScheduleCreate MessageType = "schedule_create"
+	// Schedule create response
+	MessageTypeScheduleCreateResponse MessageType = "schedule_create_response"
+	// Schedule update request
+	MessageTypeScheduleUpdate MessageType = "schedule_update"
+	// Schedule update response
+	MessageTypeScheduleUpdateResponse MessageType = "schedule_update_response"
+	// Schedule delete request
+	MessageTypeScheduleDelete MessageType = "schedule_delete"
+	// Schedule delete response
+	MessageTypeScheduleDeleteResponse MessageType = "schedule_delete_response"
+	// Schedule list request
+	MessageTypeScheduleList MessageType = "schedule_list"
+	// Schedule list response
+	MessageTypeScheduleListResponse MessageType = "schedule_list_response"
+	// Run a schedule now
+	MessageTypeScheduleRun MessageType = "schedule_run"
+	// Schedule run response
+	MessageTypeScheduleRunResponse MessageType = "schedule_run_response"
+	// Schedule run history request
+	MessageTypeScheduleHistory MessageType = "schedule_history"
+	// Schedule run history response
+	MessageTypeScheduleHistoryResponse MessageType = "schedule_history_response"
+	// Recorded schedule run request
+	MessageTypeScheduleResult MessageType = "schedule_result"
+	// Recorded schedule run response
+	MessageTypeScheduleResultResponse MessageType = "schedule_result_response"
+	// Truncated value fetch request
+	MessageTypeValueFetch MessageType = "value_fetch"
+	// Truncated value fetch response
+	MessageTypeValueFetchResponse MessageType = "value_fetch_response"
+	// Configuration reload request
+	MessageTypeConfigReload MessageType = "config_reload"
+	// Configuration reload response
+	MessageTypeConfigReloadResponse MessageType = "config_reload_response"
+	// Event subscription request
+	MessageTypeSubscribe MessageType = "subscribe"
+	// Event subscription response
+	MessageTypeSubscribeResponse MessageType = "subscribe_response"
+	// Event unsubscription request
+	MessageTypeUnsubscribe MessageType = "unsubscribe"
+	// Event unsubscription response
+	MessageTypeUnsubscribeResponse MessageType = "unsubscribe_response"
+	// Server-pushed event for a subscribed topic
+	MessageTypeEvent MessageType = "event"
 	// Error message
 	MessageTypeError MessageType = "error"
 )
@@ -80,16 +282,60 @@ func NewHealthCheckResponse(status, version string) *HealthCheckResponse {
 	}
 }
 
-// NewErrorResponse creates a new error response
+// NewErrorResponse creates a new error response. The fields are also set
+// in the message data, which is all that is sent when only the embedded
+// Message is written.
 func NewErrorResponse(err error, code int, details string) *ErrorResponse {
 	return &ErrorResponse{
-		Message: *NewMessage(MessageTypeError, nil),
+		Message: *NewMessage(MessageTypeError, map[string]interface{}{
+			"error":   err.Error(),
+			"code":    code,
+			"details": details,
+		}),
 		Error:   err.Error(),
 		Code:    code,
 		Details: details,
 	}
 }
 
+// DecodeData decodes the message payload into v, using v's msgpack tags
+func (m *Message) DecodeData(v interface{}) error {
+	data, err := msgpack.Marshal(normalizeNumbers(m.Data))
+	if err != nil {
+		return fmt.Errorf("failed to encode message data: %w", err)
+	}
+	if err := msgpack.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid message data: %w", err)
+	}
+	return nil
+}
+
+// normalizeNumbers converts integral floats to integers so that clients
+// whose msgpack encoders only produce floats can fill integer fields
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[k] = normalizeNumbers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
 // generateID generates a unique ID for messages
 func generateID() string {
 	// Use nanosecond precision for better uniqueness
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/storage"
+)
+
+// collector is the RowSink of a run. It counts every row but keeps only the
+// first keep rows, for the run record, and the rows value assertions check.
+type collector struct {
+	keep    int
+	wanted  map[int]bool
+	columns []database.Column
+	rows    [][]interface{}       // The first keep rows
+	picked  map[int][]interface{} // Wanted rows after those
+	count   int64
+}
+
+// newCollector returns a collector keeping keep rows and those assertions
+// refer to
+func newCollector(keep int, assertions []storage.Assertion) *collector {
+	c := &collector{keep: keep, wanted: map[int]bool{}, columns: []database.Column{}, rows: [][]interface{}{}, picked: map[int][]interface{}{}}
+	for _, a := range assertions {
+		if a.Kind == storage.AssertValue && a.Row >= keep {
+			c.wanted[a.Row] = true
+		}
+	}
+	return c
+}
+
+// Columns implements database.RowSink
+func (c *collector) Columns(cols []database.Column) error {
+	c.columns = cols
+	return nil
+}
+
+// Row implements database.RowSink
+func (c *collector) Row(row []interface{}) error {
+	i := c.count
+	c.count++
+	switch {
+	case i < int64(c.keep):
+		c.rows = append(c.rows, row)
+	case c.wanted[int(i)]:
+		c.picked[int(i)] = row
+	}
+	return nil
+}
+
+// row returns row i, if it was kept
+func (c *collector) row(i int) ([]interface{}, bool) {
+	if i < len(c.rows) {
+		return c.rows[i], true
+	}
+	row, ok := c.picked[i]
+	return row, ok
+}
+
+// evaluate checks one assertion against the rows of a run. When max_rows
+// stopped the query early the row count is unknown, so row_count fails.
+func evaluate(a storage.Assertion, rows *collector, truncated bool) storage.AssertionResult {
+	r := storage.AssertionResult{Assertion: a}
+	if a.Kind == storage.AssertRowCount {
+		r.Actual = rows.count
+		if truncated {
+			r.Message = fmt.Sprintf("%s: cannot be checked; max_rows stopped the query after %d rows", a, rows.count)
+			return r
+		}
+		r.Passed = a.Holds(float64(rows.count))
+		r.Message = fmt.Sprintf("%s: %d rows", a, rows.count)
+		return r
+	}
+
+	col := columnIndex(rows.columns, a.Column)
+	row, ok := rows.row(a.Row)
+	switch {
+	case col < 0:
+		r.Message = fmt.Sprintf("%s: the result has no column %q", a, a.Column)
+		return r
+	case !ok && truncated:
+		r.Message = fmt.Sprintf("%s: max_rows stopped the query after %d rows", a, rows.count)
+		return r
+	case !ok:
+		r.Message = fmt.Sprintf("%s: the result has only %d rows", a, rows.count)
+		return r
+	}
+	r.Actual = row[col]
+	n, ok := number(r.Actual)
+	if !ok {
+		r.Message = fmt.Sprintf("%s: %v is not a number", a, r.Actual)
+		return r
+	}
+	r.Passed = a.Holds(n)
+	r.Message = fmt.Sprintf("%s: got %v", a, n)
+	return r
+}
+
+// columnIndex finds a column by name, preferring an exact match
+func columnIndex(columns []database.Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	for i, c := range columns {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// number converts a result value to a float, if it is numeric
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(n)), 64)
+		return f, err == nil
+	case database.Tagged:
+		return number(n.Scalar())
+	}
+	return 0, false
+}
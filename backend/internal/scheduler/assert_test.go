@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"testing"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/storage"
+)
+
+// collect feeds n rows of (i, "x") through a collector keeping keep rows
+func collect(keep, n int, assertions ...storage.Assertion) *collector {
+	c := newCollector(keep, assertions)
+	c.Columns([]database.Column{{Name: "n"}, {Name: "label"}})
+	for i := 0; i < n; i++ {
+		c.Row([]interface{}{int64(i), "x"})
+	}
+	return c
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion storage.Assertion
+		keep      int
+		rows      int
+		truncated bool
+		passed    bool
+		message   string
+	}{
+		{
+			name:      "row count holds",
+			assertion: storage.Assertion{Kind: storage.AssertRowCount, Op: "eq", Value: 3},
+			keep:      10, rows: 3,
+			passed:  true,
+			message: "row_count = 3: 3 rows",
+		},
+		{
+			name:      "row count beyond the kept rows",
+			assertion: storage.Assertion{Kind: storage.AssertRowCount, Op: "eq", Value: 2500},
+			keep:      1000, rows: 2500,
+			passed:  true,
+			message: "row_count = 2500: 2500 rows",
+		},
+		{
+			name:      "row count does not hold",
+			assertion: storage.Assertion{Kind: storage.AssertRowCount, Op: "gt", Value: 5},
+			keep:      10, rows: 3,
+			message: "row_count > 5: 3 rows",
+		},
+		{
+			name:      "row count of a truncated result",
+			assertion: storage.Assertion{Kind: storage.AssertRowCount, Op: "le", Value: 100},
+			keep:      10, rows: 50, truncated: true,
+			message: "row_count <= 100: cannot be checked; max_rows stopped the query after 50 rows",
+		},
+		{
+			name:      "value holds",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "n", Row: 2, Op: "eq", Value: 2},
+			keep:      10, rows: 3,
+			passed:  true,
+			message: "n[2] = 2: got 2",
+		},
+		{
+			name:      "value matches the column name case-insensitively",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "N", Row: 1, Op: "ge", Value: 1},
+			keep:      10, rows: 3,
+			passed:  true,
+			message: "N[1] >= 1: got 1",
+		},
+		{
+			name:      "value in a row after the kept rows",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "n", Row: 1500, Op: "eq", Value: 1500},
+			keep:      1000, rows: 2000,
+			passed:  true,
+			message: "n[1500] = 1500: got 1500",
+		},
+		{
+			name:      "value of a missing row",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "n", Row: 5, Op: "eq", Value: 5},
+			keep:      10, rows: 3,
+			message: "n[5] = 5: the result has only 3 rows",
+		},
+		{
+			name:      "value of a row cut off by max_rows",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "n", Row: 5, Op: "eq", Value: 5},
+			keep:      10, rows: 3, truncated: true,
+			message: "n[5] = 5: max_rows stopped the query after 3 rows",
+		},
+		{
+			name:      "value of a missing column",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "total", Row: 0, Op: "eq", Value: 0},
+			keep:      10, rows: 3,
+			message: `total[0] = 0: the result has no column "total"`,
+		},
+		{
+			name:      "value that is not a number",
+			assertion: storage.Assertion{Kind: storage.AssertValue, Column: "label", Row: 0, Op: "eq", Value: 0},
+			keep:      10, rows: 3,
+			message: "label[0] = 0: x is not a number",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := collect(tt.keep, tt.rows, tt.assertion)
+			r := evaluate(tt.assertion, rows, tt.truncated)
+			if r.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v", r.Passed, tt.passed)
+			}
+			if r.Message != tt.message {
+				t.Errorf("message = %q, want %q", r.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestCollectorKeepsLeadingRows(t *testing.T) {
+	rows := collect(2, 5)
+	if rows.count != 5 {
+		t.Errorf("count = %d, want 5", rows.count)
+	}
+	if len(rows.rows) != 2 || len(rows.picked) != 0 {
+		t.Errorf("kept %d rows and picked %d, want 2 and 0", len(rows.rows), len(rows.picked))
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  float64
+		ok    bool
+	}{
+		{int64(7), 7, true},
+		{float64(1.5), 1.5, true},
+		{true, 1, true},
+		{" 42 ", 42, true},
+		{[]byte("3.25"), 3.25, true},
+		{"abc", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := number(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("number(%#v) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
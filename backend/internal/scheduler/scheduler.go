@@ -0,0 +1,457 @@
+// Package scheduler runs saved queries at the times given by cron
+// expressions, checks their results against assertions and keeps a history
+// of the runs in local storage.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/cron"
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+	"litebase-backend/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for schedules the scheduler does not know
+	ErrNotFound = errors.New("schedule not found")
+	// ErrInvalid is returned for malformed schedule requests
+	ErrInvalid = errors.New("invalid schedule request")
+	// ErrRunning is returned when starting a schedule whose previous run has
+	// not finished
+	ErrRunning = errors.New("schedule is already running")
+)
+
+const (
+	// MaxStoredRows caps the result rows kept with each run
+	MaxStoredRows = 1000
+	// MaxHistory is the largest number of runs one history request returns
+	MaxHistory = 100
+)
+
+// Exec connects to the schedule's profile and runs its query, passing the
+// rows to sink. Only the schedule's own max_rows may cap them, so that
+// row_count assertions see every row.
+type Exec func(ctx context.Context, sc storage.Schedule, sink database.RowSink) (*database.Result, error)
+
+// Config configures the scheduler
+type Config struct {
+	Logger  logger.Logger
+	Store   *storage.Store
+	History int // Runs kept per schedule
+	Exec    Exec
+	Notify  func(storage.ScheduleRun)
+}
+
+// entry is a schedule known to the scheduler
+type entry struct {
+	schedule storage.Schedule
+	expr     *cron.Expression
+	next     time.Time          // Zero while paused
+	cancel   context.CancelFunc // Set while a run is in progress
+}
+
+// Manager fires schedules and records their runs
+type Manager struct {
+	logger logger.Logger
+	store  *storage.Store
+	exec   Exec
+	notify func(storage.ScheduleRun)
+	ctx    context.Context // Parent of every run; cancelled on shutdown
+	cancel context.CancelFunc
+	wake   chan struct{} // Tells the loop the schedules changed
+	stop   chan struct{} // Closed to stop firing schedules
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	history int
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewManager loads the saved schedules. They are not fired until Start.
+func NewManager(config Config) (*Manager, error) {
+	if config.Logger == nil || config.Store == nil || config.Exec == nil {
+		return nil, fmt.Errorf("logger, store and exec are required")
+	}
+	if config.History < 1 {
+		return nil, fmt.Errorf("history must be positive")
+	}
+	if config.Notify == nil {
+		config.Notify = func(storage.ScheduleRun) {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		logger:  config.Logger,
+		store:   config.Store,
+		exec:    config.Exec,
+		notify:  config.Notify,
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		entries: make(map[string]*entry),
+		history: config.History,
+	}
+
+	schedules, err := m.store.ListSchedules(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, sc := range schedules {
+		if err := m.track(sc); err != nil {
+			m.logger.Warn("Schedule cannot be fired", zap.String("schedule_id", sc.ID), zap.Error(err))
+		}
+	}
+	return m, nil
+}
+
+// Start fires the schedules from now on. Runs missed while the backend was
+// stopped are not made up.
+func (m *Manager) Start() {
+	m.startOnce.Do(func() {
+		select {
+		case <-m.stop:
+			return
+		default:
+		}
+		m.mu.Lock()
+		count := len(m.entries)
+		m.mu.Unlock()
+		m.logger.Info("Scheduler started", zap.Int("schedules", count))
+
+		m.wg.Add(1)
+		go m.loop()
+	})
+}
+
+// Stop stops firing schedules, leaving runs in progress and RunNow alone.
+// A newer backend that took over fires them instead.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+		m.logger.Info("Scheduler stopped")
+	})
+}
+
+// SetHistory changes how many runs are kept per schedule. Longer histories
+// are trimmed at their next run.
+func (m *Manager) SetHistory(history int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = history
+}
+
+// Create saves a new schedule and starts firing it
+func (m *Manager) Create(ctx context.Context, sc storage.Schedule) (storage.Schedule, error) {
+	created, err := m.store.CreateSchedule(ctx, sc)
+	if err != nil {
+		return storage.Schedule{}, err
+	}
+	if err := m.track(created); err != nil {
+		return storage.Schedule{}, err
+	}
+	m.logger.Info("Schedule created", zap.String("schedule_id", created.ID), zap.String("cron", created.Cron))
+	return m.Get(ctx, created.ID)
+}
+
+// Update replaces a saved schedule. A run in progress is not affected.
+func (m *Manager) Update(ctx context.Context, sc storage.Schedule) (storage.Schedule, error) {
+	if sc.ID == "" {
+		return storage.Schedule{}, fmt.Errorf("%w: id is required", ErrInvalid)
+	}
+	updated, err := m.store.UpdateSchedule(ctx, sc)
+	if err != nil {
+		return storage.Schedule{}, err
+	}
+	if err := m.track(updated); err != nil {
+		return storage.Schedule{}, err
+	}
+	m.logger.Info("Schedule updated", zap.String("schedule_id", updated.ID), zap.String("cron", updated.Cron))
+	return m.Get(ctx, updated.ID)
+}
+
+// Delete removes a schedule and its history, stopping a run in progress
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	e, ok := m.entries[id]
+	delete(m.entries, id)
+	m.mu.Unlock()
+	if ok && e.cancel != nil {
+		e.cancel()
+	}
+	m.poke()
+
+	if err := m.store.DeleteSchedule(ctx, id); err != nil {
+		return err
+	}
+	m.logger.Info("Schedule deleted", zap.String("schedule_id", id))
+	return nil
+}
+
+// Get returns a schedule with its next and last run
+func (m *Manager) Get(ctx context.Context, id string) (storage.Schedule, error) {
+	sc, err := m.store.GetSchedule(ctx, id)
+	if err != nil {
+		return storage.Schedule{}, err
+	}
+	return m.withRuns(ctx, sc)
+}
+
+// List returns every schedule with its next and last run, ordered by name
+func (m *Manager) List(ctx context.Context) ([]storage.Schedule, error) {
+	schedules, err := m.store.ListSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, sc := range schedules {
+		if schedules[i], err = m.withRuns(ctx, sc); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// History returns up to limit runs of a schedule, newest first, without
+// their rows
+func (m *Manager) History(ctx context.Context, id string, limit int) ([]storage.ScheduleRun, error) {
+	if limit == 0 {
+		limit = 20
+	}
+	if limit < 1 || limit > MaxHistory {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalid, MaxHistory)
+	}
+	if _, err := m.store.GetSchedule(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.store.ListScheduleRuns(ctx, id, limit)
+}
+
+// Run returns a recorded run with its rows
+func (m *Manager) Run(ctx context.Context, runID string) (storage.ScheduleRun, error) {
+	return m.store.GetScheduleRun(ctx, runID)
+}
+
+// RunNow starts a schedule outside its timetable, even when it is paused,
+// and waits for the run to finish. The run is recorded even if ctx ends first.
+func (m *Manager) RunNow(ctx context.Context, id string) (storage.ScheduleRun, error) {
+	result := make(chan storage.ScheduleRun, 1)
+	m.mu.Lock()
+	e, ok := m.entries[id]
+	if !ok {
+		m.mu.Unlock()
+		return storage.ScheduleRun{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if e.cancel != nil {
+		m.mu.Unlock()
+		return storage.ScheduleRun{}, fmt.Errorf("%w: %s", ErrRunning, id)
+	}
+	err := m.startLocked(e, storage.TriggerManual, result)
+	m.mu.Unlock()
+	if err != nil {
+		return storage.ScheduleRun{}, err
+	}
+
+	select {
+	case run := <-result:
+		return run, nil
+	case <-ctx.Done():
+		return storage.ScheduleRun{}, ctx.Err()
+	}
+}
+
+// Shutdown stops firing schedules and cancels the runs in progress, which
+// are recorded as errors
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// track adds or replaces the entry of a schedule and works out its next run
+func (m *Manager) track(sc storage.Schedule) error {
+	expr, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return err
+	}
+	loc, err := sc.Location()
+	if err != nil {
+		return err
+	}
+	var next time.Time
+	if !sc.Paused {
+		next = expr.Next(time.Now().In(loc))
+	}
+
+	m.mu.Lock()
+	e, ok := m.entries[sc.ID]
+	if !ok {
+		e = &entry{}
+		m.entries[sc.ID] = e
+	}
+	e.schedule, e.expr, e.next = sc, expr, next
+	m.mu.Unlock()
+	m.poke()
+	return nil
+}
+
+// withRuns fills in a schedule's next and last run
+func (m *Manager) withRuns(ctx context.Context, sc storage.Schedule) (storage.Schedule, error) {
+	m.mu.Lock()
+	if e, ok := m.entries[sc.ID]; ok && !e.next.IsZero() {
+		next := e.next
+		sc.NextRun = &next
+	}
+	m.mu.Unlock()
+
+	runs, err := m.store.ListScheduleRuns(ctx, sc.ID, 1)
+	if err != nil {
+		return storage.Schedule{}, err
+	}
+	if len(runs) > 0 {
+		sc.LastRun = &runs[0]
+	}
+	return sc, nil
+}
+
+// poke wakes the loop to recompute its timer
+func (m *Manager) poke() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sleeps until the earliest next run and starts the schedules that are due
+func (m *Manager) loop() {
+	defer m.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		wait := time.Hour
+		m.mu.Lock()
+		for _, e := range m.entries {
+			if e.next.IsZero() {
+				continue
+			}
+			if !e.next.After(now) {
+				if e.cancel != nil {
+					m.logger.Warn("Schedule skipped; its previous run has not finished", zap.String("schedule_id", e.schedule.ID))
+				} else if err := m.startLocked(e, storage.TriggerSchedule, nil); err != nil {
+					m.logger.Error("Failed to start schedule run", zap.String("schedule_id", e.schedule.ID), zap.Error(err))
+				}
+				e.next = e.expr.Next(now.In(e.next.Location()))
+				if e.next.IsZero() {
+					continue
+				}
+			}
+			if d := e.next.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		m.mu.Unlock()
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-m.wake:
+		case <-m.stop:
+			return
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// startLocked starts a run of e in the background; m.mu must be held. The
+// finished run is also sent to result if it is not nil.
+func (m *Manager) startLocked(e *entry, trigger string, result chan<- storage.ScheduleRun) error {
+	runID, err := ids.New("run_")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	e.cancel = cancel
+	sc := e.schedule
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		run := m.execute(ctx, runID, sc, trigger)
+
+		m.mu.Lock()
+		current, tracked := m.entries[sc.ID]
+		if tracked && current == e {
+			e.cancel = nil
+		}
+		history := m.history
+		m.mu.Unlock()
+
+		// A schedule deleted during the run has no history to add to
+		if tracked {
+			if err := m.store.SaveScheduleRun(context.Background(), run, history); err != nil {
+				m.logger.Error("Failed to save schedule run", zap.String("schedule_id", sc.ID), zap.Error(err))
+			}
+		}
+		m.notify(run)
+		if result != nil {
+			result <- run
+		}
+	}()
+	return nil
+}
+
+// execute runs a schedule's query as run id and checks its assertions
+func (m *Manager) execute(ctx context.Context, id string, sc storage.Schedule, trigger string) storage.ScheduleRun {
+	run := storage.ScheduleRun{
+		ID:           id,
+		ScheduleID:   sc.ID,
+		ScheduleName: sc.Name,
+		Trigger:      trigger,
+		Assertions:   []storage.AssertionResult{},
+		Columns:      []database.Column{},
+		Rows:         [][]interface{}{},
+		StartedAt:    time.Now().UTC(),
+	}
+	m.logger.Info("Schedule run started", zap.String("schedule_id", sc.ID), zap.String("run_id", run.ID), zap.String("trigger", trigger))
+
+	rows := newCollector(MaxStoredRows, sc.Assertions)
+	res, err := m.exec(ctx, sc, rows)
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Status, run.Error = storage.RunError, err.Error()
+		m.logger.Warn("Schedule run failed", zap.String("schedule_id", sc.ID), zap.String("run_id", run.ID), zap.Error(err))
+		return run
+	}
+
+	run.Columns, run.Rows, run.RowCount = rows.columns, rows.rows, rows.count
+	run.RowsAffected, run.Truncated = res.RowsAffected, res.Truncated
+	run.Status = storage.RunPassed
+	for _, a := range sc.Assertions {
+		r := evaluate(a, rows, res.Truncated)
+		if !r.Passed {
+			run.Status = storage.RunFailed
+		}
+		run.Assertions = append(run.Assertions, r)
+	}
+	m.logger.Info("Schedule run finished",
+		zap.String("schedule_id", sc.ID),
+		zap.String("run_id", run.ID),
+		zap.String("status", run.Status),
+		zap.Int64("rows", run.RowCount),
+	)
+	return run
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"litebase-backend/internal/ids"
+)
+
+var (
+	// ErrNotFound is returned for unknown secret IDs
+	ErrNotFound = errors.New("secret not found")
+	// ErrLocked is returned while a backend is locked
+	ErrLocked = errors.New("secret store is locked")
+	// ErrWrongPassphrase is returned when a vault passphrase does not decrypt it
+	ErrWrongPassphrase = errors.New("incorrect passphrase")
+	// ErrInvalidID is returned for malformed secret IDs
+	ErrInvalidID = errors.New("invalid secret id")
+)
+
+// Backend names
+const (
+	BackendAuto          = "auto"           // Secret Service when available, else the file vault
+	BackendSecretService = "secret-service" // freedesktop.org Secret Service over D-Bus
+	BackendFile          = "file"           // Encrypted file vault
+)
+
+// idPattern matches valid secret IDs
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// Info describes a stored secret without its value
+type Info struct {
+	ID    string `msgpack:"id"`
+	Label string `msgpack:"label"`
+}
+
+// Backend stores secret values by ID
+type Backend interface {
+	// Name returns the backend name, e.g. "file"
+	Name() string
+	// Get returns the value of a secret
+	Get(ctx context.Context, id string) (string, error)
+	// Set creates or replaces a secret
+	Set(ctx context.Context, id, label, value string) error
+	// Delete removes a secret
+	Delete(ctx context.Context, id string) error
+	// List describes every stored secret
+	List(ctx context.Context) ([]Info, error)
+	// Close releases the backend
+	Close() error
+}
+
+// Locker is implemented by backends that must be unlocked before use
+type Locker interface {
+	// Unlock opens the backend with a passphrase, creating it if needed
+	Unlock(passphrase string) error
+	// Lock forgets the key and decrypted contents
+	Lock()
+	// Locked reports whether the backend is locked
+	Locked() bool
+}
+
+// Options selects and configures a backend
+type Options struct {
+	Backend    string // auto, secret-service or file
+	VaultPath  string // File vault location
+	BusAddress string // Session bus address; empty uses $DBUS_SESSION_BUS_ADDRESS
+}
+
+// Open returns the configured backend. With "auto" the Secret Service is used
+// when it answers and the file vault otherwise.
+func Open(ctx context.Context, opts Options) (Backend, error) {
+	switch opts.Backend {
+	case BackendSecretService:
+		return NewSecretService(ctx, opts.BusAddress)
+	case BackendFile:
+		return NewVault(opts.VaultPath), nil
+	case BackendAuto, "":
+		if service, err := NewSecretService(ctx, opts.BusAddress); err == nil {
+			return service, nil
+		}
+		return NewVault(opts.VaultPath), nil
+	default:
+		return nil, fmt.Errorf("unsupported secrets backend %q", opts.Backend)
+	}
+}
+
+// ValidateID checks that id can name a secret
+func ValidateID(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q (use up to 128 letters, digits, '_', '.' or '-')", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// NewID generates a random secret identifier
+func NewID() (string, error) {
+	return ids.New("sec_")
+}
@@ -0,0 +1,284 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// D-Bus names of the freedesktop.org Secret Service API
+const (
+	ssName              = "org.freedesktop.secrets"
+	ssPath              = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssServiceIface      = "org.freedesktop.Secret.Service"
+	ssCollectionIface   = "org.freedesktop.Secret.Collection"
+	ssItemIface         = "org.freedesktop.Secret.Item"
+	ssSessionIface      = "org.freedesktop.Secret.Session"
+	ssPromptIface       = "org.freedesktop.Secret.Prompt"
+	ssPropertiesGet     = "org.freedesktop.DBus.Properties.Get"
+	ssNoPrompt          = dbus.ObjectPath("/")
+	ssAttrApplication   = "application"
+	ssAttrID            = "litebase-secret-id"
+	ssApplication       = "litebase"
+	ssDefaultCollection = "default"
+)
+
+// ssSecret is the Secret Service (oayays) secret struct
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService stores secrets in the desktop keyring (GNOME Keyring,
+// KWallet) through the freedesktop.org Secret Service D-Bus API. Values cross
+// the session bus with the "plain" algorithm; the bus is private to the user.
+type SecretService struct {
+	conn       *dbus.Conn
+	session    dbus.ObjectPath
+	collection dbus.ObjectPath
+}
+
+// NewSecretService connects to the Secret Service on the session bus at
+// address, or the user's session bus when address is empty
+func NewSecretService(ctx context.Context, address string) (*SecretService, error) {
+	if address == "" {
+		address = sessionBusAddress()
+	}
+	if address == "" {
+		return nil, fmt.Errorf("no session bus is running")
+	}
+	// dbus.WithContext would close the connection when ctx ends, so ctx only bounds the calls
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	s := &SecretService{conn: conn}
+	service := conn.Object(ssName, ssPath)
+
+	var output dbus.Variant
+	if err := service.CallWithContext(ctx, ssServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &s.session); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("secret service unavailable: %w", err)
+	}
+
+	if err := service.CallWithContext(ctx, ssServiceIface+".ReadAlias", 0, ssDefaultCollection).Store(&s.collection); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to find default keyring: %w", err)
+	}
+	if s.collection == ssNoPrompt {
+		s.Close()
+		return nil, fmt.Errorf("secret service has no default keyring")
+	}
+
+	return s, nil
+}
+
+// sessionBusAddress returns the user's session bus address without
+// autolaunching a bus the way dbus.ConnectSessionBus would
+func sessionBusAddress() string {
+	if address := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); address != "" {
+		return address
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		path := filepath.Join(runtimeDir, "bus")
+		if _, err := os.Stat(path); err == nil {
+			return "unix:path=" + path
+		}
+	}
+	return ""
+}
+
+// Name returns "secret-service"
+func (s *SecretService) Name() string {
+	return BackendSecretService
+}
+
+// Get returns the value of a secret, unlocking the keyring if needed
+func (s *SecretService) Get(ctx context.Context, id string) (string, error) {
+	items, err := s.search(ctx, map[string]string{ssAttrApplication: ssApplication, ssAttrID: id})
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := s.unlock(ctx, items[:1]); err != nil {
+		return "", err
+	}
+
+	var secret ssSecret
+	if err := s.conn.Object(ssName, items[0]).CallWithContext(ctx, ssItemIface+".GetSecret", 0, s.session).Store(&secret); err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", id, err)
+	}
+	return string(secret.Value), nil
+}
+
+// Set creates or replaces a secret in the default keyring
+func (s *SecretService) Set(ctx context.Context, id, label, value string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+	if err := s.unlock(ctx, []dbus.ObjectPath{s.collection}); err != nil {
+		return err
+	}
+
+	if label == "" {
+		label = "LiteBase " + id
+	}
+	properties := map[string]dbus.Variant{
+		ssItemIface + ".Label":      dbus.MakeVariant(label),
+		ssItemIface + ".Attributes": dbus.MakeVariant(map[string]string{ssAttrApplication: ssApplication, ssAttrID: id}),
+	}
+	secret := ssSecret{Session: s.session, Value: []byte(value), ContentType: "text/plain; charset=utf8"}
+
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(ssName, s.collection).
+		CallWithContext(ctx, ssCollectionIface+".CreateItem", 0, properties, secret, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to store secret %s: %w", id, err)
+	}
+	if prompt != ssNoPrompt {
+		if _, err := s.prompt(ctx, prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a secret
+func (s *SecretService) Delete(ctx context.Context, id string) error {
+	items, err := s.search(ctx, map[string]string{ssAttrApplication: ssApplication, ssAttrID: id})
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(ssName, item).CallWithContext(ctx, ssItemIface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete secret %s: %w", id, err)
+		}
+		if prompt != ssNoPrompt {
+			if _, err := s.prompt(ctx, prompt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List describes every LiteBase secret in the default keyring, ordered by ID
+func (s *SecretService) List(ctx context.Context) ([]Info, error) {
+	items, err := s.search(ctx, map[string]string{ssAttrApplication: ssApplication})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]Info, 0, len(items))
+	for _, item := range items {
+		obj := s.conn.Object(ssName, item)
+		var attrs map[string]string
+		if err := obj.CallWithContext(ctx, ssPropertiesGet, 0, ssItemIface, "Attributes").Store(&attrs); err != nil {
+			return nil, fmt.Errorf("failed to read secret attributes: %w", err)
+		}
+		info := Info{ID: attrs[ssAttrID]}
+		var label string
+		if err := obj.CallWithContext(ctx, ssPropertiesGet, 0, ssItemIface, "Label").Store(&label); err == nil {
+			info.Label = label
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// Close ends the Secret Service session and disconnects from the bus
+func (s *SecretService) Close() error {
+	if s.session != "" {
+		s.conn.Object(ssName, s.session).Call(ssSessionIface+".Close", 0)
+	}
+	return s.conn.Close()
+}
+
+// search returns the items in the default keyring matching attributes
+func (s *SecretService) search(ctx context.Context, attributes map[string]string) ([]dbus.ObjectPath, error) {
+	var items []dbus.ObjectPath
+	err := s.conn.Object(ssName, s.collection).
+		CallWithContext(ctx, ssCollectionIface+".SearchItems", 0, attributes).
+		Store(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search secrets: %w", err)
+	}
+	return items, nil
+}
+
+// unlock unlocks items or collections, prompting the user when the service asks to
+func (s *SecretService) unlock(ctx context.Context, objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.conn.Object(ssName, ssPath).
+		CallWithContext(ctx, ssServiceIface+".Unlock", 0, objects).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	if prompt == ssNoPrompt {
+		return nil
+	}
+
+	result, err := s.prompt(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	if paths, ok := result.Value().([]dbus.ObjectPath); ok && len(paths) < len(objects) {
+		return ErrLocked
+	}
+	return nil
+}
+
+// prompt shows a Secret Service prompt and waits for it to complete.
+// A dismissed prompt is reported as ErrLocked.
+func (s *SecretService) prompt(ctx context.Context, path dbus.ObjectPath) (dbus.Variant, error) {
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	match := []dbus.MatchOption{dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(ssPromptIface), dbus.WithMatchMember("Completed")}
+	if err := s.conn.AddMatchSignalContext(ctx, match...); err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to watch keyring prompt: %w", err)
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+
+	obj := s.conn.Object(ssName, path)
+	if err := obj.CallWithContext(ctx, ssPromptIface+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to show keyring prompt: %w", err)
+	}
+
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != path || !strings.HasSuffix(signal.Name, ".Completed") || len(signal.Body) < 2 {
+				continue
+			}
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return dbus.Variant{}, ErrLocked
+			}
+			result, _ := signal.Body[1].(dbus.Variant)
+			return result, nil
+		case <-ctx.Done():
+			obj.Call(ssPromptIface+".Dismiss", 0)
+			return dbus.Variant{}, ctx.Err()
+		}
+	}
+}
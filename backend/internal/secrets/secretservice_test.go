@@ -0,0 +1,263 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeKeyring implements the parts of the Secret Service API the backend
+// uses, with an always unlocked default collection
+type fakeKeyring struct {
+	conn *dbus.Conn
+
+	mu    sync.Mutex
+	items map[dbus.ObjectPath]*fakeItem
+	next  int
+}
+
+const fakeCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+
+// fakeService is exported at ssPath
+type fakeService struct{ k *fakeKeyring }
+
+func (s fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", algorithm))
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s fakeService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name != ssDefaultCollection {
+		return ssNoPrompt, nil
+	}
+	return fakeCollection, nil
+}
+
+func (s fakeService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, ssNoPrompt, nil
+}
+
+// fakeCollectionObject is exported at fakeCollection
+type fakeCollectionObject struct{ k *fakeKeyring }
+
+func (c fakeCollectionObject) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	var found []dbus.ObjectPath
+	for path, item := range c.k.items {
+		if item.matches(attributes) {
+			found = append(found, path)
+		}
+	}
+	return found, nil
+}
+
+func (c fakeCollectionObject) CreateItem(properties map[string]dbus.Variant, secret ssSecret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	label, _ := properties[ssItemIface+".Label"].Value().(string)
+	attributes, _ := properties[ssItemIface+".Attributes"].Value().(map[string]string)
+
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	if replace {
+		for path, item := range c.k.items {
+			if item.matches(attributes) {
+				item.label, item.value = label, secret.Value
+				return path, ssNoPrompt, nil
+			}
+		}
+	}
+	c.k.next++
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", fakeCollection, c.k.next))
+	item := &fakeItem{k: c.k, path: path, label: label, attributes: attributes, value: secret.Value}
+	c.k.items[path] = item
+	c.k.conn.Export(item, path, ssItemIface)
+	c.k.conn.Export(fakeProperties{item}, path, "org.freedesktop.DBus.Properties")
+	return path, ssNoPrompt, nil
+}
+
+// fakeItem is one stored secret
+type fakeItem struct {
+	k          *fakeKeyring
+	path       dbus.ObjectPath
+	label      string
+	attributes map[string]string
+	value      []byte
+}
+
+func (i *fakeItem) matches(attributes map[string]string) bool {
+	for k, v := range attributes {
+		if i.attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *fakeItem) GetSecret(session dbus.ObjectPath) (ssSecret, *dbus.Error) {
+	i.k.mu.Lock()
+	defer i.k.mu.Unlock()
+	return ssSecret{Session: session, Value: i.value, ContentType: "text/plain"}, nil
+}
+
+func (i *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.k.mu.Lock()
+	defer i.k.mu.Unlock()
+	delete(i.k.items, i.path)
+	i.k.conn.Export(nil, i.path, ssItemIface)
+	i.k.conn.Export(nil, i.path, "org.freedesktop.DBus.Properties")
+	return ssNoPrompt, nil
+}
+
+// fakeProperties serves org.freedesktop.DBus.Properties for an item
+type fakeProperties struct{ item *fakeItem }
+
+func (p fakeProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.item.k.mu.Lock()
+	defer p.item.k.mu.Unlock()
+	switch {
+	case iface == ssItemIface && name == "Label":
+		return dbus.MakeVariant(p.item.label), nil
+	case iface == ssItemIface && name == "Attributes":
+		return dbus.MakeVariant(p.item.attributes), nil
+	}
+	return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown property %s.%s", iface, name))
+}
+
+// fakeSession is exported at the session path
+type fakeSession struct{}
+
+func (fakeSession) Close() *dbus.Error { return nil }
+
+// startFakeKeyring runs a private session bus with a fake Secret Service on
+// it and returns the bus address
+func startFakeKeyring(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	address := "unix:path=" + filepath.Join(dir, "bus")
+	err = os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>`+address+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--nofork", "--config-file="+config)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	var conn *dbus.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if conn, err = dbus.Connect(address); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed to connect to the test bus: %v", err)
+		}
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	k := &fakeKeyring{conn: conn, items: make(map[dbus.ObjectPath]*fakeItem)}
+	conn.Export(fakeService{k}, ssPath, ssServiceIface)
+	conn.Export(fakeCollectionObject{k}, fakeCollection, ssCollectionIface)
+	conn.Export(fakeSession{}, "/org/freedesktop/secrets/session/1", ssSessionIface)
+	reply, err := conn.RequestName(ssName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", ssName, err)
+	}
+	return address
+}
+
+func TestSecretService(t *testing.T) {
+	address := startFakeKeyring(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := NewSecretService(ctx, address)
+	if err != nil {
+		t.Fatalf("NewSecretService: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Set(ctx, "db.prod", "Production", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set(ctx, "db.dev", "", "devpass"); err != nil {
+		t.Fatalf("Set without label: %v", err)
+	}
+	if got, err := s.Get(ctx, "db.prod"); err != nil || got != "hunter2" {
+		t.Fatalf("Get = %q, %v; want hunter2", got, err)
+	}
+
+	// Setting an existing ID replaces the value
+	if err := s.Set(ctx, "db.prod", "Production", "changed"); err != nil {
+		t.Fatalf("Set replacement: %v", err)
+	}
+	if got, err := s.Get(ctx, "db.prod"); err != nil || got != "changed" {
+		t.Fatalf("Get after replace = %q, %v; want changed", got, err)
+	}
+
+	infos, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []Info{{ID: "db.dev", Label: "LiteBase db.dev"}, {ID: "db.prod", Label: "Production"}}
+	if fmt.Sprint(infos) != fmt.Sprint(want) {
+		t.Fatalf("List = %v, want %v", infos, want)
+	}
+
+	if err := s.Delete(ctx, "db.prod"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "db.prod"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after delete: error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "db.prod"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete of a missing secret: error = %v, want ErrNotFound", err)
+	}
+	if err := s.Set(ctx, "bad id", "", "x"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Set with an invalid id: error = %v, want ErrInvalidID", err)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	id, err := NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateID(id); err != nil {
+		t.Errorf("NewID returned an invalid id: %v", err)
+	}
+	if other, _ := NewID(); other == id {
+		t.Errorf("NewID returned %s twice", id)
+	}
+}
@@ -0,0 +1,293 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/crypto/argon2"
+)
+
+// vaultVersion is the current vault file format
+const vaultVersion = 1
+
+// vaultAAD binds the ciphertext to the file format
+var vaultAAD = []byte("litebase-vault-v1")
+
+// Default argon2id parameters (RFC 9106 second recommended option)
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	argonKeyLen  = 32
+	saltLen      = 16
+)
+
+// kdfParams records how the vault key was derived from the passphrase
+type kdfParams struct {
+	Algorithm string `msgpack:"algorithm"` // "argon2id"
+	Salt      []byte `msgpack:"salt"`
+	Time      uint32 `msgpack:"time"`
+	Memory    uint32 `msgpack:"memory"` // KiB
+	Threads   uint8  `msgpack:"threads"`
+}
+
+// vaultFile is the on-disk vault: KDF parameters and the AES-GCM sealed entries
+type vaultFile struct {
+	Version    int       `msgpack:"version"`
+	KDF        kdfParams `msgpack:"kdf"`
+	Nonce      []byte    `msgpack:"nonce"`
+	Ciphertext []byte    `msgpack:"ciphertext"`
+}
+
+// vaultEntry is one decrypted secret
+type vaultEntry struct {
+	Label string `msgpack:"label"`
+	Value string `msgpack:"value"`
+}
+
+// Vault keeps secrets in a file encrypted with AES-256-GCM under a key
+// derived from a passphrase with argon2id. It starts locked.
+type Vault struct {
+	path string
+
+	mu      sync.Mutex
+	kdf     kdfParams
+	aead    cipher.AEAD           // nil while locked
+	entries map[string]vaultEntry // nil while locked
+}
+
+// NewVault returns a locked vault stored at path
+func NewVault(path string) *Vault {
+	return &Vault{path: path}
+}
+
+// Name returns "file"
+func (v *Vault) Name() string {
+	return BackendFile
+}
+
+// Path returns the vault file location
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Locked reports whether the vault is locked
+func (v *Vault) Locked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.aead == nil
+}
+
+// Unlock derives the key and decrypts the vault. A missing vault file is
+// created, protected by this passphrase.
+func (v *Vault) Unlock(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("passphrase is required")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	data, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		kdf := kdfParams{Algorithm: "argon2id", Salt: salt, Time: argonTime, Memory: argonMemory, Threads: argonThreads}
+		aead, err := newAEAD(passphrase, kdf)
+		if err != nil {
+			return err
+		}
+		v.kdf, v.aead, v.entries = kdf, aead, make(map[string]vaultEntry)
+		if err := v.save(); err != nil {
+			v.aead, v.entries = nil, nil
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var file vaultFile
+	if err := msgpack.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("corrupt vault %s: %w", v.path, err)
+	}
+	if file.Version != vaultVersion || file.KDF.Algorithm != "argon2id" {
+		return fmt.Errorf("unsupported vault format %d (%s)", file.Version, file.KDF.Algorithm)
+	}
+
+	aead, err := newAEAD(passphrase, file.KDF)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, vaultAAD)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+	entries := make(map[string]vaultEntry)
+	if err := msgpack.Unmarshal(plaintext, &entries); err != nil {
+		return fmt.Errorf("corrupt vault contents: %w", err)
+	}
+
+	v.kdf, v.aead, v.entries = file.KDF, aead, entries
+	return nil
+}
+
+// Lock forgets the key and the decrypted secrets
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.aead, v.entries = nil, nil
+}
+
+// Get returns the value of a secret
+func (v *Vault) Get(ctx context.Context, id string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.aead == nil {
+		return "", ErrLocked
+	}
+	entry, ok := v.entries[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return entry.Value, nil
+}
+
+// Set creates or replaces a secret and rewrites the vault file
+func (v *Vault) Set(ctx context.Context, id, label, value string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.aead == nil {
+		return ErrLocked
+	}
+
+	previous, existed := v.entries[id]
+	v.entries[id] = vaultEntry{Label: label, Value: value}
+	if err := v.save(); err != nil {
+		if existed {
+			v.entries[id] = previous
+		} else {
+			delete(v.entries, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a secret and rewrites the vault file
+func (v *Vault) Delete(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.aead == nil {
+		return ErrLocked
+	}
+
+	previous, ok := v.entries[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	delete(v.entries, id)
+	if err := v.save(); err != nil {
+		v.entries[id] = previous
+		return err
+	}
+	return nil
+}
+
+// List describes every secret, ordered by ID
+func (v *Vault) List(ctx context.Context) ([]Info, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.aead == nil {
+		return nil, ErrLocked
+	}
+
+	infos := make([]Info, 0, len(v.entries))
+	for id, entry := range v.entries {
+		infos = append(infos, Info{ID: id, Label: entry.Label})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// Close locks the vault
+func (v *Vault) Close() error {
+	v.Lock()
+	return nil
+}
+
+// save encrypts the entries with a fresh nonce and atomically replaces the
+// vault file. The caller holds v.mu.
+func (v *Vault) save() error {
+	plaintext, err := msgpack.Marshal(v.entries)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := msgpack.Marshal(vaultFile{
+		Version:    vaultVersion,
+		KDF:        v.kdf,
+		Nonce:      nonce,
+		Ciphertext: v.aead.Seal(nil, nonce, plaintext, vaultAAD),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("failed to create vault directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), v.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	return nil
+}
+
+// newAEAD derives the vault key from the passphrase and returns its AES-GCM cipher
+func newAEAD(passphrase string, kdf kdfParams) (cipher.AEAD, error) {
+	if kdf.Time == 0 || kdf.Memory == 0 || kdf.Threads == 0 || len(kdf.Salt) == 0 {
+		return nil, fmt.Errorf("invalid vault key derivation parameters")
+	}
+	key := argon2.IDKey([]byte(passphrase), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, argonKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
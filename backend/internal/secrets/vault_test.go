@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// newTestVault returns an unlocked vault in a fresh directory
+func newTestVault(t *testing.T) *Vault {
+	t.Helper()
+	v := NewVault(filepath.Join(t.TempDir(), "secrets", "vault"))
+	if err := v.Unlock("correct horse"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	return v
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	v := newTestVault(t)
+	if err := v.Set(ctx, "sec_db", "Production", "s3cret"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := v.Set(ctx, "sec_gone", "", "x"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := v.Delete(ctx, "sec_gone"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	v.Close()
+
+	if _, err := v.Get(ctx, "sec_db"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Get on a locked vault error = %v, want ErrLocked", err)
+	}
+
+	reopened := NewVault(v.Path())
+	if err := reopened.Unlock("correct horse"); err != nil {
+		t.Fatalf("Unlock after reopen: %v", err)
+	}
+	got, err := reopened.Get(ctx, "sec_db")
+	if err != nil || got != "s3cret" {
+		t.Errorf("Get = %q, %v; want s3cret", got, err)
+	}
+	if _, err := reopened.Get(ctx, "sec_gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted secret error = %v, want ErrNotFound", err)
+	}
+	infos, err := reopened.List(ctx)
+	if err != nil || len(infos) != 1 || infos[0] != (Info{ID: "sec_db", Label: "Production"}) {
+		t.Errorf("List = %+v, %v; want sec_db only", infos, err)
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	v := newTestVault(t)
+	v.Close()
+
+	if err := NewVault(v.Path()).Unlock("wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock error = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestVaultFileMode(t *testing.T) {
+	v := newTestVault(t)
+	if err := v.Set(context.Background(), "sec_db", "", "s3cret"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	info, err := os.Stat(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("vault file mode = %o, want 600", mode)
+	}
+	dir, err := os.Stat(filepath.Dir(v.Path()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := dir.Mode().Perm(); mode != 0700 {
+		t.Errorf("vault directory mode = %o, want 700", mode)
+	}
+}
+
+func TestVaultTamperedCiphertext(t *testing.T) {
+	v := newTestVault(t)
+	if err := v.Set(context.Background(), "sec_db", "", "s3cret"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	v.Close()
+
+	data, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file vaultFile
+	if err := msgpack.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Ciphertext[len(file.Ciphertext)/2] ^= 0x01
+	if data, err = msgpack.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v.Path(), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// GCM authentication fails like a wrong key would
+	if err := NewVault(v.Path()).Unlock("correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock error = %v, want ErrWrongPassphrase", err)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/config"
+	"litebase-backend/internal/cursor"
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// cursorOpenRequest is a query whose rows are spooled for paging
+type cursorOpenRequest struct {
+	ConnectionID      string           `msgpack:"connection_id"`
+	SQL               string           `msgpack:"sql"`
+	ConfirmationToken string           `msgpack:"confirmation_token"`
+	Params            []database.Param `msgpack:"params"`
+	database.QueryLimits
+}
+
+// cursorRequest identifies a cursor, or one of its views, and for fetches a
+// row range
+type cursorRequest struct {
+	CursorID string `msgpack:"cursor_id"`
+	ViewID   string `msgpack:"view_id"`
+	Offset   int64  `msgpack:"offset"`
+	Limit    int64  `msgpack:"limit"`
+	Wait     bool   `msgpack:"wait"` // cursor_count waits until every row is spooled
+}
+
+// cursorViewRequest sorts and filters the rows of a cursor
+type cursorViewRequest struct {
+	CursorID string `msgpack:"cursor_id"`
+	cursor.ViewOptions
+}
+
+// cursorError maps cursor failures to an error response
+func cursorError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, cursor.ErrNotFound):
+		return errorMessage(err, 404, "Unknown cursor")
+	case errors.Is(err, cursor.ErrInvalid):
+		return errorMessage(err, 400, "Invalid cursor request")
+	case errors.Is(err, cursor.ErrQuotaExceeded):
+		return errorMessage(err, 507, "Cursor disk quota exceeded")
+	default:
+		return queryError(err)
+	}
+}
+
+// watchCursors closes a session's cursors when its client disconnects, and
+// keeps the session open while it has any
+func (s *Server) watchCursors(session *ipc.Session) {
+	if _, loaded := s.cursorSessions.LoadOrStore(session.ID, true); loaded {
+		return
+	}
+	session.AllowIdle(func() bool {
+		return s.cursors.HasCursors(session.ID)
+	})
+	session.OnClose(func() {
+		s.cursorSessions.Delete(session.ID)
+		if n := s.cursors.CloseOwner(session.ID); n > 0 {
+			s.logger.Info("Closed cursors of disconnected client",
+				zap.String("session", session.ID), zap.Int("cursors", n))
+		}
+	})
+}
+
+// handleCursorOpen runs a query and spools its rows into a new cursor
+func (s *Server) handleCursorOpen(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req cursorOpenRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid cursor request"), err), nil
+	}
+	session, ok := ipc.SessionFromContext(ctx)
+	if !ok {
+		return errorMessage(fmt.Errorf("cursors need a client session"), 400, "Invalid cursor request"), nil
+	}
+
+	s.logger.Debug("Cursor open request received", zap.String("id", msg.ID), zap.String("connection_id", req.ConnectionID))
+
+	s.watchCursors(session)
+	opts := database.QueryOptions{
+		ConfirmationToken: req.ConfirmationToken,
+		Owner:             session.ID,
+		Params:            req.Params,
+		Limits:            req.QueryLimits,
+	}
+	info, err := s.cursors.Open(ctx, req.ConnectionID, session.ID, func(ctx context.Context, sink database.RowSink) (*database.Result, error) {
+		return s.db.Stream(ctx, req.ConnectionID, req.SQL, opts, sink)
+	})
+	if err != nil {
+		return cursorError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeCursorOpenResponse, map[string]interface{}{
+		"cursor": info,
+	}), nil
+}
+
+// handleCursorFetch returns a range of rows of a cursor or view
+func (s *Server) handleCursorFetch(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req cursorRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid cursor request"), nil
+	}
+
+	if req.ViewID != "" {
+		rows, view, err := s.cursors.FetchView(ctx, req.CursorID, req.ViewID, sessionOwner(ctx), req.Offset, req.Limit)
+		if err != nil {
+			return cursorError(err), nil
+		}
+		return protocol.NewMessage(protocol.MessageTypeCursorFetchResponse, map[string]interface{}{
+			"cursor_id": req.CursorID,
+			"view_id":   req.ViewID,
+			"offset":    req.Offset,
+			"rows":      rows,
+			"view":      view,
+		}), nil
+	}
+
+	rows, info, err := s.cursors.Fetch(ctx, req.CursorID, sessionOwner(ctx), req.Offset, req.Limit)
+	if err != nil {
+		return cursorError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeCursorFetchResponse, map[string]interface{}{
+		"cursor_id": req.CursorID,
+		"offset":    req.Offset,
+		"rows":      rows,
+		"cursor":    info,
+	}), nil
+}
+
+// handleCursorCount returns the number of rows spooled so far, or the total
+// once spooling is done
+func (s *Server) handleCursorCount(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req cursorRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid cursor request"), nil
+	}
+
+	info, err := s.cursors.Count(ctx, req.CursorID, sessionOwner(ctx), req.Wait)
+	if err != nil {
+		return cursorError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeCursorCountResponse, map[string]interface{}{
+		"cursor_id": req.CursorID,
+		"rows":      info.Rows,
+		"done":      info.Done,
+		"cursor":    info,
+	}), nil
+}
+
+// handleCursorView sorts and filters the rows of a cursor into a new view
+func (s *Server) handleCursorView(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req cursorViewRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid cursor request"), nil
+	}
+
+	view, err := s.cursors.CreateView(ctx, req.CursorID, sessionOwner(ctx), req.ViewOptions)
+	if err != nil {
+		return cursorError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeCursorViewResponse, map[string]interface{}{
+		"view": view,
+	}), nil
+}
+
+// handleCursorClose stops a cursor and deletes its rows, or drops one of its views
+func (s *Server) handleCursorClose(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req cursorRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid cursor request"), nil
+	}
+
+	if req.ViewID != "" {
+		if err := s.cursors.CloseView(req.CursorID, req.ViewID, sessionOwner(ctx)); err != nil {
+			return cursorError(err), nil
+		}
+		return protocol.NewMessage(protocol.MessageTypeCursorCloseResponse, map[string]interface{}{
+			"cursor_id": req.CursorID,
+			"view_id":   req.ViewID,
+		}), nil
+	}
+
+	if err := s.cursors.Close(req.CursorID, sessionOwner(ctx)); err != nil {
+		return cursorError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeCursorCloseResponse, map[string]interface{}{
+		"cursor_id": req.CursorID,
+	}), nil
+}
+
+// registerCursorHandlers registers the cursor message handlers
+func (s *Server) registerCursorHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeCursorOpen, s.handleCursorOpen)
+	s.ipc.RegisterHandler(protocol.MessageTypeCursorFetch, s.handleCursorFetch)
+	s.ipc.RegisterHandler(protocol.MessageTypeCursorCount, s.handleCursorCount)
+	s.ipc.RegisterHandler(protocol.MessageTypeCursorView, s.handleCursorView)
+	s.ipc.RegisterHandler(protocol.MessageTypeCursorClose, s.handleCursorClose)
+}
+
+// diskQuotaBytes converts the configured cursor disk quota
+func diskQuotaBytes(cursors config.CursorsConfig) int64 {
+	return int64(cursors.DiskQuotaMB) << 20
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"litebase-backend/internal/config"
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// topicConnectionState is the event topic for connection state changes
+const topicConnectionState = "connection_state"
+
+// connectionRequest identifies an open connection in a message payload
+type connectionRequest struct {
+	ConnectionID string `msgpack:"connection_id"`
+}
+
+// savedProfileRequest selects a saved profile to connect with
+type savedProfileRequest struct {
+	ProfileID string `msgpack:"profile_id"`
+	Password  string `msgpack:"password"`
+}
+
+// poolOptionsFrom converts the configured pool defaults
+func poolOptionsFrom(pool config.PoolConfig) database.PoolOptions {
+	return database.PoolOptions{
+		MaxOpen:        pool.MaxOpen,
+		MaxIdle:        pool.MaxIdle,
+		IdleTimeoutMs:  pool.IdleTimeout.Std().Milliseconds(),
+		MaxLifetimeMs:  pool.MaxLifetime.Std().Milliseconds(),
+		StatementCache: pool.StatementCache,
+	}
+}
+
+// driverDefaultsFrom converts the configured driver defaults
+func driverDefaultsFrom(drivers config.DriversConfig) map[string]database.DriverDefaults {
+	convert := func(d config.DriverConfig) database.DriverDefaults {
+		return database.DriverDefaults{
+			ConnectTimeout: d.ConnectTimeout.Std().Milliseconds(),
+			Params:         d.Params,
+		}
+	}
+	return map[string]database.DriverDefaults{
+		database.DriverPostgres: convert(drivers.Postgres),
+		database.DriverMySQL:    convert(drivers.MySQL),
+		database.DriverSQLite:   convert(drivers.SQLite),
+	}
+}
+
+// healthOptionsFrom converts the configured monitor settings
+func healthOptionsFrom(health config.HealthConfig) database.HealthOptions {
+	return database.HealthOptions{
+		Interval:         health.Interval.Std(),
+		Timeout:          health.Timeout.Std(),
+		SlowThreshold:    health.SlowThreshold.Std(),
+		FailureThreshold: health.FailureThreshold,
+		BackoffInitial:   health.BackoffInitial.Std(),
+		BackoffMax:       health.BackoffMax.Std(),
+		MaxAttempts:      health.MaxAttempts,
+	}
+}
+
+// errorMessage builds an error response message carrying the error in its data
+func errorMessage(err error, code int, details string) *protocol.Message {
+	return protocol.NewMessage(protocol.MessageTypeError, map[string]interface{}{
+		"error":   err.Error(),
+		"code":    code,
+		"details": details,
+	})
+}
+
+// withFieldErrors adds the field-level problems of a connection string parse
+// error or query parameter error to resp
+func withFieldErrors(resp *protocol.Message, err error) *protocol.Message {
+	var parseErr *database.ParseError
+	var paramErr *database.ParamError
+	switch {
+	case errors.As(err, &parseErr):
+		resp.Data["fields"] = parseErr.Fields
+	case errors.As(err, &paramErr):
+		resp.Data["fields"] = paramErr.Fields
+	}
+	return resp
+}
+
+// connectionError maps connection lookup failures to an error response
+func connectionError(err error) *protocol.Message {
+	if errors.Is(err, database.ErrNotFound) {
+		return errorMessage(err, 404, "Unknown connection")
+	}
+	return errorMessage(err, 500, "Internal server error")
+}
+
+// handleDBConnect opens a new database connection
+func (s *Server) handleDBConnect(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var profile database.Profile
+	if err := msg.DecodeData(&profile); err != nil {
+		return errorMessage(err, 400, "Invalid connection request"), nil
+	}
+
+	// A saved profile replaces the inline settings; a password in the request
+	// takes precedence over the profile's password_secret
+	var saved savedProfileRequest
+	if err := msg.DecodeData(&saved); err != nil {
+		return errorMessage(err, 400, "Invalid connection request"), nil
+	}
+	if saved.ProfileID != "" {
+		stored, err := s.store.GetProfile(ctx, saved.ProfileID)
+		if err != nil {
+			return storageError(err), nil
+		}
+		profile = stored.Connection()
+		if saved.Password != "" {
+			profile.Password, profile.PasswordSecret = saved.Password, ""
+		}
+	}
+
+	s.logger.Debug("Database connect request received", zap.String("id", msg.ID), zap.String("driver", profile.Driver))
+
+	conn, err := s.db.Connect(ctx, profile)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidProfile) {
+			return withFieldErrors(errorMessage(err, 400, "Invalid connection request"), err), nil
+		}
+		if errors.Is(err, database.ErrSecretUnavailable) {
+			return secretError(err), nil
+		}
+		return errorMessage(err, 502, "Database connection failed"), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeDBConnectResponse, map[string]interface{}{
+		"connection_id": conn.ID,
+		"name":          conn.Name,
+		"driver":        conn.Driver,
+		"pool":          conn.Pool,
+		"tls":           conn.TLS,
+		"read_only":     conn.ReadOnly,
+		"limits":        conn.Limits,
+	}), nil
+}
+
+// handleDBDisconnect closes a database connection
+func (s *Server) handleDBDisconnect(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req connectionRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid disconnect request"), nil
+	}
+
+	if err := s.db.Disconnect(req.ConnectionID); err != nil {
+		return connectionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeDBDisconnectResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+	}), nil
+}
+
+// handleDBReconnect reopens a connection's pool, e.g. after it has failed
+func (s *Server) handleDBReconnect(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req connectionRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid reconnect request"), nil
+	}
+
+	conn, err := s.db.Reconnect(req.ConnectionID)
+	if err != nil {
+		return connectionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeDBReconnectResponse, map[string]interface{}{
+		"connection_id": conn.ID,
+		"health":        conn.Health(),
+	}), nil
+}
+
+// handlePoolStats reports pool statistics for one or all connections
+func (s *Server) handlePoolStats(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req connectionRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid pool stats request"), nil
+	}
+
+	stats := s.db.Stats()
+	if req.ConnectionID != "" {
+		conn, err := s.db.Get(req.ConnectionID)
+		if err != nil {
+			return connectionError(err), nil
+		}
+		stats = []database.ConnectionStats{conn.Stats()}
+	}
+
+	return protocol.NewMessage(protocol.MessageTypePoolStatsResponse, map[string]interface{}{
+		"connections": stats,
+		"summary":     s.db.Summary(),
+	}), nil
+}
+
+// dsnParseRequest is a connection string to parse
+type dsnParseRequest struct {
+	Input  string `msgpack:"input"`
+	Driver string `msgpack:"driver"` // Needed for native DSNs; URLs name their driver
+}
+
+// handleDSNParse parses a connection URL, JDBC string or native DSN into its parts
+func (s *Server) handleDSNParse(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req dsnParseRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid parse request"), nil
+	}
+
+	parsed, err := database.ParseConnectionString(req.Input, req.Driver)
+	if err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid connection string"), err), nil
+	}
+	profile, err := parsed.Profile()
+	if err != nil {
+		return errorMessage(err, 400, "Invalid connection string"), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeDSNParseResponse, map[string]interface{}{
+		"connection": parsed,
+		"profile":    profile,
+		"display":    parsed.Redacted(),
+	}), nil
+}
+
+// handleDSNFormat builds the driver DSN for connection parts
+func (s *Server) handleDSNFormat(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var parts database.ConnectionURL
+	if err := msg.DecodeData(&parts); err != nil {
+		return errorMessage(err, 400, "Invalid format request"), nil
+	}
+
+	driverName, err := database.NormalizeDriver(parts.Driver)
+	if err != nil {
+		return errorMessage(err, 400, "Invalid format request"), nil
+	}
+	parts.Driver = driverName
+	dsn, err := parts.DSN()
+	if err != nil {
+		return errorMessage(err, 400, "Invalid format request"), nil
+	}
+
+	// Round-trip through the parser so the result gets the same checks as pasted strings
+	parsed, err := database.ParseConnectionString(dsn, driverName)
+	if err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid connection string"), err), nil
+	}
+	profile, _ := parsed.Profile()
+
+	return protocol.NewMessage(protocol.MessageTypeDSNFormatResponse, map[string]interface{}{
+		"dsn":     dsn,
+		"profile": profile,
+		"display": parsed.Redacted(),
+	}), nil
+}
+
+// handleHealthCheck reports server health including pool statistics
+func (s *Server) handleHealthCheck(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	s.logger.Debug("Health check request received", zap.String("id", msg.ID))
+
+	return protocol.NewMessage(protocol.MessageTypeHealthResponse, map[string]interface{}{
+		"status":      s.healthStatus(),
+		"timestamp":   time.Now().Unix(),
+		"version":     "1.0.0",
+		"pools":       s.db.Summary(),
+		"connections": s.db.Stats(),
+	}), nil
+}
+
+// registerDatabaseHandlers registers the database message handlers
+func (s *Server) registerDatabaseHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeHealthCheck, s.handleHealthCheck)
+	s.ipc.RegisterHandler(protocol.MessageTypeDBConnect, s.handleDBConnect)
+	s.ipc.RegisterHandler(protocol.MessageTypeDBDisconnect, s.handleDBDisconnect)
+	s.ipc.RegisterHandler(protocol.MessageTypeDBReconnect, s.handleDBReconnect)
+	s.ipc.RegisterHandler(protocol.MessageTypePoolStats, s.handlePoolStats)
+	s.ipc.RegisterHandler(protocol.MessageTypeDSNParse, s.handleDSNParse)
+	s.ipc.RegisterHandler(protocol.MessageTypeDSNFormat, s.handleDSNFormat)
+}
+
+// healthStatus summarizes connection health: "unhealthy" when a connection
+// has failed, "degraded" while one is degraded or reconnecting
+func (s *Server) healthStatus() string {
+	states := s.db.States()
+	switch {
+	case states[database.StateFailed] > 0:
+		return "unhealthy"
+	case states[database.StateDegraded] > 0, states[database.StateReconnecting] > 0:
+		return "degraded"
+	default:
+		return "healthy"
+	}
+}
+
+// publishStateChange sends a connection state change to subscribed clients
+func publishStateChange(ipcServer *ipc.Server) func(database.StateChange) {
+	return func(change database.StateChange) {
+		ipcServer.Publish(topicConnectionState, map[string]interface{}{
+			"connection_id":  change.ConnectionID,
+			"name":           change.Name,
+			"state":          change.State,
+			"previous_state": change.Previous,
+			"error":          change.Error,
+			"attempt":        change.Attempt,
+			"next_retry_ms":  change.NextRetryMs,
+		})
+	}
+}
+
+// newDatabaseManager creates the connection manager from settings
+func newDatabaseManager(settings *config.Config, cfg *Config, ipcServer *ipc.Server, resolveSecret func(context.Context, string) (string, error), keeper database.ValueKeeper) (*database.Manager, error) {
+	manager, err := database.NewManager(&database.Config{
+		Logger:         cfg.Logger,
+		Pool:           poolOptionsFrom(settings.Pool),
+		MaxConnections: settings.Pool.MaxConnections,
+		AcquireTimeout: settings.Pool.AcquireTimeout.Std(),
+		Drivers:        driverDefaultsFrom(settings.Drivers),
+		Health:         healthOptionsFrom(settings.Health),
+		OnStateChange:  publishStateChange(ipcServer),
+		ResolveSecret:  resolveSecret,
+		MaxValueSize:   settings.Values.MaxSize,
+		Values:         keeper,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection manager: %w", err)
+	}
+	return manager, nil
+}
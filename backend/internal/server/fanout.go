@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/fanout"
+	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// fanoutRequest is a query to run on several connections at once
+type fanoutRequest struct {
+	ConnectionIDs      []string          `msgpack:"connection_ids"`
+	SQL                string            `msgpack:"sql"`
+	Params             []database.Param  `msgpack:"params"`
+	ConfirmationTokens map[string]string `msgpack:"confirmation_tokens"` // By connection ID, for read-only connections
+	Parallelism        int               `msgpack:"parallelism"`
+	database.QueryLimits
+}
+
+// fanoutCancelRequest stops a fan-out, or only its query on one connection
+type fanoutCancelRequest struct {
+	FanoutID     string `msgpack:"fanout_id"`
+	ConnectionID string `msgpack:"connection_id"`
+}
+
+// fanoutError maps fan-out failures to an error response
+func fanoutError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, fanout.ErrNotFound):
+		return errorMessage(err, 404, "Unknown fan-out")
+	case errors.Is(err, fanout.ErrInvalid):
+		return errorMessage(err, 400, "Invalid fan-out request")
+	default:
+		return errorMessage(err, 500, "Internal server error")
+	}
+}
+
+// watchFanouts cancels a session's fan-outs when its client disconnects, and
+// keeps the session open while any is running
+func (s *Server) watchFanouts(session *ipc.Session) {
+	if _, loaded := s.fanoutSessions.LoadOrStore(session.ID, true); loaded {
+		return
+	}
+	session.AllowIdle(func() bool {
+		return s.fanouts.HasRuns(session.ID)
+	})
+	session.OnClose(func() {
+		s.fanoutSessions.Delete(session.ID)
+		if n := s.fanouts.CancelOwner(session.ID); n > 0 {
+			s.logger.Info("Cancelled fan-outs of disconnected client",
+				zap.String("session", session.ID), zap.Int("fanouts", n))
+		}
+	})
+}
+
+// fanoutResult builds the message pushed for the outcome on one connection
+func fanoutResult(o fanout.Outcome) *protocol.Message {
+	data := map[string]interface{}{}
+	switch {
+	case o.Status == fanout.StatusFailed:
+		// The same fields as the error response of a plain query
+		data = queryError(o.Err).Data
+	case o.Err != nil:
+		data["error"] = o.Err.Error()
+	}
+	data["fanout_id"] = o.FanoutID
+	data["connection_id"] = o.ConnectionID
+	data["status"] = o.Status
+	data["duration_ms"] = o.DurationMs
+	if o.Result != nil {
+		data["result"] = o.Result
+	}
+	return protocol.NewMessage(protocol.MessageTypeFanoutResult, data)
+}
+
+// handleFanout starts a query on several connections. The response names the
+// fan-out; each connection's outcome follows as a fanout_result message and
+// the summary as fanout_done.
+func (s *Server) handleFanout(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req fanoutRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid fan-out request"), err), nil
+	}
+	session, ok := ipc.SessionFromContext(ctx)
+	if !ok {
+		return errorMessage(fmt.Errorf("fan-outs need a client session"), 400, "Invalid fan-out request"), nil
+	}
+
+	s.logger.Debug("Fan-out request received", zap.String("id", msg.ID), zap.Strings("connection_ids", req.ConnectionIDs))
+
+	exec := func(ctx context.Context, connectionID string) (*database.Result, error) {
+		conn, err := s.db.Get(connectionID)
+		if err != nil {
+			return nil, err
+		}
+		// Every result is held until it is sent, so each one is capped
+		limits := req.QueryLimits
+		if limits.MaxRows == 0 && conn.Limits.MaxRows == 0 {
+			limits.MaxRows = fanout.DefaultMaxRows
+		}
+		return s.db.Query(ctx, connectionID, req.SQL, database.QueryOptions{
+			ConfirmationToken: req.ConfirmationTokens[connectionID],
+			Owner:             session.ID,
+			Params:            req.Params,
+			Limits:            limits,
+		})
+	}
+	send := func(m *protocol.Message) {
+		if err := session.Send(m); err != nil {
+			s.logger.Debug("Failed to deliver fan-out message", zap.String("session", session.ID), zap.Error(err))
+		}
+	}
+	report := func(o fanout.Outcome) {
+		send(fanoutResult(o))
+	}
+	done := func(summary fanout.Summary) {
+		send(protocol.NewMessage(protocol.MessageTypeFanoutDone, map[string]interface{}{
+			"fanout_id": summary.FanoutID,
+			"summary":   summary,
+		}))
+	}
+
+	info, start, err := s.fanouts.Prepare(session.ID, req.ConnectionIDs, req.Parallelism, exec, report, done)
+	if err != nil {
+		return fanoutError(err), nil
+	}
+	s.watchFanouts(session)
+	// Results must not overtake this response
+	session.AfterReply(start)
+
+	return protocol.NewMessage(protocol.MessageTypeFanoutResponse, map[string]interface{}{
+		"fanout": info,
+	}), nil
+}
+
+// handleFanoutCancel cancels a fan-out or its query on one connection
+func (s *Server) handleFanoutCancel(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req fanoutCancelRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid fan-out request"), nil
+	}
+
+	if err := s.fanouts.Cancel(req.FanoutID, sessionOwner(ctx), req.ConnectionID); err != nil {
+		return fanoutError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeFanoutCancelResponse, map[string]interface{}{
+		"fanout_id":     req.FanoutID,
+		"connection_id": req.ConnectionID,
+	}), nil
+}
+
+// registerFanoutHandlers registers the fan-out message handlers
+func (s *Server) registerFanoutHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeFanout, s.handleFanout)
+	s.ipc.RegisterHandler(protocol.MessageTypeFanoutCancel, s.handleFanoutCancel)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/jobs"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// topicJobState is the event topic for job progress and completion
+const topicJobState = "job_state"
+
+// jobSubmitRequest is a query to run as a background job
+type jobSubmitRequest struct {
+	ConnectionID      string           `msgpack:"connection_id"`
+	SQL               string           `msgpack:"sql"`
+	Label             string           `msgpack:"label"`
+	ConfirmationToken string           `msgpack:"confirmation_token"`
+	Params            []database.Param `msgpack:"params"`
+	database.QueryLimits
+}
+
+// jobRequest identifies a job and, for fetches, a row range
+type jobRequest struct {
+	JobID  string `msgpack:"job_id"`
+	Offset int64  `msgpack:"offset"`
+	Limit  int64  `msgpack:"limit"`
+	Wait   bool   `msgpack:"wait"` // job_status waits until the job has finished
+}
+
+// jobError maps job failures to an error response
+func jobError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		return errorMessage(err, 404, "Unknown job")
+	case errors.Is(err, jobs.ErrInvalid):
+		return errorMessage(err, 400, "Invalid job request")
+	case errors.Is(err, jobs.ErrFinished):
+		return errorMessage(err, 409, "Job has already finished")
+	default:
+		return errorMessage(err, 500, "Internal server error")
+	}
+}
+
+// publishJob tells subscribed clients about a job's progress or completion
+func (s *Server) publishJob(j storage.Job) {
+	s.ipc.Publish(topicJobState, map[string]interface{}{
+		"job": j,
+	})
+}
+
+// handleJobSubmit checks a query and starts it as a background job. The job
+// keeps running after the client disconnects.
+func (s *Server) handleJobSubmit(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req jobSubmitRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid job request"), err), nil
+	}
+
+	s.logger.Debug("Job submit request received", zap.String("id", msg.ID), zap.String("connection_id", req.ConnectionID))
+
+	// Problems with the query itself are reported now rather than as a failed job
+	run, err := s.db.PlanStream(req.ConnectionID, req.SQL, database.QueryOptions{
+		ConfirmationToken: req.ConfirmationToken,
+		Params:            req.Params,
+		Limits:            req.QueryLimits,
+	})
+	if err != nil {
+		return queryError(err), nil
+	}
+	job, err := s.jobs.Submit(req.ConnectionID, req.Label, req.SQL, run)
+	if err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobSubmitResponse, map[string]interface{}{
+		"job": job,
+	}), nil
+}
+
+// handleJobList lists the running and retained jobs
+func (s *Server) handleJobList(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	list, err := s.jobs.List(ctx)
+	if err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobListResponse, map[string]interface{}{
+		"jobs": list,
+	}), nil
+}
+
+// handleJobStatus returns a job's record, optionally once it has finished
+func (s *Server) handleJobStatus(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req jobRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid job request"), nil
+	}
+
+	get := s.jobs.Get
+	if req.Wait {
+		get = s.jobs.Wait
+	}
+	job, err := get(ctx, req.JobID)
+	if err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobStatusResponse, map[string]interface{}{
+		"job": job,
+	}), nil
+}
+
+// handleJobFetch returns a range of a job's result rows
+func (s *Server) handleJobFetch(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req jobRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid job request"), nil
+	}
+
+	rows, job, err := s.jobs.Fetch(ctx, req.JobID, req.Offset, req.Limit)
+	if err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobFetchResponse, map[string]interface{}{
+		"job_id": req.JobID,
+		"offset": req.Offset,
+		"rows":   rows,
+		"job":    job,
+	}), nil
+}
+
+// handleJobCancel stops a running job
+func (s *Server) handleJobCancel(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req jobRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid job request"), nil
+	}
+
+	job, err := s.jobs.Cancel(ctx, req.JobID)
+	if err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobCancelResponse, map[string]interface{}{
+		"job": job,
+	}), nil
+}
+
+// handleJobDelete deletes a job and its result, cancelling it if it is running
+func (s *Server) handleJobDelete(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req jobRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid job request"), nil
+	}
+
+	if err := s.jobs.Delete(ctx, req.JobID); err != nil {
+		return jobError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeJobDeleteResponse, map[string]interface{}{
+		"job_id": req.JobID,
+	}), nil
+}
+
+// registerJobHandlers registers the job message handlers
+func (s *Server) registerJobHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeJobSubmit, s.handleJobSubmit)
+	s.ipc.RegisterHandler(protocol.MessageTypeJobList, s.handleJobList)
+	s.ipc.RegisterHandler(protocol.MessageTypeJobStatus, s.handleJobStatus)
+	s.ipc.RegisterHandler(protocol.MessageTypeJobFetch, s.handleJobFetch)
+	s.ipc.RegisterHandler(protocol.MessageTypeJobCancel, s.handleJobCancel)
+	s.ipc.RegisterHandler(protocol.MessageTypeJobDelete, s.handleJobDelete)
+}
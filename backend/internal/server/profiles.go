@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// profileRequest identifies a saved profile in a message payload
+type profileRequest struct {
+	ID   string `msgpack:"id"`
+	Name string `msgpack:"name"` // Name for a duplicated profile
+}
+
+// profileGroupRequest moves profiles into a group
+type profileGroupRequest struct {
+	IDs   []string `msgpack:"ids"`
+	Group string   `msgpack:"group"`
+}
+
+// storageError maps store failures to an error response
+func storageError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return errorMessage(err, 404, "Unknown profile")
+	case errors.Is(err, storage.ErrInvalid):
+		return withFieldErrors(errorMessage(err, 400, "Invalid profile"), err)
+	default:
+		return errorMessage(err, 500, "Internal server error")
+	}
+}
+
+// profileResponse builds a response carrying a profile and any secrets that were not saved
+func profileResponse(msgType protocol.MessageType, profile storage.Profile, removed []string) *protocol.Message {
+	if removed == nil {
+		removed = []string{}
+	}
+	return protocol.NewMessage(msgType, map[string]interface{}{
+		"profile":         profile,
+		"removed_secrets": removed,
+	})
+}
+
+// handleProfileCreate saves a new connection profile
+func (s *Server) handleProfileCreate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var profile storage.Profile
+	if err := msg.DecodeData(&profile); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+
+	created, removed, err := s.store.CreateProfile(ctx, profile)
+	if err != nil {
+		return storageError(err), nil
+	}
+	if len(removed) > 0 {
+		s.logger.Info("Secrets removed from saved profile", zap.String("profile", created.ID), zap.Strings("fields", removed))
+	}
+
+	return profileResponse(protocol.MessageTypeProfileCreateResponse, created, removed), nil
+}
+
+// handleProfileUpdate replaces a saved connection profile
+func (s *Server) handleProfileUpdate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var profile storage.Profile
+	if err := msg.DecodeData(&profile); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+	if profile.ID == "" {
+		return errorMessage(fmt.Errorf("id is required"), 400, "Invalid profile request"), nil
+	}
+
+	updated, removed, err := s.store.UpdateProfile(ctx, profile)
+	if err != nil {
+		return storageError(err), nil
+	}
+	if len(removed) > 0 {
+		s.logger.Info("Secrets removed from saved profile", zap.String("profile", updated.ID), zap.Strings("fields", removed))
+	}
+
+	return profileResponse(protocol.MessageTypeProfileUpdateResponse, updated, removed), nil
+}
+
+// handleProfileDelete removes a saved connection profile
+func (s *Server) handleProfileDelete(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req profileRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+
+	if err := s.store.DeleteProfile(ctx, req.ID); err != nil {
+		return storageError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeProfileDeleteResponse, map[string]interface{}{
+		"id": req.ID,
+	}), nil
+}
+
+// handleProfileList lists saved profiles and their groups
+func (s *Server) handleProfileList(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var filter storage.ProfileFilter
+	if err := msg.DecodeData(&filter); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+
+	profiles, err := s.store.ListProfiles(ctx, filter)
+	if err != nil {
+		return storageError(err), nil
+	}
+	groups, err := s.store.Groups(ctx)
+	if err != nil {
+		return storageError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeProfileListResponse, map[string]interface{}{
+		"profiles": profiles,
+		"groups":   groups,
+	}), nil
+}
+
+// handleProfileDuplicate copies a saved profile
+func (s *Server) handleProfileDuplicate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req profileRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+
+	copied, err := s.store.DuplicateProfile(ctx, req.ID, req.Name)
+	if err != nil {
+		return storageError(err), nil
+	}
+
+	return profileResponse(protocol.MessageTypeProfileDuplicateResponse, copied, nil), nil
+}
+
+// handleProfileGroup moves saved profiles into a group
+func (s *Server) handleProfileGroup(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req profileGroupRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid profile request"), nil
+	}
+	if len(req.IDs) == 0 {
+		return errorMessage(fmt.Errorf("ids is required"), 400, "Invalid profile request"), nil
+	}
+
+	if err := s.store.GroupProfiles(ctx, req.IDs, req.Group); err != nil {
+		return storageError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeProfileGroupResponse, map[string]interface{}{
+		"ids":   req.IDs,
+		"group": req.Group,
+	}), nil
+}
+
+// registerProfileHandlers registers the saved profile message handlers
+func (s *Server) registerProfileHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileCreate, s.handleProfileCreate)
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileUpdate, s.handleProfileUpdate)
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileDelete, s.handleProfileDelete)
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileList, s.handleProfileList)
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileDuplicate, s.handleProfileDuplicate)
+	s.ipc.RegisterHandler(protocol.MessageTypeProfileGroup, s.handleProfileGroup)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// queryRequest is a query to run on an open connection
+type queryRequest struct {
+	ConnectionID      string           `msgpack:"connection_id"`
+	SQL               string           `msgpack:"sql"`
+	ConfirmationToken string           `msgpack:"confirmation_token"` // Confirms a write refused on a read-only connection
+	TransactionID     string           `msgpack:"transaction_id"`     // Runs the query in a transaction of this session
+	Params            []database.Param `msgpack:"params"`
+	database.QueryLimits
+
+	// Script mode runs the statements one by one with a result for each
+	Script          bool `msgpack:"script"`
+	ContinueOnError bool `msgpack:"continue_on_error"`
+	Atomic          bool `msgpack:"atomic"` // Runs the script in a transaction, rolled back on failure
+
+	// Explain mode returns the statement's execution plan instead of its rows
+	Explain bool `msgpack:"explain"`
+	Analyze bool `msgpack:"analyze"` // Executes the statement for actual figures (PostgreSQL)
+}
+
+// queryError maps query failures to an error response
+func queryError(err error) *protocol.Message {
+	var readOnlyErr *database.ReadOnlyError
+	switch {
+	case errors.As(err, &readOnlyErr):
+		resp := errorMessage(err, 403, "Statement not allowed in read-only mode")
+		resp.Data["class"] = readOnlyErr.Statement.Class
+		resp.Data["statement"] = readOnlyErr.Statement.Text
+		if readOnlyErr.Token != "" {
+			resp.Data["confirmation_token"] = readOnlyErr.Token
+			resp.Data["expires_at"] = readOnlyErr.ExpiresAt
+		}
+		return resp
+	case errors.Is(err, database.ErrNotFound):
+		return connectionError(err)
+	case errors.Is(err, database.ErrTransactionNotFound):
+		return errorMessage(err, 404, "Unknown transaction")
+	case errors.Is(err, database.ErrQueryTimeout):
+		return errorMessage(err, 408, "Query timed out")
+	case errors.Is(err, database.ErrPoolExhausted):
+		return errorMessage(err, 503, "Connection limit reached")
+	case errors.Is(err, database.ErrInvalidQuery):
+		return withFieldErrors(errorMessage(err, 400, "Invalid query request"), err)
+	default:
+		return errorMessage(err, 422, "Query failed")
+	}
+}
+
+// handleQuery runs SQL on an open connection and returns its result
+func (s *Server) handleQuery(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req queryRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid query request"), err), nil
+	}
+
+	s.logger.Debug("Query request received", zap.String("id", msg.ID), zap.String("connection_id", req.ConnectionID))
+
+	opts := database.QueryOptions{
+		ConfirmationToken: req.ConfirmationToken,
+		TransactionID:     req.TransactionID,
+		Owner:             sessionOwner(ctx),
+		Params:            req.Params,
+		Limits:            req.QueryLimits,
+	}
+	switch {
+	case req.Script && req.Explain:
+		return errorMessage(fmt.Errorf("script and explain cannot be combined"), 400, "Invalid query request"), nil
+	case req.Script:
+		return s.runScript(ctx, req, opts), nil
+	case req.Explain:
+		return s.explain(ctx, req, opts), nil
+	}
+
+	result, err := s.db.Query(ctx, req.ConnectionID, req.SQL, opts)
+	if err != nil {
+		return queryError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeQueryResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+		"result":        result,
+	}), nil
+}
+
+// runScript answers a query request in script mode
+func (s *Server) runScript(ctx context.Context, req queryRequest, opts database.QueryOptions) *protocol.Message {
+	script, err := s.db.RunScript(ctx, req.ConnectionID, req.SQL, database.ScriptOptions{
+		QueryOptions:    opts,
+		ContinueOnError: req.ContinueOnError,
+		Atomic:          req.Atomic,
+	})
+	if err != nil {
+		return queryError(err)
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeQueryResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+		"script":        script,
+	})
+}
+
+// explain answers a query request in explain mode
+func (s *Server) explain(ctx context.Context, req queryRequest, opts database.QueryOptions) *protocol.Message {
+	plan, err := s.db.Explain(ctx, req.ConnectionID, req.SQL, database.ExplainOptions{
+		QueryOptions: opts,
+		Analyze:      req.Analyze,
+	})
+	if err != nil {
+		return queryError(err)
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeQueryResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+		"explain":       plan,
+	})
+}
+
+// registerQueryHandlers registers the query message handlers
+func (s *Server) registerQueryHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeQuery, s.handleQuery)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/config"
+	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/systemd"
+
+	"go.uber.org/zap"
+)
+
+// ReloadResult describes the outcome of a configuration reload
+type ReloadResult struct {
+	Applied  []string // Keys applied at runtime
+	Warnings []string // Changes that need a restart to take effect
+}
+
+// Settings returns the currently applied configuration
+func (s *Server) Settings() *config.Config {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.settings
+}
+
+// Reload re-reads the configuration and applies the reloadable subset.
+// Changes that cannot be applied at runtime are reported as warnings.
+func (s *Server) Reload() (*ReloadResult, error) {
+	if s.config.LoadConfig == nil {
+		return nil, fmt.Errorf("configuration reload is not available")
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.notify(systemd.StateReloading)
+	defer s.notify(systemd.StateReady)
+
+	updated, err := s.config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReloadResult{Applied: []string{}, Warnings: []string{}}
+	for _, key := range config.Diff(s.settings, updated) {
+		if config.IsReloadable(key) {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s changed but requires a restart to take effect", key))
+		}
+	}
+
+	// Only the reloadable keys are taken over, so later diffs keep reporting
+	// settings that still wait for a restart
+	applied := config.WithKeys(s.settings, updated, result.Applied)
+	if err := s.logger.SetLevel(applied.Log.Level); err != nil {
+		return nil, err
+	}
+	s.logger.SetRedact(applied.Log.Redact)
+	s.ipc.SetLimits(ipc.Limits{
+		ReadTimeout:    applied.IPC.ReadTimeout.Std(),
+		WriteTimeout:   applied.IPC.WriteTimeout.Std(),
+		MaxMessageSize: applied.IPC.MaxMessageSize,
+	})
+	s.db.SetPoolDefaults(poolOptionsFrom(applied.Pool))
+	s.db.SetAcquireTimeout(applied.Pool.AcquireTimeout.Std())
+	s.db.SetDriverDefaults(driverDefaultsFrom(applied.Drivers))
+	s.db.SetHealthOptions(healthOptionsFrom(applied.Health))
+	s.cursors.SetLimits(applied.Cursors.IdleTimeout.Std(), diskQuotaBytes(applied.Cursors))
+	s.jobs.SetRetention(applied.Jobs.Retention.Std())
+	s.sched.SetHistory(applied.Schedules.History)
+	s.db.SetMaxValueSize(applied.Values.MaxSize)
+	s.values.SetLimits(applied.Values.Retention.Std(), valueQuotaBytes(applied.Values))
+	s.settings = applied
+
+	s.logger.Info("Configuration reloaded", zap.Strings("applied", result.Applied), zap.Strings("warnings", result.Warnings))
+	for _, warning := range result.Warnings {
+		s.logger.Warn(warning)
+	}
+
+	return result, nil
+}
+
+// handleConfigReload handles configuration reload requests
+func (s *Server) handleConfigReload(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	s.logger.Debug("Config reload request received", zap.String("id", msg.ID))
+
+	result, err := s.Reload()
+	if err != nil {
+		var validationErr *config.ValidationError
+		if errors.As(err, &validationErr) {
+			return errorMessage(err, 400, "Invalid configuration"), nil
+		}
+		return errorMessage(err, 500, "Failed to reload configuration"), nil
+	}
+
+	response := protocol.NewMessage(protocol.MessageTypeConfigReloadResponse, map[string]interface{}{
+		"applied":  result.Applied,
+		"warnings": result.Warnings,
+	})
+	return response, nil
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/scheduler"
+	"litebase-backend/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// topicScheduleRun is the event topic for finished schedule runs
+const topicScheduleRun = "schedule_run"
+
+// scheduleRequest identifies a schedule or one of its runs
+type scheduleRequest struct {
+	ID    string `msgpack:"id"`
+	RunID string `msgpack:"run_id"`
+	Limit int    `msgpack:"limit"` // Runs returned by schedule_history
+}
+
+// scheduleError maps scheduler and store failures to an error response
+func scheduleError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, scheduler.ErrNotFound):
+		return errorMessage(err, 404, "Unknown schedule")
+	case errors.Is(err, storage.ErrInvalid), errors.Is(err, scheduler.ErrInvalid):
+		return errorMessage(err, 400, "Invalid schedule")
+	case errors.Is(err, scheduler.ErrRunning):
+		return errorMessage(err, 409, "Schedule is already running")
+	default:
+		return errorMessage(err, 500, "Internal server error")
+	}
+}
+
+// runSchedule opens a connection with the schedule's profile for the length
+// of one run. The rows are streamed, so the profile's default max_rows does
+// not apply.
+func (s *Server) runSchedule(ctx context.Context, sc storage.Schedule, sink database.RowSink) (*database.Result, error) {
+	profile, err := s.store.GetProfile(ctx, sc.ProfileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	conn, err := s.db.Connect(ctx, profile.Connection())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer s.db.Disconnect(conn.ID)
+
+	return s.db.Stream(ctx, conn.ID, sc.SQL, database.QueryOptions{
+		Params: sc.Params,
+		Limits: sc.Limits,
+	}, sink)
+}
+
+// publishScheduleRun tells subscribed clients about a finished schedule run
+func (s *Server) publishScheduleRun(run storage.ScheduleRun) {
+	s.ipc.Publish(topicScheduleRun, map[string]interface{}{
+		"run": run,
+	})
+}
+
+// handleScheduleCreate saves a new schedule
+func (s *Server) handleScheduleCreate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var sc storage.Schedule
+	if err := msg.DecodeData(&sc); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	created, err := s.sched.Create(ctx, sc)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleCreateResponse, map[string]interface{}{
+		"schedule": created,
+	}), nil
+}
+
+// handleScheduleUpdate replaces a saved schedule
+func (s *Server) handleScheduleUpdate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var sc storage.Schedule
+	if err := msg.DecodeData(&sc); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	updated, err := s.sched.Update(ctx, sc)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleUpdateResponse, map[string]interface{}{
+		"schedule": updated,
+	}), nil
+}
+
+// handleScheduleDelete removes a schedule and its run history
+func (s *Server) handleScheduleDelete(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req scheduleRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	if err := s.sched.Delete(ctx, req.ID); err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleDeleteResponse, map[string]interface{}{
+		"id": req.ID,
+	}), nil
+}
+
+// handleScheduleList lists the saved schedules with their next and last runs
+func (s *Server) handleScheduleList(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	schedules, err := s.sched.List(ctx)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleListResponse, map[string]interface{}{
+		"schedules": schedules,
+	}), nil
+}
+
+// handleScheduleRun runs a schedule now and returns the recorded run
+func (s *Server) handleScheduleRun(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req scheduleRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	s.logger.Debug("Schedule run request received", zap.String("id", msg.ID), zap.String("schedule_id", req.ID))
+
+	run, err := s.sched.RunNow(ctx, req.ID)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleRunResponse, map[string]interface{}{
+		"run": run,
+	}), nil
+}
+
+// handleScheduleHistory lists the recent runs of a schedule without their rows
+func (s *Server) handleScheduleHistory(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req scheduleRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	runs, err := s.sched.History(ctx, req.ID, req.Limit)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleHistoryResponse, map[string]interface{}{
+		"id":   req.ID,
+		"runs": runs,
+	}), nil
+}
+
+// handleScheduleResult returns a recorded run with its rows
+func (s *Server) handleScheduleResult(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req scheduleRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid schedule request"), nil
+	}
+
+	run, err := s.sched.Run(ctx, req.RunID)
+	if err != nil {
+		return scheduleError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeScheduleResultResponse, map[string]interface{}{
+		"run": run,
+	}), nil
+}
+
+// registerScheduleHandlers registers the schedule message handlers
+func (s *Server) registerScheduleHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleCreate, s.handleScheduleCreate)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleUpdate, s.handleScheduleUpdate)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleDelete, s.handleScheduleDelete)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleList, s.handleScheduleList)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleRun, s.handleScheduleRun)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleHistory, s.handleScheduleHistory)
+	s.ipc.RegisterHandler(protocol.MessageTypeScheduleResult, s.handleScheduleResult)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"litebase-backend/internal/config"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/secrets"
+
+	"go.uber.org/zap"
+)
+
+// vaultFileName is the default file vault name inside the data directory
+const vaultFileName = "vault.enc"
+
+// secretRequest carries a secret in a message payload. Value is never logged.
+type secretRequest struct {
+	ID    string `msgpack:"id"`
+	Label string `msgpack:"label"`
+	Value string `msgpack:"value"`
+}
+
+// unlockRequest carries the vault passphrase
+type unlockRequest struct {
+	Passphrase string `msgpack:"passphrase"`
+}
+
+// openSecrets opens the configured secret backend
+func openSecrets(ctx context.Context, settings *config.Config) (secrets.Backend, error) {
+	vaultPath := settings.Secrets.VaultPath
+	if vaultPath == "" {
+		vaultPath = filepath.Join(settings.Storage.DataDir, vaultFileName)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return secrets.Open(ctx, secrets.Options{
+		Backend:   settings.Secrets.Backend,
+		VaultPath: vaultPath,
+	})
+}
+
+// secretError maps secret backend failures to an error response
+func secretError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, secrets.ErrLocked):
+		return errorMessage(err, 423, "Secret store is locked")
+	case errors.Is(err, secrets.ErrWrongPassphrase):
+		return errorMessage(err, 403, "Incorrect passphrase")
+	case errors.Is(err, secrets.ErrNotFound):
+		return errorMessage(err, 404, "Unknown secret")
+	case errors.Is(err, secrets.ErrInvalidID):
+		return errorMessage(err, 400, "Invalid secret request")
+	default:
+		return errorMessage(err, 502, "Secret store failed")
+	}
+}
+
+// secretStatus describes the active backend
+func (s *Server) secretStatus() map[string]interface{} {
+	locked := false
+	if locker, ok := s.secrets.(secrets.Locker); ok {
+		locked = locker.Locked()
+	}
+	return map[string]interface{}{
+		"backend": s.secrets.Name(),
+		"locked":  locked,
+	}
+}
+
+// handleSecretSet stores a secret, generating an ID when none is given
+func (s *Server) handleSecretSet(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req secretRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid secret request"), nil
+	}
+	if req.Value == "" {
+		return errorMessage(fmt.Errorf("value is required"), 400, "Invalid secret request"), nil
+	}
+	if req.ID == "" {
+		id, err := secrets.NewID()
+		if err != nil {
+			return errorMessage(err, 500, "Internal server error"), nil
+		}
+		req.ID = id
+	}
+
+	if err := s.secrets.Set(ctx, req.ID, req.Label, req.Value); err != nil {
+		return secretError(err), nil
+	}
+	s.logger.Info("Secret stored", zap.String("secret", req.ID), zap.String("backend", s.secrets.Name()))
+
+	return protocol.NewMessage(protocol.MessageTypeSecretSetResponse, map[string]interface{}{
+		"id":    req.ID,
+		"label": req.Label,
+	}), nil
+}
+
+// handleSecretDelete removes a secret
+func (s *Server) handleSecretDelete(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req secretRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid secret request"), nil
+	}
+
+	if err := s.secrets.Delete(ctx, req.ID); err != nil {
+		return secretError(err), nil
+	}
+	s.logger.Info("Secret deleted", zap.String("secret", req.ID), zap.String("backend", s.secrets.Name()))
+
+	return protocol.NewMessage(protocol.MessageTypeSecretDeleteResponse, map[string]interface{}{
+		"id": req.ID,
+	}), nil
+}
+
+// handleSecretList lists stored secrets without their values
+func (s *Server) handleSecretList(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	status := s.secretStatus()
+	if status["locked"] == true {
+		status["secrets"] = []secrets.Info{}
+		return protocol.NewMessage(protocol.MessageTypeSecretListResponse, status), nil
+	}
+
+	infos, err := s.secrets.List(ctx)
+	if err != nil {
+		return secretError(err), nil
+	}
+	status["secrets"] = infos
+	return protocol.NewMessage(protocol.MessageTypeSecretListResponse, status), nil
+}
+
+// handleSecretUnlock unlocks the file vault, creating it on first use
+func (s *Server) handleSecretUnlock(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req unlockRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid unlock request"), nil
+	}
+	locker, ok := s.secrets.(secrets.Locker)
+	if !ok {
+		err := fmt.Errorf("the %s backend is unlocked by the desktop keyring", s.secrets.Name())
+		return errorMessage(err, 400, "Invalid unlock request"), nil
+	}
+	if req.Passphrase == "" {
+		return errorMessage(fmt.Errorf("passphrase is required"), 400, "Invalid unlock request"), nil
+	}
+
+	if err := locker.Unlock(req.Passphrase); err != nil {
+		s.logger.Warn("Secret store unlock failed", zap.Error(err))
+		return secretError(err), nil
+	}
+	s.logger.Info("Secret store unlocked", zap.String("backend", s.secrets.Name()))
+
+	return protocol.NewMessage(protocol.MessageTypeSecretUnlockResponse, s.secretStatus()), nil
+}
+
+// handleSecretLock locks the file vault
+func (s *Server) handleSecretLock(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	if locker, ok := s.secrets.(secrets.Locker); ok {
+		locker.Lock()
+		s.logger.Info("Secret store locked", zap.String("backend", s.secrets.Name()))
+	}
+	return protocol.NewMessage(protocol.MessageTypeSecretLockResponse, s.secretStatus()), nil
+}
+
+// registerSecretHandlers registers the secret store message handlers
+func (s *Server) registerSecretHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeSecretSet, s.handleSecretSet)
+	s.ipc.RegisterHandler(protocol.MessageTypeSecretDelete, s.handleSecretDelete)
+	s.ipc.RegisterHandler(protocol.MessageTypeSecretList, s.handleSecretList)
+	s.ipc.RegisterHandler(protocol.MessageTypeSecretUnlock, s.handleSecretUnlock)
+	s.ipc.RegisterHandler(protocol.MessageTypeSecretLock, s.handleSecretLock)
+}
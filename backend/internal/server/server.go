@@ -3,25 +3,66 @@ package server
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
+	cfg "litebase-backend/internal/config"
+	"litebase-backend/internal/cursor"
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/fanout"
 	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/jobs"
 	"litebase-backend/internal/logger"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/scheduler"
+	"litebase-backend/internal/secrets"
+	"litebase-backend/internal/storage"
+	"litebase-backend/internal/systemd"
+	"litebase-backend/internal/values"
+
+	"go.uber.org/zap"
 )
 
 // Config holds the server configuration
 type Config struct {
-	SocketPath string
-	PipeName   string
-	Port       int
-	Logger     logger.Logger
-	DebugMode  bool // Enable debug mode for IPC server
+	SocketPath     string
+	PipeName       string
+	Port           int
+	Logger         logger.Logger
+	DebugMode      bool // Enable debug mode for IPC server
+	Takeover       bool // Replace a running instance on the same socket
+	Upgrade        bool // Receive the listening socket from a running instance
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxMessageSize int
+
+	Settings   *cfg.Config                 // Effective configuration at startup
+	LoadConfig func() (*cfg.Config, error) // Re-reads configuration on reload
 }
 
 // Server represents the main server
 type Server struct {
-	config *Config
-	ipc    *ipc.Server
-	logger logger.Logger
+	config  *Config
+	ipc     *ipc.Server
+	db      *database.Manager
+	cursors *cursor.Manager
+	fanouts *fanout.Manager
+	jobs    *jobs.Manager
+	sched   *scheduler.Manager
+	values  *values.Store
+	store   *storage.Store
+	secrets secrets.Backend
+	logger  logger.Logger
+
+	reloadMu sync.Mutex
+	settings *cfg.Config
+
+	txSessions     sync.Map // Sessions watched for open transactions
+	cursorSessions sync.Map // Sessions watched for open cursors
+	fanoutSessions sync.Map // Sessions watched for running fan-outs
 }
 
 // New creates a new server instance
@@ -30,12 +71,34 @@ func New(config *Config) (*Server, error) {
 		return nil, fmt.Errorf("logger is required")
 	}
 
+	// Use a listener passed by systemd if we were socket-activated
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit listeners: %w", err)
+	}
+	if len(listeners) > 1 {
+		config.Logger.Warn("Multiple inherited listeners, using the first", zap.Int("count", len(listeners)))
+		for _, l := range listeners[1:] {
+			l.Close()
+		}
+	}
+
 	// Create IPC server
 	ipcConfig := &ipc.Config{
 		SocketPath: config.SocketPath,
 		PipeName:   config.PipeName,
 		Logger:     config.Logger,
 		DebugMode:  config.DebugMode,
+		Takeover:   config.Takeover,
+		Upgrade:    config.Upgrade,
+
+		ReadTimeout:    config.ReadTimeout,
+		WriteTimeout:   config.WriteTimeout,
+		MaxMessageSize: config.MaxMessageSize,
+	}
+	if len(listeners) > 0 {
+		ipcConfig.Listener = listeners[0]
+		config.Logger.Info("Using socket-activated listener", zap.String("name", listeners[0].Name))
 	}
 
 	ipcServer, err := ipc.New(ipcConfig)
@@ -43,12 +106,122 @@ func New(config *Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to create IPC server: %w", err)
 	}
 
+	settings := config.Settings
+	if settings == nil {
+		settings = cfg.Default()
+	}
+
+	// Scratch files go in a directory of their own, as the instance we
+	// replace on an upgrade shares temp_dir until it has drained
+	processDir := strconv.Itoa(os.Getpid())
+
+	secretBackend, err := openSecrets(context.Background(), settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secret store: %w", err)
+	}
+	config.Logger.Info("Secret store opened", zap.String("backend", secretBackend.Name()))
+
+	valueStore, err := values.NewStore(values.Config{
+		Logger:    config.Logger,
+		Dir:       filepath.Join(settings.Storage.TempDir, "values", processDir),
+		Retention: settings.Values.Retention.Std(),
+		DiskQuota: valueQuotaBytes(settings.Values),
+	})
+	if err != nil {
+		secretBackend.Close()
+		return nil, fmt.Errorf("failed to start value store: %w", err)
+	}
+
+	manager, err := newDatabaseManager(settings, config, ipcServer, secretBackend.Get, valueStore)
+	if err != nil {
+		valueStore.Shutdown()
+		secretBackend.Close()
+		return nil, err
+	}
+
+	store, err := storage.Open(context.Background(), filepath.Join(settings.Storage.DataDir, storage.FileName))
+	if err != nil {
+		manager.Close()
+		valueStore.Shutdown()
+		secretBackend.Close()
+		return nil, fmt.Errorf("failed to open local storage: %w", err)
+	}
+	config.Logger.Info("Local storage opened", zap.String("path", store.Path()))
+
+	cursors, err := cursor.NewManager(cursor.Config{
+		Logger:      config.Logger,
+		Dir:         filepath.Join(settings.Storage.TempDir, "cursors", processDir),
+		IdleTimeout: settings.Cursors.IdleTimeout.Std(),
+		DiskQuota:   diskQuotaBytes(settings.Cursors),
+	})
+	if err != nil {
+		store.Close()
+		manager.Close()
+		valueStore.Shutdown()
+		secretBackend.Close()
+		return nil, fmt.Errorf("failed to start cursor manager: %w", err)
+	}
+
 	server := &Server{
-		config: config,
-		ipc:    ipcServer,
-		logger: config.Logger,
+		config:   config,
+		ipc:      ipcServer,
+		db:       manager,
+		cursors:  cursors,
+		fanouts:  fanout.NewManager(config.Logger),
+		values:   valueStore,
+		store:    store,
+		secrets:  secretBackend,
+		logger:   config.Logger,
+		settings: settings,
 	}
 
+	server.jobs, err = jobs.NewManager(jobs.Config{
+		Logger:    config.Logger,
+		Store:     store,
+		Dir:       filepath.Join(settings.Storage.DataDir, "jobs"),
+		Retention: settings.Jobs.Retention.Std(),
+		Notify:    server.publishJob,
+	})
+	if err != nil {
+		cursors.Shutdown()
+		store.Close()
+		manager.Close()
+		valueStore.Shutdown()
+		secretBackend.Close()
+		return nil, fmt.Errorf("failed to start job manager: %w", err)
+	}
+
+	server.sched, err = scheduler.NewManager(scheduler.Config{
+		Logger:  config.Logger,
+		Store:   store,
+		History: settings.Schedules.History,
+		Exec:    server.runSchedule,
+		Notify:  server.publishScheduleRun,
+	})
+	if err != nil {
+		server.jobs.Shutdown()
+		cursors.Shutdown()
+		store.Close()
+		manager.Close()
+		valueStore.Shutdown()
+		secretBackend.Close()
+		return nil, fmt.Errorf("failed to start scheduler: %w", err)
+	}
+
+	ipcServer.OnListen(server.claim)
+	ipcServer.RegisterHandler(protocol.MessageTypeConfigReload, server.handleConfigReload)
+	server.registerDatabaseHandlers()
+	server.registerProfileHandlers()
+	server.registerSecretHandlers()
+	server.registerQueryHandlers()
+	server.registerStatementHandlers()
+	server.registerTransactionHandlers()
+	server.registerCursorHandlers()
+	server.registerFanoutHandlers()
+	server.registerJobHandlers()
+	server.registerScheduleHandlers()
+	server.registerValueHandlers()
+
 	return server, nil
 }
 
@@ -56,17 +229,54 @@ func New(config *Config) (*Server, error) {
 func (s *Server) Start() error {
 	s.logger.Info("Starting LiteBase Backend Server")
 
+	// Stops the readiness notification if the IPC server never becomes ready
+	failed := make(chan struct{})
+	go s.notifyReady(failed)
+
 	// Start IPC server
 	if err := s.ipc.Start(); err != nil {
+		close(failed)
 		return fmt.Errorf("failed to start IPC server: %w", err)
 	}
 
 	return nil
 }
 
+// claim runs once we own the listener, and with it the instance. Before
+// that, a backend that is refused as already running, or one still waiting
+// for an upgrade handoff, must not touch state the running instance uses.
+func (s *Server) claim(handoff bool) error {
+	// The instance we replace still uses its scratch files until it exits
+	if !handoff {
+		processDir := strconv.Itoa(os.Getpid())
+		removeStale(filepath.Join(s.settings.Storage.TempDir, "cursors"), processDir)
+		removeStale(filepath.Join(s.settings.Storage.TempDir, "values"), processDir)
+	}
+	if err := s.jobs.Start(!handoff); err != nil {
+		return fmt.Errorf("failed to start job manager: %w", err)
+	}
+	s.sched.Start()
+	return nil
+}
+
+// removeStale deletes everything in dir except keep, left there by
+// instances that did not shut down cleanly
+func removeStale(dir, keep string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != keep {
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Shutting down server...")
+	s.notify(systemd.StateStopping)
 
 	// Create a channel to signal when shutdown is complete
 	done := make(chan error, 1)
@@ -78,6 +288,41 @@ func (s *Server) Shutdown(ctx context.Context) error {
 			return
 		}
 
+		// Stop fan-outs, jobs and scheduled runs before the connections they run on
+		s.fanouts.Shutdown()
+		s.jobs.Shutdown()
+		s.sched.Shutdown()
+
+		// Stop spooling and delete the cursor files before their connections go
+		if err := s.cursors.Shutdown(); err != nil {
+			done <- fmt.Errorf("failed to close cursors: %w", err)
+			return
+		}
+
+		// Close database connections
+		if err := s.db.Close(); err != nil {
+			done <- fmt.Errorf("failed to close database connections: %w", err)
+			return
+		}
+
+		// Delete the kept values
+		if err := s.values.Shutdown(); err != nil {
+			done <- fmt.Errorf("failed to close value store: %w", err)
+			return
+		}
+
+		// Close local storage
+		if err := s.store.Close(); err != nil {
+			done <- fmt.Errorf("failed to close local storage: %w", err)
+			return
+		}
+
+		// Lock the secret store
+		if err := s.secrets.Close(); err != nil {
+			done <- fmt.Errorf("failed to close secret store: %w", err)
+			return
+		}
+
 		done <- nil
 	}()
 
@@ -94,9 +339,43 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	}
 }
 
-// IsHealthy checks if the server is healthy
+// HandedOff returns a channel that is closed once a newer backend has taken
+// over the listening socket
+func (s *Server) HandedOff() <-chan struct{} {
+	return s.ipc.HandedOff()
+}
+
+// Drain stops firing schedules, which the backend that took over now does,
+// and waits for connected clients to disconnect, or for ctx to expire
+func (s *Server) Drain(ctx context.Context) error {
+	s.sched.Stop()
+	s.logger.Info("Draining client connections...")
+	return s.ipc.Drain(ctx)
+}
+
+// notifyReady tells the service manager we are ready once the IPC server
+// accepts connections. It gives up when failed is closed.
+func (s *Server) notifyReady(failed <-chan struct{}) {
+	select {
+	case <-s.ipc.Ready():
+		s.notify(systemd.StateReady)
+	case <-failed:
+	}
+}
+
+// notify sends a state update to systemd, if we are running under it
+func (s *Server) notify(state string) {
+	sent, err := systemd.Notify(state)
+	if err != nil {
+		s.logger.Warn("Failed to notify service manager", zap.String("state", state), zap.Error(err))
+		return
+	}
+	if sent {
+		s.logger.Debug("Notified service manager", zap.String("state", state))
+	}
+}
+
+// IsHealthy reports whether every database connection is usable or recovering
 func (s *Server) IsHealthy() bool {
-	// For now, just check if the server is running
-	// In the future, this could check database connections, etc.
-	return true
+	return s.healthStatus() != "unhealthy"
 }
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// stmtPrepareRequest prepares SQL on an open connection
+type stmtPrepareRequest struct {
+	ConnectionID string           `msgpack:"connection_id"`
+	SQL          string           `msgpack:"sql"`
+	Params       []database.Param `msgpack:"params"` // Prepares on the database now when the SQL has placeholders
+}
+
+// stmtExecuteRequest runs a prepared statement
+type stmtExecuteRequest struct {
+	ConnectionID      string           `msgpack:"connection_id"`
+	StatementID       string           `msgpack:"statement_id"`
+	ConfirmationToken string           `msgpack:"confirmation_token"`
+	TransactionID     string           `msgpack:"transaction_id"`
+	Params            []database.Param `msgpack:"params"`
+	database.QueryLimits
+}
+
+// stmtRequest identifies a prepared statement
+type stmtRequest struct {
+	ConnectionID string `msgpack:"connection_id"`
+	StatementID  string `msgpack:"statement_id"`
+}
+
+// statementError maps prepared statement failures to an error response
+func statementError(err error) *protocol.Message {
+	if errors.Is(err, database.ErrStatementNotFound) {
+		return errorMessage(err, 404, "Unknown prepared statement")
+	}
+	return queryError(err)
+}
+
+// handleStmtPrepare prepares a statement, reusing a cached one for the same SQL
+func (s *Server) handleStmtPrepare(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req stmtPrepareRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid query request"), err), nil
+	}
+
+	info, cached, err := s.db.Prepare(ctx, req.ConnectionID, req.SQL, req.Params)
+	if err != nil {
+		return statementError(err), nil
+	}
+	s.logger.Debug("Statement prepared", zap.String("connection_id", req.ConnectionID),
+		zap.String("statement_id", info.ID), zap.Bool("cached", cached))
+
+	return protocol.NewMessage(protocol.MessageTypeStmtPrepareResponse, map[string]interface{}{
+		"statement": info,
+		"cached":    cached,
+	}), nil
+}
+
+// handleStmtExecute runs a prepared statement and returns its result
+func (s *Server) handleStmtExecute(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req stmtExecuteRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return withFieldErrors(errorMessage(err, 400, "Invalid query request"), err), nil
+	}
+
+	result, err := s.db.ExecutePrepared(ctx, req.ConnectionID, req.StatementID, database.QueryOptions{
+		ConfirmationToken: req.ConfirmationToken,
+		TransactionID:     req.TransactionID,
+		Owner:             sessionOwner(ctx),
+		Params:            req.Params,
+		Limits:            req.QueryLimits,
+	})
+	if err != nil {
+		return statementError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeStmtExecuteResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+		"statement_id":  req.StatementID,
+		"result":        result,
+	}), nil
+}
+
+// handleStmtDeallocate drops a prepared statement from the cache
+func (s *Server) handleStmtDeallocate(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req stmtRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid query request"), nil
+	}
+	if err := s.db.Deallocate(req.ConnectionID, req.StatementID); err != nil {
+		return statementError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeStmtDeallocateResponse, map[string]interface{}{
+		"connection_id": req.ConnectionID,
+		"statement_id":  req.StatementID,
+	}), nil
+}
+
+// registerStatementHandlers registers the prepared statement handlers
+func (s *Server) registerStatementHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeStmtPrepare, s.handleStmtPrepare)
+	s.ipc.RegisterHandler(protocol.MessageTypeStmtExecute, s.handleStmtExecute)
+	s.ipc.RegisterHandler(protocol.MessageTypeStmtDeallocate, s.handleStmtDeallocate)
+}
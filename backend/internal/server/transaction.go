@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ipc"
+	"litebase-backend/internal/protocol"
+
+	"go.uber.org/zap"
+)
+
+// txBeginRequest starts a transaction on an open connection
+type txBeginRequest struct {
+	ConnectionID string `msgpack:"connection_id"`
+	database.TxOptions
+}
+
+// txRequest identifies a transaction and, for savepoint messages, a savepoint
+type txRequest struct {
+	TransactionID string `msgpack:"transaction_id"`
+	Savepoint     string `msgpack:"savepoint"` // tx_rollback rolls back to it when set
+}
+
+// transactionError maps transaction failures to an error response
+func transactionError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return connectionError(err)
+	case errors.Is(err, database.ErrTransactionNotFound):
+		return errorMessage(err, 404, "Unknown transaction")
+	case errors.Is(err, database.ErrInvalidTransaction):
+		return errorMessage(err, 400, "Invalid transaction request")
+	default:
+		return errorMessage(err, 422, "Transaction failed")
+	}
+}
+
+// sessionOwner returns the ID of the client session serving ctx, which owns
+// the transactions it begins
+func sessionOwner(ctx context.Context) string {
+	if session, ok := ipc.SessionFromContext(ctx); ok {
+		return session.ID
+	}
+	return ""
+}
+
+// watchTransactions rolls back a session's transactions when its client
+// disconnects, and keeps the session open while it has any
+func (s *Server) watchTransactions(session *ipc.Session) {
+	if _, loaded := s.txSessions.LoadOrStore(session.ID, true); loaded {
+		return
+	}
+	session.AllowIdle(func() bool {
+		return s.db.HasTransactions(session.ID)
+	})
+	session.OnClose(func() {
+		s.txSessions.Delete(session.ID)
+		if n := s.db.RollbackOwner(session.ID); n > 0 {
+			s.logger.Info("Rolled back transactions of disconnected client",
+				zap.String("session", session.ID), zap.Int("transactions", n))
+		}
+	})
+}
+
+// handleTxBegin starts a transaction bound to the requesting session
+func (s *Server) handleTxBegin(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req txBeginRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid transaction request"), nil
+	}
+	session, ok := ipc.SessionFromContext(ctx)
+	if !ok {
+		return errorMessage(fmt.Errorf("transactions need a client session"), 400, "Invalid transaction request"), nil
+	}
+
+	s.watchTransactions(session)
+	// The session context ends with the client, which rolls back the transaction
+	info, err := s.db.Begin(session.Context(), req.ConnectionID, session.ID, req.TxOptions)
+	if err != nil {
+		return transactionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeTxBeginResponse, map[string]interface{}{
+		"transaction": info,
+	}), nil
+}
+
+// handleTxCommit commits a transaction
+func (s *Server) handleTxCommit(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req txRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid transaction request"), nil
+	}
+
+	if err := s.db.Commit(req.TransactionID, sessionOwner(ctx)); err != nil {
+		return transactionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeTxCommitResponse, map[string]interface{}{
+		"transaction_id": req.TransactionID,
+	}), nil
+}
+
+// handleTxRollback rolls back a transaction, or to a savepoint when one is given
+func (s *Server) handleTxRollback(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req txRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid transaction request"), nil
+	}
+
+	if req.Savepoint != "" {
+		info, err := s.db.RollbackTo(ctx, req.TransactionID, sessionOwner(ctx), req.Savepoint)
+		if err != nil {
+			return transactionError(err), nil
+		}
+		return protocol.NewMessage(protocol.MessageTypeTxRollbackResponse, map[string]interface{}{
+			"transaction_id": req.TransactionID,
+			"transaction":    info,
+		}), nil
+	}
+
+	if err := s.db.Rollback(req.TransactionID, sessionOwner(ctx)); err != nil {
+		return transactionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeTxRollbackResponse, map[string]interface{}{
+		"transaction_id": req.TransactionID,
+	}), nil
+}
+
+// handleTxSavepoint sets a savepoint in a transaction
+func (s *Server) handleTxSavepoint(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req txRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid transaction request"), nil
+	}
+
+	info, err := s.db.Savepoint(ctx, req.TransactionID, sessionOwner(ctx), req.Savepoint)
+	if err != nil {
+		return transactionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeTxSavepointResponse, map[string]interface{}{
+		"transaction_id": req.TransactionID,
+		"transaction":    info,
+	}), nil
+}
+
+// handleTxRelease releases a savepoint
+func (s *Server) handleTxRelease(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req txRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid transaction request"), nil
+	}
+
+	info, err := s.db.Release(ctx, req.TransactionID, sessionOwner(ctx), req.Savepoint)
+	if err != nil {
+		return transactionError(err), nil
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeTxReleaseResponse, map[string]interface{}{
+		"transaction_id": req.TransactionID,
+		"transaction":    info,
+	}), nil
+}
+
+// registerTransactionHandlers registers the transaction message handlers
+func (s *Server) registerTransactionHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeTxBegin, s.handleTxBegin)
+	s.ipc.RegisterHandler(protocol.MessageTypeTxCommit, s.handleTxCommit)
+	s.ipc.RegisterHandler(protocol.MessageTypeTxRollback, s.handleTxRollback)
+	s.ipc.RegisterHandler(protocol.MessageTypeTxSavepoint, s.handleTxSavepoint)
+	s.ipc.RegisterHandler(protocol.MessageTypeTxRelease, s.handleTxRelease)
+}
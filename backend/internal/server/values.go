@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"litebase-backend/internal/config"
+	"litebase-backend/internal/protocol"
+	"litebase-backend/internal/values"
+)
+
+// valueFetchRequest reads part of a truncated value
+type valueFetchRequest struct {
+	Ref    string `msgpack:"ref"`
+	Offset int64  `msgpack:"offset"`
+	Length int64  `msgpack:"length"` // Bytes to read; defaults to 1 MiB
+}
+
+// valueError maps value store failures to an error response
+func valueError(err error) *protocol.Message {
+	switch {
+	case errors.Is(err, values.ErrNotFound):
+		return errorMessage(err, 404, "Unknown or expired value")
+	case errors.Is(err, values.ErrInvalid):
+		return errorMessage(err, 400, "Invalid value request")
+	default:
+		return errorMessage(err, 500, "Internal server error")
+	}
+}
+
+// valueQuotaBytes converts the configured value disk quota
+func valueQuotaBytes(v config.ValuesConfig) int64 {
+	return int64(v.DiskQuotaMB) << 20
+}
+
+// handleValueFetch returns a chunk of a truncated value kept for the
+// caller's session. Text and JSON
+// chunks end at a character boundary; next_offset is where the following
+// chunk starts.
+func (s *Server) handleValueFetch(ctx context.Context, msg *protocol.Message) (*protocol.Message, error) {
+	var req valueFetchRequest
+	if err := msg.DecodeData(&req); err != nil {
+		return errorMessage(err, 400, "Invalid value request"), nil
+	}
+
+	data, info, err := s.values.Read(req.Ref, sessionOwner(ctx), req.Offset, req.Length)
+	if err != nil {
+		return valueError(err), nil
+	}
+	next := req.Offset + int64(len(data))
+	var chunk interface{} = data
+	if info.Kind != "binary" {
+		if next < info.Size {
+			// Leave a character split by the chunk end for the next fetch
+			for i := len(data) - 1; i > 0 && i >= len(data)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(data[i]) {
+					if !utf8.FullRune(data[i:]) {
+						data = data[:i]
+					}
+					break
+				}
+			}
+			next = req.Offset + int64(len(data))
+		}
+		chunk = string(data)
+	}
+
+	return protocol.NewMessage(protocol.MessageTypeValueFetchResponse, map[string]interface{}{
+		"value":       info,
+		"offset":      req.Offset,
+		"data":        chunk,
+		"next_offset": next,
+		"done":        next >= info.Size,
+	}), nil
+}
+
+// registerValueHandlers registers the value handlers
+func (s *Server) registerValueHandlers() {
+	s.ipc.RegisterHandler(protocol.MessageTypeValueFetch, s.handleValueFetch)
+}
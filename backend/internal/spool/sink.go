@@ -0,0 +1,79 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"litebase-backend/internal/database"
+)
+
+const (
+	// batchSize is the number of rows written per transaction
+	batchSize = 500
+	// batchInterval flushes partial batches so slow queries show progress
+	batchInterval = 250 * time.Millisecond
+)
+
+// Sink is a database.RowSink that writes a result to a new spool file in
+// batches. The spool is created once the columns are known.
+type Sink struct {
+	ctx     context.Context
+	path    string
+	opts    Options
+	opened  func(*Spool, []database.Column) error
+	flushed func(rows, bytes int64) error
+
+	spool     *Spool
+	batch     [][]interface{}
+	rows      int64
+	lastFlush time.Time
+}
+
+// NewSink returns a sink spooling to a new file at path, created with opts.
+// opened is called with the spool once it exists, and flushed after each
+// batch with the rows written so far and the disk used; an error from either
+// stops the query.
+func NewSink(ctx context.Context, path string, opts Options, opened func(*Spool, []database.Column) error, flushed func(rows, bytes int64) error) *Sink {
+	return &Sink{ctx: ctx, path: path, opts: opts, opened: opened, flushed: flushed, lastFlush: time.Now()}
+}
+
+// Columns implements database.RowSink
+func (s *Sink) Columns(cols []database.Column) error {
+	sp, err := Create(s.ctx, s.path, len(cols), s.opts)
+	if err != nil {
+		return err
+	}
+	s.spool = sp
+	return s.opened(sp, cols)
+}
+
+// Row implements database.RowSink
+func (s *Sink) Row(row []interface{}) error {
+	s.batch = append(s.batch, row)
+	if len(s.batch) >= batchSize || time.Since(s.lastFlush) >= batchInterval {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush writes the buffered rows. Call it once the query has ended, also
+// after a failure, so the rows read before it are kept.
+func (s *Sink) Flush() error {
+	s.lastFlush = time.Now()
+	if len(s.batch) == 0 || s.spool == nil {
+		return nil
+	}
+	// Rows already read are kept even when the query was cancelled
+	if err := s.spool.Append(context.WithoutCancel(s.ctx), s.rows, s.batch); err != nil {
+		return fmt.Errorf("failed to spool rows: %w", err)
+	}
+	s.rows += int64(len(s.batch))
+	s.batch = s.batch[:0]
+	return s.flushed(s.rows, s.spool.Size())
+}
+
+// Spool returns the spool written to, or nil before the columns arrived
+func (s *Sink) Spool() *Spool {
+	return s.spool
+}
@@ -0,0 +1,279 @@
+// Package spool stores query results in scratch SQLite files, so they can be
+// paged, sorted and filtered without holding them in memory.
+package spool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Spool is a scratch SQLite file holding the rows of one result. Each row is
+// kept msgpack-encoded for faithful reads, and its values are also stored in
+// the columns c0, c1, ... so the rows can be sorted and filtered in SQL.
+type Spool struct {
+	db      *sql.DB
+	path    string
+	columns int
+	insert  string
+}
+
+// timeLayout formats timestamps in the typed columns so they sort as text
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Options configure a new spool file
+type Options struct {
+	// Durable spools survive a crash of the machine, for results that cannot
+	// be rebuilt by re-running their query. Others skip syncing to disk.
+	Durable bool
+}
+
+// Create creates a spool file at path for rows of the given width
+func Create(ctx context.Context, path string, columns int, opts Options) (*Spool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	f.Close()
+
+	db, err := open(path, opts.Durable)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	names := make([]string, columns)
+	marks := make([]string, columns)
+	for i := range names {
+		names[i] = ColumnName(i)
+		marks[i] = ", ?"
+	}
+	create := "CREATE TABLE rows (n INTEGER PRIMARY KEY, data BLOB NOT NULL"
+	for _, name := range names {
+		create += ", " + name
+	}
+	create += ")"
+	s := &Spool{
+		db:      db,
+		path:    path,
+		columns: columns,
+		insert:  "INSERT INTO rows (n, data" + prefixEach(", ", names) + ") VALUES (?, ?" + strings.Join(marks, "") + ")",
+	}
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		s.Remove()
+		return nil, fmt.Errorf("failed to create spool table: %w", err)
+	}
+	return s, nil
+}
+
+// Open opens an existing spool file for reading
+func Open(path string) (*Spool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := open(path, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Spool{db: db, path: path}, nil
+}
+
+// open opens the database of a spool file. In WAL mode synchronous=NORMAL
+// keeps committed rows across a crash, apart from the last few; OFF trades
+// that for speed.
+func open(path string, durable bool) (*sql.DB, error) {
+	synchronous := "OFF"
+	if durable {
+		synchronous = "NORMAL"
+	}
+	return sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous="+synchronous+"&_busy_timeout=5000")
+}
+
+// Path returns the spool file path
+func (s *Spool) Path() string {
+	return s.path
+}
+
+// ColumnName returns the spool column holding result column i
+func ColumnName(i int) string {
+	return fmt.Sprintf("c%d", i)
+}
+
+// prefixEach joins items, putting sep before each one
+func prefixEach(sep string, items []string) string {
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString(sep)
+		b.WriteString(item)
+	}
+	return b.String()
+}
+
+// Append stores rows numbered from first in one transaction
+func (s *Spool) Append(ctx context.Context, first int64, rows [][]interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, s.insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	args := make([]interface{}, s.columns+2)
+	for i, row := range rows {
+		data, err := msgpack.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to encode row: %w", err)
+		}
+		args[0], args[1] = first+int64(i), data
+		for j := 0; j < s.columns; j++ {
+			args[j+2] = nil
+			if j < len(row) {
+				args[j+2] = ColumnValue(row[j])
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ColumnValue converts a row value to what the typed columns store
+func ColumnValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, int64, float64, string, []byte:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case time.Time:
+		return v.UTC().Format(timeLayout)
+	case interface{ Scalar() interface{} }:
+		// Tagged values such as decimals sort by their plain form
+		return ColumnValue(v.Scalar())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Read returns up to limit rows starting at row offset
+func (s *Spool) Read(ctx context.Context, offset, limit int64) ([][]interface{}, error) {
+	return s.query(ctx, "SELECT data FROM rows WHERE n >= ? ORDER BY n LIMIT ?", offset, limit)
+}
+
+// CreateView stores the numbers of the rows matching where, sorted by
+// order, in table name and returns how many there are. where and order are
+// SQL over the columns n and c0, c1, ...
+func (s *Spool) CreateView(ctx context.Context, name, where string, args []interface{}, order string) (int64, error) {
+	if _, err := s.db.ExecContext(ctx, "CREATE TABLE "+name+" (i INTEGER PRIMARY KEY, n INTEGER NOT NULL)"); err != nil {
+		return 0, err
+	}
+	// Rows get ascending i in the order of the SELECT
+	res, err := s.db.ExecContext(ctx, "INSERT INTO "+name+" (n) SELECT n FROM rows"+where+order, args...)
+	if err != nil {
+		s.DropView(name)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReadView returns up to limit rows of view name starting at position offset
+func (s *Spool) ReadView(ctx context.Context, name string, offset, limit int64) ([][]interface{}, error) {
+	return s.query(ctx, "SELECT r.data FROM "+name+" v JOIN rows r ON r.n = v.n WHERE v.i > ? ORDER BY v.i LIMIT ?", offset, limit)
+}
+
+// DropView deletes the table of view name
+func (s *Spool) DropView(name string) error {
+	_, err := s.db.Exec("DROP TABLE IF EXISTS " + name)
+	return err
+}
+
+// query decodes the rows selected by a query returning the data column
+func (s *Spool) query(ctx context.Context, query string, args ...interface{}) ([][]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := [][]interface{}{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var row []interface{}
+		if err := msgpack.Unmarshal(data, &row); err != nil {
+			return nil, fmt.Errorf("failed to decode row: %w", err)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// Size returns the disk space used by the spool file and its journal
+func (s *Spool) Size() int64 {
+	var total int64
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// Close closes the spool, keeping its file
+func (s *Spool) Close() error {
+	return s.db.Close()
+}
+
+// Remove closes the spool and deletes its files
+func (s *Spool) Remove() error {
+	err := s.db.Close()
+	if rmErr := RemoveFiles(s.path); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// RemoveFiles deletes the spool file at path and its journal files
+func RemoveFiles(path string) error {
+	var err error
+	for _, p := range []string{path, path + "-wal", path + "-shm"} {
+		if rmErr := os.Remove(p); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,333 @@
+package sqlparse
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dialect selects the quoting and comment rules of a database.
+// The values match the database driver names.
+type Dialect string
+
+// Supported dialects
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite3"
+)
+
+// tokenKind classifies a lexical token
+type tokenKind int
+
+const (
+	tokWord    tokenKind = iota // Keyword or unquoted identifier
+	tokQuoted                   // String literal or quoted identifier
+	tokNumber                   // Numeric literal
+	tokParam                    // Placeholder such as $1, ? or :name
+	tokSymbol                   // Any other single character
+	tokEnd                      // Statement terminator: ; or the current MySQL delimiter
+	tokCommand                  // Client command handled by the splitter, e.g. MySQL DELIMITER
+)
+
+// token is one lexical unit of SQL text
+type token struct {
+	kind  tokenKind
+	text  string // Upper-cased for words
+	start int    // Byte offset of the first character
+	end   int    // Byte offset after the last character
+}
+
+// lexer splits SQL text into tokens, skipping whitespace and comments
+type lexer struct {
+	src     string
+	dialect Dialect
+	pos     int
+
+	delimiter      string // Statement terminator set with the MySQL DELIMITER command
+	versionComment bool   // Inside a MySQL /*! ... */ comment, whose contents are executed
+	unterminated   bool   // A string or comment ran to the end of the input
+}
+
+// tokenize returns every token of src
+func tokenize(src string, dialect Dialect) ([]token, bool) {
+	l := &lexer{src: src, dialect: dialect, delimiter: ";"}
+	var tokens []token
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return tokens, l.unterminated
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// next returns the next token, or false at the end of the input
+func (l *lexer) next() (token, bool) {
+	for l.skipSpaceAndComments() {
+	}
+	if l.pos >= len(l.src) {
+		return token{}, false
+	}
+
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], l.delimiter) {
+		l.pos += len(l.delimiter)
+		return token{kind: tokEnd, text: l.delimiter, start: start, end: l.pos}, true
+	}
+	if l.dialect == MySQL && l.atLineStart() && hasWordPrefix(l.src[l.pos:], "DELIMITER") {
+		return l.delimiterCommand(), true
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '\'':
+		l.skipQuoted('\'', l.dialect == MySQL)
+		return token{kind: tokQuoted, start: start, end: l.pos}, true
+	case (c == 'E' || c == 'e') && l.dialect == Postgres && l.peek(1) == '\'':
+		l.pos++
+		l.skipQuoted('\'', true)
+		return token{kind: tokQuoted, start: start, end: l.pos}, true
+	case c == '"':
+		l.skipQuoted('"', l.dialect == MySQL)
+		return token{kind: tokQuoted, start: start, end: l.pos}, true
+	case c == '`' && l.dialect != Postgres:
+		l.skipQuoted('`', false)
+		return token{kind: tokQuoted, start: start, end: l.pos}, true
+	case c == '[' && l.dialect == SQLite:
+		l.pos++
+		l.skipUntil("]")
+		return token{kind: tokQuoted, start: start, end: l.pos}, true
+	case c == '$':
+		if tag, ok := l.dollarTag(); ok && l.dialect == Postgres {
+			l.pos += len(tag)
+			l.skipUntil(tag)
+			return token{kind: tokQuoted, start: start, end: l.pos}, true
+		}
+		// $1 everywhere, and SQLite's $name
+		if isDigit(l.peek(1)) || (l.dialect == SQLite && isWordStart(l.peekRune(1))) {
+			l.pos++
+			l.skipWord()
+			return token{kind: tokParam, text: l.src[start:l.pos], start: start, end: l.pos}, true
+		}
+	case c == '?':
+		l.pos++
+		for l.dialect == SQLite && l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokParam, text: l.src[start:l.pos], start: start, end: l.pos}, true
+	case (c == ':' || c == '@') && isWordStart(l.peekRune(1)) && l.peek(-1) != c:
+		// :name (and @name in SQLite); "::" casts and MySQL @@variables are not placeholders
+		if c == ':' || l.dialect == SQLite {
+			if c == ':' && l.peek(1) == ':' {
+				break
+			}
+			l.pos++
+			l.skipWord()
+			return token{kind: tokParam, text: l.src[start:l.pos], start: start, end: l.pos}, true
+		}
+	case isDigit(c) || (c == '.' && isDigit(l.peek(1))):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.' || l.src[l.pos] == 'e' || l.src[l.pos] == 'E' ||
+			((l.src[l.pos] == '+' || l.src[l.pos] == '-') && (l.peek(-1) == 'e' || l.peek(-1) == 'E'))) {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], start: start, end: l.pos}, true
+	}
+
+	if isWordStart(l.peekRune(0)) {
+		l.skipWord()
+		return token{kind: tokWord, text: strings.ToUpper(l.src[start:l.pos]), start: start, end: l.pos}, true
+	}
+
+	_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	l.pos += size
+	return token{kind: tokSymbol, text: l.src[start:l.pos], start: start, end: l.pos}, true
+}
+
+// delimiterCommand reads a MySQL client DELIMITER line and switches to
+// the delimiter it sets
+func (l *lexer) delimiterCommand() token {
+	start := l.pos
+	l.skipLine()
+	line := strings.TrimSpace(l.src[start:l.pos])
+	if fields := strings.Fields(line[len("DELIMITER"):]); len(fields) > 0 {
+		l.delimiter = fields[0]
+	}
+	return token{kind: tokCommand, text: "DELIMITER", start: start, end: start + len(line)}
+}
+
+// atLineStart reports whether only whitespace precedes l.pos on its line
+func (l *lexer) atLineStart() bool {
+	for i := l.pos - 1; i >= 0 && l.src[i] != '\n'; i-- {
+		if l.src[i] != ' ' && l.src[i] != '\t' && l.src[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWordPrefix reports whether s starts with word, case-insensitively,
+// followed by whitespace
+func hasWordPrefix(s, word string) bool {
+	return len(s) > len(word) && strings.EqualFold(s[:len(word)], word) && unicode.IsSpace(rune(s[len(word)]))
+}
+
+// skipSpaceAndComments skips one run of whitespace or one comment.
+// It returns false when there was nothing to skip.
+func (l *lexer) skipSpaceAndComments() bool {
+	if l.pos >= len(l.src) {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	switch {
+	case unicode.IsSpace(r):
+		l.pos += size
+		return true
+	case strings.HasPrefix(l.src[l.pos:], "--"):
+		l.skipLine()
+		return true
+	case r == '#' && l.dialect == MySQL:
+		l.skipLine()
+		return true
+	case strings.HasPrefix(l.src[l.pos:], "/*!") && l.dialect == MySQL:
+		// Versioned comments are executed by MySQL, so their contents are lexed
+		l.pos += 3
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		l.versionComment = true
+		return true
+	case strings.HasPrefix(l.src[l.pos:], "*/") && l.versionComment:
+		l.pos += 2
+		l.versionComment = false
+		return true
+	case strings.HasPrefix(l.src[l.pos:], "/*"):
+		l.skipBlockComment()
+		return true
+	}
+	return false
+}
+
+// skipLine skips to the end of the line
+func (l *lexer) skipLine() {
+	if i := strings.IndexByte(l.src[l.pos:], '\n'); i >= 0 {
+		l.pos += i + 1
+	} else {
+		l.pos = len(l.src)
+	}
+}
+
+// skipBlockComment skips a /* */ comment; PostgreSQL comments nest
+func (l *lexer) skipBlockComment() {
+	depth := 0
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			if depth == 0 || l.dialect == Postgres {
+				depth++
+			}
+			l.pos += 2
+		case strings.HasPrefix(l.src[l.pos:], "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return
+			}
+		default:
+			l.pos++
+		}
+	}
+	l.unterminated = true
+}
+
+// skipQuoted skips a quoted string or identifier starting at l.pos.
+// A doubled quote character is an escaped quote; backslash escapes are
+// honoured when backslash is set.
+func (l *lexer) skipQuoted(quote byte, backslash bool) {
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case backslash && c == '\\':
+			l.pos += 2
+		case c == quote && l.peek(1) == quote:
+			l.pos += 2
+		case c == quote:
+			l.pos++
+			return
+		default:
+			l.pos++
+		}
+	}
+	l.pos = len(l.src)
+	l.unterminated = true
+}
+
+// skipUntil skips past the next occurrence of end at or after l.pos
+func (l *lexer) skipUntil(end string) {
+	if i := strings.Index(l.src[l.pos:], end); i >= 0 {
+		l.pos += i + len(end)
+		return
+	}
+	l.pos = len(l.src)
+	l.unterminated = true
+}
+
+// dollarTag returns the $tag$ opening a PostgreSQL dollar-quoted string at l.pos
+func (l *lexer) dollarTag() (string, bool) {
+	end := l.pos + 1
+	for end < len(l.src) && l.src[end] != '$' {
+		r, size := utf8.DecodeRuneInString(l.src[end:])
+		if !(r == '_' || unicode.IsLetter(r) || (end > l.pos+1 && unicode.IsDigit(r))) {
+			return "", false
+		}
+		end += size
+	}
+	if end >= len(l.src) {
+		return "", false
+	}
+	return l.src[l.pos : end+1], true
+}
+
+// skipWord skips identifier characters, stopping at a custom delimiter such as $$
+func (l *lexer) skipWord() {
+	for l.pos < len(l.src) {
+		if l.delimiter != ";" && strings.HasPrefix(l.src[l.pos:], l.delimiter) {
+			return
+		}
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return
+		}
+		l.pos += size
+	}
+}
+
+// peek returns the byte at offset from l.pos, or 0 outside the input
+func (l *lexer) peek(offset int) byte {
+	i := l.pos + offset
+	if i < 0 || i >= len(l.src) {
+		return 0
+	}
+	return l.src[i]
+}
+
+// peekRune returns the rune at offset bytes from l.pos
+func (l *lexer) peekRune(offset int) rune {
+	i := l.pos + offset
+	if i < 0 || i >= len(l.src) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[i:])
+	return r
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWordStart reports whether r can begin a keyword or identifier
+func isWordStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
@@ -0,0 +1,37 @@
+package sqlparse
+
+import "testing"
+
+func TestTokenizeQuoted(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		dialect      Dialect
+		quoted       string
+		unterminated bool
+	}{
+		{"empty dollar body", "SELECT $$$$", Postgres, "$$$$", false},
+		{"empty tagged body", "SELECT $a$$a$", Postgres, "$a$$a$", false},
+		{"tagged body", "SELECT $a$ x; y $a$", Postgres, "$a$ x; y $a$", false},
+		{"body starting with the tag character", "SELECT $$$ $$", Postgres, "$$$ $$", false},
+		{"nested other tag", "SELECT $a$ $b$ $a$", Postgres, "$a$ $b$ $a$", false},
+		{"unterminated dollar body", "SELECT $$ x", Postgres, "$$ x", true},
+		{"single character bracket identifier", "SELECT [a]", SQLite, "[a]", false},
+		{"empty bracket identifier", "SELECT []", SQLite, "[]", false},
+		{"unterminated bracket identifier", "SELECT [a", SQLite, "[a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, unterminated := tokenize(tt.src, tt.dialect)
+			if unterminated != tt.unterminated {
+				t.Errorf("unterminated = %v, want %v", unterminated, tt.unterminated)
+			}
+			if len(tokens) != 2 || tokens[1].kind != tokQuoted {
+				t.Fatalf("tokens = %+v, want SELECT and one quoted token", tokens)
+			}
+			if got := tt.src[tokens[1].start:tokens[1].end]; got != tt.quoted {
+				t.Errorf("quoted = %q, want %q", got, tt.quoted)
+			}
+		})
+	}
+}
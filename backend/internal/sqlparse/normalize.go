@@ -0,0 +1,39 @@
+package sqlparse
+
+import "strings"
+
+// Normalize returns sql with comments removed, runs of whitespace collapsed
+// and keywords upper-cased, so that texts differing only in layout compare
+// equal. Literals, quoted identifiers and the case of unquoted identifiers
+// are kept, since they can change what a statement means. A trailing
+// terminator is dropped.
+func Normalize(sql string, dialect Dialect) string {
+	tokens, _ := tokenize(sql, dialect)
+	for len(tokens) > 0 && tokens[len(tokens)-1].kind == tokEnd {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if tok.kind == tokWord && keywords[tok.text] {
+			b.WriteString(tok.text)
+		} else {
+			b.WriteString(sql[tok.start:tok.end])
+		}
+	}
+	return b.String()
+}
+
+// keywords are the reserved words Normalize upper-cases. Other words are
+// left alone, as MySQL table names can be case-sensitive.
+var keywords = keywordSet(
+	"SELECT", "FROM", "WHERE", "AND", "OR", "NOT", "IN", "IS", "NULL", "AS",
+	"JOIN", "INNER", "LEFT", "RIGHT", "FULL", "OUTER", "CROSS", "ON", "USING",
+	"GROUP", "BY", "HAVING", "ORDER", "ASC", "DESC", "LIMIT", "OFFSET",
+	"UNION", "ALL", "DISTINCT", "EXISTS", "BETWEEN", "LIKE", "CASE", "WHEN",
+	"THEN", "ELSE", "END", "WITH", "INSERT", "INTO", "VALUES", "UPDATE", "SET",
+	"DELETE", "RETURNING",
+)
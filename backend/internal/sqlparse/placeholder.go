@@ -0,0 +1,34 @@
+package sqlparse
+
+import "strconv"
+
+// Placeholder is a bind parameter reference in SQL text
+type Placeholder struct {
+	Start    int    // Byte offset of the placeholder
+	End      int    // Byte offset after it
+	Position int    // 1-based position of $N and ?N; 0 for a bare ? and named placeholders
+	Name     string // Name of :name, @name and $name, without the prefix
+}
+
+// Placeholders returns the bind parameter references in sql, skipping
+// string literals, quoted identifiers and comments
+func Placeholders(sql string, dialect Dialect) []Placeholder {
+	tokens, _ := tokenize(sql, dialect)
+
+	var placeholders []Placeholder
+	for _, tok := range tokens {
+		if tok.kind != tokParam {
+			continue
+		}
+		p := Placeholder{Start: tok.start, End: tok.end}
+		if rest := tok.text[1:]; rest != "" {
+			if n, err := strconv.Atoi(rest); err == nil && n > 0 {
+				p.Position = n
+			} else {
+				p.Name = rest
+			}
+		}
+		placeholders = append(placeholders, p)
+	}
+	return placeholders
+}
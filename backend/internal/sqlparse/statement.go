@@ -0,0 +1,363 @@
+package sqlparse
+
+import "strings"
+
+// Class is the kind of effect a statement has
+type Class string
+
+// Statement classes, from harmless to most invasive
+const (
+	ClassRead        Class = "read"        // Reads data only
+	ClassSession     Class = "session"     // SET, RESET, USE and similar session settings
+	ClassTransaction Class = "transaction" // BEGIN, COMMIT, ROLLBACK, SAVEPOINT
+	ClassWrite       Class = "write"       // Changes or locks data: INSERT, UPDATE, DELETE, CALL, ...
+	ClassDDL         Class = "ddl"         // Changes schema, privileges or server state
+	ClassUnknown     Class = "unknown"     // Not recognized; treated as a write
+)
+
+// rank orders classes by how invasive they are
+func (c Class) rank() int {
+	switch c {
+	case ClassRead:
+		return 0
+	case ClassSession:
+		return 1
+	case ClassTransaction:
+		return 2
+	case ClassWrite:
+		return 3
+	case ClassDDL:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// Statement is one statement of a SQL script
+type Statement struct {
+	Text              string `msgpack:"text"`
+	Start             int    `msgpack:"start"` // Byte offset in the script
+	End               int    `msgpack:"end"`
+	StartLine         int    `msgpack:"start_line"` // 1-based line of Start
+	EndLine           int    `msgpack:"end_line"`
+	Keyword           string `msgpack:"keyword"` // Leading keyword, upper case
+	Class             Class  `msgpack:"class"`
+	ReturnsRows       bool   `msgpack:"returns_rows"`
+	ChangesAccessMode bool   `msgpack:"changes_access_mode"` // Switches the session or transaction to read-write
+
+	tokens []token
+}
+
+// ReadOnlySafe reports whether the statement may run on a read-only connection
+func (s Statement) ReadOnlySafe() bool {
+	switch s.Class {
+	case ClassRead:
+		return true
+	case ClassSession, ClassTransaction:
+		return !s.ChangesAccessMode
+	default:
+		return false
+	}
+}
+
+// Parse splits a script into statements and classifies each one.
+// Statements end at semicolons outside strings, comments, dollar-quoted
+// bodies and trigger bodies; MySQL scripts may switch to another terminator
+// with the client's DELIMITER command. Empty statements and trailing
+// comments are dropped.
+func Parse(script string, dialect Dialect) []Statement {
+	tokens, _ := tokenize(script, dialect)
+
+	var stmts []Statement
+	lines := lineCounter{src: script, line: 1}
+	start := 0
+	depth := 0 // BEGIN ... END nesting inside CREATE TRIGGER bodies
+	trigger := false
+	flush := func(end int) {
+		if end > start {
+			stmt := newStatement(script, tokens[start:end], dialect)
+			stmt.StartLine, stmt.EndLine = lines.at(stmt.Start), lines.at(stmt.End)
+			stmts = append(stmts, stmt)
+		}
+		start, depth, trigger = end+1, 0, false
+	}
+
+	for i, tok := range tokens {
+		switch {
+		case tok.kind == tokCommand:
+			flush(i)
+		case tok.kind == tokWord && i-start < 4 && tok.text == "TRIGGER" && tokens[start].text == "CREATE":
+			trigger = true
+		case trigger && tok.kind == tokWord && (tok.text == "BEGIN" || tok.text == "CASE"):
+			depth++
+		case trigger && tok.kind == tokWord && tok.text == "END" && depth > 0:
+			depth--
+		case tok.kind == tokEnd && (depth == 0 || tok.text != ";"):
+			// A custom delimiter always ends the statement
+			flush(i)
+		}
+	}
+	flush(len(tokens))
+	return stmts
+}
+
+// lineCounter maps increasing byte offsets to line numbers
+type lineCounter struct {
+	src  string
+	pos  int
+	line int
+}
+
+// at returns the 1-based line of offset, which must not decrease between calls
+func (c *lineCounter) at(offset int) int {
+	c.line += strings.Count(c.src[c.pos:offset], "\n")
+	c.pos = offset
+	return c.line
+}
+
+// Classify classifies a single statement. Scripts with several statements
+// are classified by their most invasive statement.
+func Classify(sql string, dialect Dialect) Statement {
+	stmts := Parse(sql, dialect)
+	if len(stmts) == 0 {
+		return Statement{Text: sql, Class: ClassRead}
+	}
+	return Strictest(stmts)
+}
+
+// Strictest returns the most invasive of stmts; the first one wins a tie
+func Strictest(stmts []Statement) Statement {
+	var strictest Statement
+	for i, stmt := range stmts {
+		if i == 0 || stmt.Class.rank() > strictest.Class.rank() ||
+			(stmt.Class == strictest.Class && stmt.ChangesAccessMode && !strictest.ChangesAccessMode) {
+			strictest = stmt
+		}
+	}
+	return strictest
+}
+
+// newStatement builds a classified statement from its tokens
+func newStatement(script string, tokens []token, dialect Dialect) Statement {
+	first, last := tokens[0], tokens[len(tokens)-1]
+	s := Statement{
+		Text:   script[first.start:last.end],
+		Start:  first.start,
+		End:    last.end,
+		tokens: tokens,
+	}
+	s.classify(dialect)
+	return s
+}
+
+// Keyword groups used by the classifier
+var (
+	readKeywords = keywordSet("SELECT", "VALUES", "TABLE", "WITH")
+	showKeywords = keywordSet("SHOW", "DESCRIBE", "DESC", "EXPLAIN", "FETCH", "HELP")
+	dmlKeywords  = keywordSet("INSERT", "UPDATE", "DELETE", "MERGE", "UPSERT", "REPLACE", "TRUNCATE")
+
+	writeKeywords = keywordSet("INSERT", "UPDATE", "DELETE", "MERGE", "UPSERT", "REPLACE", "COPY", "LOAD",
+		"CALL", "EXEC", "EXECUTE", "DO", "LOCK", "HANDLER")
+	ddlKeywords = keywordSet("CREATE", "ALTER", "DROP", "RENAME", "COMMENT", "GRANT", "REVOKE", "TRUNCATE",
+		"REINDEX", "VACUUM", "ANALYZE", "ANALYSE", "CLUSTER", "REFRESH", "ATTACH", "DETACH", "OPTIMIZE",
+		"REPAIR", "CHECK", "CHECKSUM", "IMPORT", "SECURITY", "REASSIGN", "CHECKPOINT", "FLUSH", "PURGE",
+		"INSTALL", "UNINSTALL", "KILL", "SHUTDOWN", "CHANGE", "BINLOG", "CACHE")
+	transactionKeywords = keywordSet("BEGIN", "START", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE",
+		"ABORT", "XA")
+	sessionKeywords = keywordSet("SET", "RESET", "USE", "DISCARD", "PREPARE", "DEALLOCATE", "DECLARE",
+		"MOVE", "CLOSE", "LISTEN", "UNLISTEN", "NOTIFY", "UNLOCK")
+
+	// accessModeSettings toggle the read-only session defaults
+	accessModeSettings = keywordSet("DEFAULT_TRANSACTION_READ_ONLY", "TRANSACTION_READ_ONLY", "TX_READ_ONLY",
+		"QUERY_ONLY", "READ_ONLY", "SUPER_READ_ONLY")
+
+	// Functions that act beyond reading when called from a query. set_config
+	// may switch the session to read-write under any setting name, so every
+	// call counts as changing the access mode.
+	sessionFunctions = keywordSet("SET_CONFIG")
+	writeFunctions   = keywordSet("NEXTVAL", "SETVAL", "LO_CREATE", "LO_CREAT", "LO_IMPORT", "LO_EXPORT",
+		"LO_UNLINK", "LO_PUT", "LO_FROM_BYTEA", "DBLINK", "DBLINK_EXEC", "PG_FILE_WRITE", "PG_FILE_RENAME",
+		"PG_FILE_UNLINK")
+	adminFunctions = keywordSet("PG_RELOAD_CONF", "PG_TERMINATE_BACKEND", "PG_CANCEL_BACKEND",
+		"PG_ROTATE_LOGFILE", "PG_SWITCH_WAL", "PG_CREATE_RESTORE_POINT", "PG_PROMOTE", "PG_BACKUP_START",
+		"PG_BACKUP_STOP", "LOAD_EXTENSION")
+
+	// readPragmas are SQLite pragmas that take an argument but only read
+	readPragmas = keywordSet("TABLE_INFO", "TABLE_XINFO", "TABLE_LIST", "INDEX_INFO", "INDEX_XINFO",
+		"INDEX_LIST", "FOREIGN_KEY_LIST", "FOREIGN_KEY_CHECK", "INTEGRITY_CHECK", "QUICK_CHECK")
+
+	// writePragmas change the database file when assigned
+	writePragmas = keywordSet("USER_VERSION", "APPLICATION_ID", "SCHEMA_VERSION", "JOURNAL_MODE", "AUTO_VACUUM",
+		"PAGE_SIZE", "WRITABLE_SCHEMA", "INCREMENTAL_VACUUM", "OPTIMIZE", "WAL_CHECKPOINT")
+)
+
+// keywordSet builds a lookup set of upper-case keywords
+func keywordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// classify sets Keyword, Class, ReturnsRows and ChangesAccessMode
+func (s *Statement) classify(dialect Dialect) {
+	words, bare, calls := s.words()
+	if len(words) == 0 {
+		s.Class = ClassUnknown
+		return
+	}
+	s.Keyword = words[0]
+	s.Class, s.ReturnsRows = classifyWords(words, bare, calls, s.tokens, dialect)
+
+	switch s.Class {
+	case ClassSession, ClassTransaction:
+		s.ChangesAccessMode = hasSequence(words, "READ", "WRITE") || containsAny(words, accessModeSettings) ||
+			containsAny(calls, sessionFunctions)
+	}
+}
+
+// classifyWords classifies a statement from its upper-cased words; bare
+// excludes function names such as REPLACE(...), which calls holds
+func classifyWords(words, bare, calls []string, tokens []token, dialect Dialect) (Class, bool) {
+	keyword := words[0]
+	returning := contains(words, "RETURNING")
+
+	switch {
+	case readKeywords[keyword]:
+		// Data-modifying CTEs, SELECT ... INTO and row locks (FOR UPDATE) all write
+		if containsAny(bare, dmlKeywords) || (dialect != SQLite && contains(bare, "INTO")) {
+			return ClassWrite, true
+		}
+		switch {
+		case containsAny(calls, adminFunctions):
+			return ClassDDL, true
+		case containsAny(calls, writeFunctions):
+			return ClassWrite, true
+		case containsAny(calls, sessionFunctions):
+			return ClassSession, true
+		}
+		return ClassRead, true
+
+	case keyword == "EXPLAIN" || keyword == "DESCRIBE" || keyword == "DESC":
+		// EXPLAIN ANALYZE executes the statement it explains
+		if contains(bare, "ANALYZE") || contains(bare, "ANALYSE") {
+			for i := 1; i < len(bare); i++ {
+				if w := bare[i]; readKeywords[w] || writeKeywords[w] || dmlKeywords[w] {
+					class, _ := classifyWords(bare[i:], bare[i:], calls, nil, dialect)
+					return class, true
+				}
+			}
+		}
+		return ClassRead, true
+
+	case showKeywords[keyword]:
+		return ClassRead, true
+
+	case keyword == "PRAGMA":
+		if len(words) < 2 {
+			return ClassRead, true
+		}
+		name := pragmaName(words, tokens)
+		if hasSymbol(tokens, "=") || (hasSymbol(tokens, "(") && !readPragmas[name]) {
+			if writePragmas[name] {
+				return ClassWrite, false
+			}
+			return ClassSession, false
+		}
+		return ClassRead, true
+
+	case keyword == "SET":
+		// Server-wide settings are administration, not session state
+		scope := words[min(1, len(words)-1)]
+		if scope == "GLOBAL" || scope == "PERSIST" || scope == "PERSIST_ONLY" || (contains(words, "GLOBAL") && hasSymbol(tokens, "@")) {
+			return ClassDDL, false
+		}
+		return ClassSession, false
+
+	case keyword == "RESET" && dialect == MySQL:
+		// RESET MASTER, RESET REPLICA, ... are server administration in MySQL
+		return ClassDDL, false
+
+	case keyword == "CALL" || keyword == "EXECUTE" || keyword == "EXEC":
+		return ClassWrite, true
+
+	case transactionKeywords[keyword]:
+		return ClassTransaction, false
+
+	case sessionKeywords[keyword]:
+		return ClassSession, false
+
+	case writeKeywords[keyword] || dmlKeywords[keyword] && !ddlKeywords[keyword]:
+		return ClassWrite, returning
+
+	case ddlKeywords[keyword]:
+		return ClassDDL, dialect == MySQL && (keyword == "ANALYZE" || keyword == "OPTIMIZE" || keyword == "REPAIR" || keyword == "CHECK" || keyword == "CHECKSUM")
+	}
+	return ClassUnknown, false
+}
+
+// pragmaName returns the name of a PRAGMA, skipping a schema qualifier
+func pragmaName(words []string, tokens []token) string {
+	if len(words) > 2 && len(tokens) > 2 && tokens[2].text == "." {
+		return words[2]
+	}
+	return words[1]
+}
+
+// words returns the upper-cased keywords and identifiers of the statement,
+// split into those not followed by "(" and function calls
+func (s *Statement) words() (words, bare, calls []string) {
+	for i, tok := range s.tokens {
+		if tok.kind != tokWord {
+			continue
+		}
+		words = append(words, tok.text)
+		if i+1 == len(s.tokens) || s.tokens[i+1].text != "(" {
+			bare = append(bare, tok.text)
+		} else {
+			calls = append(calls, tok.text)
+		}
+	}
+	return words, bare, calls
+}
+
+// contains reports whether words includes word
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether words includes any word of set
+func containsAny(words []string, set map[string]bool) bool {
+	for _, w := range words {
+		if set[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSequence reports whether words contains seq as consecutive words
+func hasSequence(words []string, seq ...string) bool {
+	for i := 0; i+len(seq) <= len(words); i++ {
+		if strings.Join(words[i:i+len(seq)], " ") == strings.Join(seq, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSymbol reports whether tokens include the symbol
+func hasSymbol(tokens []token, symbol string) bool {
+	for _, tok := range tokens {
+		if tok.kind == tokSymbol && tok.text == symbol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package sqlparse
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		dialect  Dialect
+		keywords []string
+		classes  []Class
+	}{
+		{"empty dollar body", "SELECT $$$$; DELETE FROM t", Postgres, []string{"SELECT", "DELETE"}, []Class{ClassRead, ClassWrite}},
+		{"empty tagged body", "SELECT $a$$a$; DELETE FROM t", Postgres, []string{"SELECT", "DELETE"}, []Class{ClassRead, ClassWrite}},
+		{"semicolon in tagged body", "SELECT $fn$ a; b $fn$; UPDATE t SET x = 1", Postgres, []string{"SELECT", "UPDATE"}, []Class{ClassRead, ClassWrite}},
+		{"dollar body in function", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT f()", Postgres, []string{"CREATE", "SELECT"}, []Class{ClassDDL, ClassRead}},
+		{"dollar is not a quote in mysql", "SELECT '$$'; SELECT 1", MySQL, []string{"SELECT", "SELECT"}, []Class{ClassRead, ClassRead}},
+		{"bracket identifier", "SELECT [a;b] FROM t; DELETE FROM t", SQLite, []string{"SELECT", "DELETE"}, []Class{ClassRead, ClassWrite}},
+		{"trailing comment", "SELECT 1; -- done", Postgres, []string{"SELECT"}, []Class{ClassRead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmts := Parse(tt.script, tt.dialect)
+			if len(stmts) != len(tt.keywords) {
+				t.Fatalf("got %d statements, want %d: %+v", len(stmts), len(tt.keywords), stmts)
+			}
+			for i, stmt := range stmts {
+				if stmt.Keyword != tt.keywords[i] || stmt.Class != tt.classes[i] {
+					t.Errorf("statement %d = %s/%s, want %s/%s", i, stmt.Keyword, stmt.Class, tt.keywords[i], tt.classes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		sql          string
+		dialect      Dialect
+		class        Class
+		readOnlySafe bool
+	}{
+		{"SELECT $$$$; DELETE FROM t", Postgres, ClassWrite, false},
+		{"SELECT $a$$a$; DELETE FROM t", Postgres, ClassWrite, false},
+		{"SELECT $a$ DELETE FROM t $a$", Postgres, ClassRead, true},
+		{"SELECT 1", SQLite, ClassRead, true},
+		{"", SQLite, ClassRead, true},
+		// Function calls that change the session, write or administer the server
+		{"SELECT set_config('default_transaction_read_only', 'off', false)", Postgres, ClassSession, false},
+		{"SELECT pg_catalog.set_config('search_path', 'public', true)", Postgres, ClassSession, false},
+		{"SELECT set_config('transaction_read_only', 'off', false)", MySQL, ClassSession, false},
+		{"SELECT set_config('x', 'y', false)", SQLite, ClassSession, false},
+		{"WITH s AS (SELECT setval('ids', 1)) SELECT * FROM s", Postgres, ClassWrite, false},
+		{"SELECT nextval('ids')", Postgres, ClassWrite, false},
+		{"SELECT lo_unlink(16384)", Postgres, ClassWrite, false},
+		{"SELECT * FROM dblink('dbname=x', 'DELETE FROM t') AS t(n int)", Postgres, ClassWrite, false},
+		{"SELECT pg_terminate_backend(pid) FROM pg_stat_activity", Postgres, ClassDDL, false},
+		{"SELECT load_extension('evil')", SQLite, ClassDDL, false},
+		{"EXPLAIN ANALYZE SELECT set_config('default_transaction_read_only', 'off', false)", Postgres, ClassSession, false},
+		{"SELECT set_config FROM settings", Postgres, ClassRead, true},
+		{"SELECT current_setting('default_transaction_read_only')", Postgres, ClassRead, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			stmt := Classify(tt.sql, tt.dialect)
+			if stmt.Class != tt.class {
+				t.Errorf("class = %s, want %s", stmt.Class, tt.class)
+			}
+			if got := stmt.ReadOnlySafe(); got != tt.readOnlySafe {
+				t.Errorf("ReadOnlySafe = %v, want %v", got, tt.readOnlySafe)
+			}
+		})
+	}
+}
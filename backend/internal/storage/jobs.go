@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/sqlparse"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Job statuses
+const (
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobCancelled   = "cancelled"
+	JobInterrupted = "interrupted" // The backend stopped while the job was running
+)
+
+// Job is a query run in the background. Its rows are kept in a result file
+// next to the database; the record holds everything else.
+type Job struct {
+	ID           string            `msgpack:"id"`
+	Label        string            `msgpack:"label"`
+	ConnectionID string            `msgpack:"connection_id"`
+	SQL          string            `msgpack:"sql"`
+	Status       string            `msgpack:"status"`
+	Class        sqlparse.Class    `msgpack:"class"`
+	Columns      []database.Column `msgpack:"columns"`
+	Rows         int64             `msgpack:"rows"`          // Rows stored so far
+	RowsAffected int64             `msgpack:"rows_affected"` // Set when the job has finished
+	Truncated    bool              `msgpack:"truncated"`     // Stopped at max_rows
+	Error        string            `msgpack:"error"`
+	Bytes        int64             `msgpack:"bytes"` // Disk used by the result file
+	CreatedAt    time.Time         `msgpack:"created_at"`
+	FinishedAt   *time.Time        `msgpack:"finished_at"`
+	ExpiresAt    *time.Time        `msgpack:"expires_at"` // When the finished job and its result are deleted
+}
+
+// Finished reports whether the job has stopped running
+func (j Job) Finished() bool {
+	return j.Status != JobRunning
+}
+
+// SaveJob inserts or replaces a job record
+func (s *Store) SaveJob(ctx context.Context, j Job) error {
+	data, err := msgpack.Marshal(j)
+	if err != nil {
+		return err
+	}
+	var finishedAt interface{}
+	if j.FinishedAt != nil {
+		finishedAt = formatTime(*j.FinishedAt)
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT OR REPLACE INTO jobs (id, status, data, created_at, finished_at) VALUES (?, ?, ?, ?, ?)",
+		j.ID, j.Status, data, formatTime(j.CreatedAt), finishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+// GetJob loads a job record
+func (s *Store) GetJob(ctx context.Context, id string) (Job, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM jobs WHERE id = ?", id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, fmt.Errorf("%w: job %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return decodeJob(id, data)
+}
+
+// ListJobs returns every job record, newest first
+func (s *Store) ListJobs(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, data FROM jobs ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		j, err := decodeJob(id, data)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteJob removes a job record
+func (s *Store) DeleteJob(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM jobs WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: job %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// decodeJob decodes a stored job record
+func decodeJob(id string, data []byte) (Job, error) {
+	var j Job
+	if err := msgpack.Unmarshal(data, &j); err != nil {
+		return Job{}, fmt.Errorf("corrupt job %s: %w", id, err)
+	}
+	return j, nil
+}
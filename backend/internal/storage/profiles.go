@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Environment labels for profiles
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// colorPattern matches "#rrggbb" colors
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Profile is a saved connection. Secrets are never stored with it.
+type Profile struct {
+	ID             string               `msgpack:"id"`
+	Name           string               `msgpack:"name"`
+	Group          string               `msgpack:"group"`
+	Color          string               `msgpack:"color"`       // "#rrggbb"
+	Environment    string               `msgpack:"environment"` // dev, staging, prod or empty
+	Driver         string               `msgpack:"driver"`
+	DSN            string               `msgpack:"dsn"`
+	PasswordSecret string               `msgpack:"password_secret"` // Stored secret holding the password
+	Pool           database.PoolOptions `msgpack:"pool"`
+	SSH            *database.SSHOptions `msgpack:"ssh"`
+	TLS            *database.TLSOptions `msgpack:"tls"`
+	ReadOnly       bool                 `msgpack:"read_only"` // Production safe mode: refuse writes
+	Limits         database.QueryLimits `msgpack:"limits"`    // Default query timeout and row limit
+	CreatedAt      time.Time            `msgpack:"created_at"`
+	UpdatedAt      time.Time            `msgpack:"updated_at"`
+}
+
+// ProfileFilter narrows a profile listing; empty fields match everything
+type ProfileFilter struct {
+	Group       string `msgpack:"group"`
+	Environment string `msgpack:"environment"`
+}
+
+// Group is a profile group and the number of profiles in it
+type Group struct {
+	Name     string `msgpack:"name"`
+	Profiles int    `msgpack:"profiles"`
+}
+
+// profileOptions is the serialized form of the nested connection settings
+type profileOptions struct {
+	PasswordSecret string               `msgpack:"password_secret"`
+	Pool           database.PoolOptions `msgpack:"pool"`
+	SSH            *database.SSHOptions `msgpack:"ssh"`
+	TLS            *database.TLSOptions `msgpack:"tls"`
+	ReadOnly       bool                 `msgpack:"read_only"`
+	Limits         database.QueryLimits `msgpack:"limits"`
+}
+
+// Connection returns the profile as a connection request
+func (p Profile) Connection() database.Profile {
+	return database.Profile{
+		Name:           p.Name,
+		Driver:         p.Driver,
+		DSN:            p.DSN,
+		PasswordSecret: p.PasswordSecret,
+		Pool:           p.Pool,
+		SSH:            p.SSH,
+		TLS:            p.TLS,
+		ReadOnly:       p.ReadOnly,
+		Limits:         p.Limits,
+	}
+}
+
+// normalize validates the profile and strips its secrets.
+// It returns the names of the removed secret fields.
+func (p *Profile) normalize() ([]string, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Group = strings.TrimSpace(p.Group)
+	p.Environment = strings.ToLower(strings.TrimSpace(p.Environment))
+
+	if p.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	conn, err := p.Connection().NormalizeConnection()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	p.Driver, p.DSN = conn.Driver, conn.DSN
+	if p.DSN == "" {
+		return nil, fmt.Errorf("%w: dsn is required", ErrInvalid)
+	}
+	switch p.Environment {
+	case "", EnvDev, EnvStaging, EnvProd:
+	default:
+		return nil, fmt.Errorf("%w: environment must be dev, staging or prod (got %q)", ErrInvalid, p.Environment)
+	}
+	if p.Color != "" && !colorPattern.MatchString(p.Color) {
+		return nil, fmt.Errorf("%w: color must be written as #rrggbb (got %q)", ErrInvalid, p.Color)
+	}
+
+	conn, removed, err := p.Connection().WithoutSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	p.DSN, p.SSH, p.TLS = conn.DSN, conn.SSH, conn.TLS
+	return removed, nil
+}
+
+// CreateProfile saves a new profile. Secrets in it are dropped and reported.
+func (s *Store) CreateProfile(ctx context.Context, p Profile) (Profile, []string, error) {
+	removed, err := p.normalize()
+	if err != nil {
+		return Profile{}, nil, err
+	}
+
+	if p.ID, err = ids.New("prof_"); err != nil {
+		return Profile{}, nil, err
+	}
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
+
+	options, err := msgpack.Marshal(profileOptions{PasswordSecret: p.PasswordSecret, Pool: p.Pool, SSH: p.SSH, TLS: p.TLS, ReadOnly: p.ReadOnly, Limits: p.Limits})
+	if err != nil {
+		return Profile{}, nil, err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO profiles (id, name, group_name, color, environment, driver, dsn, options, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Group, p.Color, p.Environment, p.Driver, p.DSN, options,
+		formatTime(p.CreatedAt), formatTime(p.UpdatedAt),
+	)
+	if err != nil {
+		return Profile{}, nil, fmt.Errorf("failed to save profile: %w", err)
+	}
+	return p, removed, nil
+}
+
+// UpdateProfile replaces a saved profile. Secrets in it are dropped and reported.
+func (s *Store) UpdateProfile(ctx context.Context, p Profile) (Profile, []string, error) {
+	existing, err := s.GetProfile(ctx, p.ID)
+	if err != nil {
+		return Profile{}, nil, err
+	}
+
+	removed, err := p.normalize()
+	if err != nil {
+		return Profile{}, nil, err
+	}
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+
+	options, err := msgpack.Marshal(profileOptions{PasswordSecret: p.PasswordSecret, Pool: p.Pool, SSH: p.SSH, TLS: p.TLS, ReadOnly: p.ReadOnly, Limits: p.Limits})
+	if err != nil {
+		return Profile{}, nil, err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE profiles
+		SET name = ?, group_name = ?, color = ?, environment = ?, driver = ?, dsn = ?, options = ?, updated_at = ?
+		WHERE id = ?`,
+		p.Name, p.Group, p.Color, p.Environment, p.Driver, p.DSN, options, formatTime(p.UpdatedAt), p.ID,
+	)
+	if err != nil {
+		return Profile{}, nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+	return p, removed, nil
+}
+
+// DeleteProfile removes a saved profile
+func (s *Store) DeleteProfile(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM profiles WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete profile: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: profile %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// GetProfile loads a saved profile
+func (s *Store) GetProfile(ctx context.Context, id string) (Profile, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+profileColumns+" FROM profiles WHERE id = ?", id)
+	p, err := scanProfile(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, fmt.Errorf("%w: profile %s", ErrNotFound, id)
+	}
+	return p, err
+}
+
+// ListProfiles returns the matching profiles ordered by group and name
+func (s *Store) ListProfiles(ctx context.Context, filter ProfileFilter) ([]Profile, error) {
+	query := "SELECT " + profileColumns + " FROM profiles WHERE 1 = 1"
+	var args []interface{}
+	if filter.Group != "" {
+		query += " AND group_name = ?"
+		args = append(args, filter.Group)
+	}
+	if filter.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, strings.ToLower(filter.Environment))
+	}
+	query += " ORDER BY group_name, name COLLATE NOCASE, created_at"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := []Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// DuplicateProfile copies a saved profile under a new ID.
+// An empty name gives the copy the original's name with " (copy)" appended.
+func (s *Store) DuplicateProfile(ctx context.Context, id, name string) (Profile, error) {
+	p, err := s.GetProfile(ctx, id)
+	if err != nil {
+		return Profile{}, err
+	}
+	if name == "" {
+		name = p.Name + " (copy)"
+	}
+	p.Name = name
+
+	copied, _, err := s.CreateProfile(ctx, p)
+	return copied, err
+}
+
+// GroupProfiles moves profiles into a group; an empty group ungroups them
+func (s *Store) GroupProfiles(ctx context.Context, ids []string, group string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := formatTime(time.Now().UTC())
+	for _, id := range ids {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE profiles SET group_name = ?, updated_at = ? WHERE id = ?",
+			strings.TrimSpace(group), now, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to group profiles: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("%w: profile %s", ErrNotFound, id)
+		}
+	}
+	return tx.Commit()
+}
+
+// Groups returns every profile group with its size; ungrouped profiles are listed under ""
+func (s *Store) Groups(ctx context.Context) ([]Group, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT group_name, COUNT(*) FROM profiles GROUP BY group_name ORDER BY group_name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.Name, &g.Profiles); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// profileColumns lists the columns read by scanProfile
+const profileColumns = "id, name, group_name, color, environment, driver, dsn, options, created_at, updated_at"
+
+// scanProfile reads a profile row
+func scanProfile(row interface{ Scan(...interface{}) error }) (Profile, error) {
+	var p Profile
+	var options []byte
+	var createdAt, updatedAt string
+	err := row.Scan(&p.ID, &p.Name, &p.Group, &p.Color, &p.Environment, &p.Driver, &p.DSN, &options, &createdAt, &updatedAt)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if len(options) > 0 {
+		var opts profileOptions
+		if err := msgpack.Unmarshal(options, &opts); err != nil {
+			return Profile{}, fmt.Errorf("corrupt options for profile %s: %w", p.ID, err)
+		}
+		p.PasswordSecret, p.Pool, p.SSH, p.TLS, p.ReadOnly, p.Limits = opts.PasswordSecret, opts.Pool, opts.SSH, opts.TLS, opts.ReadOnly, opts.Limits
+	}
+	p.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	p.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAt)
+	return p, nil
+}
+
+// formatTime formats a timestamp for storage
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
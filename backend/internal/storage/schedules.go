@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"litebase-backend/internal/cron"
+	"litebase-backend/internal/database"
+	"litebase-backend/internal/ids"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Assertion kinds
+const (
+	AssertRowCount = "row_count" // Number of rows returned
+	AssertValue    = "value"     // Numeric value of one cell
+)
+
+// Run statuses
+const (
+	RunPassed = "passed" // The query succeeded and every assertion held
+	RunFailed = "failed" // The query succeeded but an assertion did not hold
+	RunError  = "error"  // The connection or the query failed
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// comparisons maps assertion operators to their symbols
+var comparisons = map[string]string{"eq": "=", "ne": "!=", "lt": "<", "le": "<=", "gt": ">", "ge": ">="}
+
+// Assertion is a check on the result of a scheduled query
+type Assertion struct {
+	Kind   string  `msgpack:"kind"`   // row_count or value
+	Column string  `msgpack:"column"` // value: column name
+	Row    int     `msgpack:"row"`    // value: zero-based row index
+	Op     string  `msgpack:"op"`     // eq, ne, lt, le, gt or ge
+	Value  float64 `msgpack:"value"`
+}
+
+// String describes the assertion, e.g. "row_count > 0"
+func (a Assertion) String() string {
+	subject := AssertRowCount
+	if a.Kind == AssertValue {
+		subject = fmt.Sprintf("%s[%d]", a.Column, a.Row)
+	}
+	return fmt.Sprintf("%s %s %v", subject, comparisons[a.Op], a.Value)
+}
+
+// Holds reports whether actual satisfies the assertion's comparison
+func (a Assertion) Holds(actual float64) bool {
+	switch a.Op {
+	case "eq":
+		return actual == a.Value
+	case "ne":
+		return actual != a.Value
+	case "lt":
+		return actual < a.Value
+	case "le":
+		return actual <= a.Value
+	case "gt":
+		return actual > a.Value
+	case "ge":
+		return actual >= a.Value
+	}
+	return false
+}
+
+// AssertionResult is the outcome of one assertion in a run
+type AssertionResult struct {
+	Assertion
+	Passed  bool        `msgpack:"passed"`
+	Actual  interface{} `msgpack:"actual"` // The value compared, if there was one
+	Message string      `msgpack:"message"`
+}
+
+// Schedule is a saved query run on a saved connection profile at the times
+// given by a cron expression
+type Schedule struct {
+	ID         string               `msgpack:"id"`
+	Name       string               `msgpack:"name"`
+	ProfileID  string               `msgpack:"profile_id"`
+	SQL        string               `msgpack:"sql"`
+	Params     []database.Param     `msgpack:"params"`
+	Cron       string               `msgpack:"cron"`
+	Timezone   string               `msgpack:"timezone"` // IANA zone the expression is read in; local time when empty
+	Paused     bool                 `msgpack:"paused"`
+	Limits     database.QueryLimits `msgpack:"limits"`
+	Assertions []Assertion          `msgpack:"assertions"`
+	CreatedAt  time.Time            `msgpack:"created_at"`
+	UpdatedAt  time.Time            `msgpack:"updated_at"`
+	NextRun    *time.Time           `msgpack:"next_run"` // Filled in by the scheduler; not stored
+	LastRun    *ScheduleRun         `msgpack:"last_run"` // Filled in by the scheduler; not stored
+}
+
+// ScheduleRun is one execution of a schedule
+type ScheduleRun struct {
+	ID           string            `msgpack:"id"`
+	ScheduleID   string            `msgpack:"schedule_id"`
+	ScheduleName string            `msgpack:"schedule_name"`
+	Trigger      string            `msgpack:"trigger"` // schedule or manual
+	Status       string            `msgpack:"status"`
+	Error        string            `msgpack:"error"`
+	Assertions   []AssertionResult `msgpack:"assertions"`
+	Columns      []database.Column `msgpack:"columns"`
+	Rows         [][]interface{}   `msgpack:"rows"`      // Left out of run listings
+	RowCount     int64             `msgpack:"row_count"` // Rows returned, even when Rows is left out
+	RowsAffected int64             `msgpack:"rows_affected"`
+	Truncated    bool              `msgpack:"truncated"`
+	StartedAt    time.Time         `msgpack:"started_at"`
+	DurationMs   int64             `msgpack:"duration_ms"`
+}
+
+// Location returns the time zone the schedule's expression is read in
+func (sc Schedule) Location() (*time.Location, error) {
+	if sc.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(sc.Timezone)
+}
+
+// normalize validates the schedule
+func (sc *Schedule) normalize() error {
+	sc.Name = strings.TrimSpace(sc.Name)
+	sc.Cron = strings.TrimSpace(sc.Cron)
+	sc.Timezone = strings.TrimSpace(sc.Timezone)
+
+	if sc.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if sc.ProfileID == "" {
+		return fmt.Errorf("%w: profile_id is required", ErrInvalid)
+	}
+	if strings.TrimSpace(sc.SQL) == "" {
+		return fmt.Errorf("%w: sql is required", ErrInvalid)
+	}
+	if _, err := cron.Parse(sc.Cron); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if _, err := sc.Location(); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, sc.Timezone)
+	}
+	if sc.Limits.TimeoutMs < 0 || sc.Limits.MaxRows < 0 || sc.Limits.MaxValueSize < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalid)
+	}
+	for i, a := range sc.Assertions {
+		if _, ok := comparisons[a.Op]; !ok {
+			return fmt.Errorf("%w: assertions[%d].op must be eq, ne, lt, le, gt or ge", ErrInvalid, i)
+		}
+		switch a.Kind {
+		case AssertRowCount:
+		case AssertValue:
+			if a.Column == "" || a.Row < 0 {
+				return fmt.Errorf("%w: assertions[%d] needs a column and a row that is not negative", ErrInvalid, i)
+			}
+		default:
+			return fmt.Errorf("%w: assertions[%d].kind must be row_count or value", ErrInvalid, i)
+		}
+	}
+	if sc.Params == nil {
+		sc.Params = []database.Param{}
+	}
+	if sc.Assertions == nil {
+		sc.Assertions = []Assertion{}
+	}
+	sc.NextRun, sc.LastRun = nil, nil
+	return nil
+}
+
+// CreateSchedule saves a new schedule for an existing profile
+func (s *Store) CreateSchedule(ctx context.Context, sc Schedule) (Schedule, error) {
+	if err := sc.normalize(); err != nil {
+		return Schedule{}, err
+	}
+	if err := s.checkProfile(ctx, sc.ProfileID); err != nil {
+		return Schedule{}, err
+	}
+
+	id, err := ids.New("sch_")
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc.ID = id
+	sc.CreatedAt = time.Now().UTC()
+	sc.UpdatedAt = sc.CreatedAt
+
+	data, err := msgpack.Marshal(sc)
+	if err != nil {
+		return Schedule{}, err
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO schedules (id, name, data, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		sc.ID, sc.Name, data, formatTime(sc.CreatedAt), formatTime(sc.UpdatedAt),
+	)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return sc, nil
+}
+
+// UpdateSchedule replaces a saved schedule
+func (s *Store) UpdateSchedule(ctx context.Context, sc Schedule) (Schedule, error) {
+	existing, err := s.GetSchedule(ctx, sc.ID)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if err := sc.normalize(); err != nil {
+		return Schedule{}, err
+	}
+	if err := s.checkProfile(ctx, sc.ProfileID); err != nil {
+		return Schedule{}, err
+	}
+	sc.CreatedAt = existing.CreatedAt
+	sc.UpdatedAt = time.Now().UTC()
+
+	data, err := msgpack.Marshal(sc)
+	if err != nil {
+		return Schedule{}, err
+	}
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE schedules SET name = ?, data = ?, updated_at = ? WHERE id = ?",
+		sc.Name, data, formatTime(sc.UpdatedAt), sc.ID,
+	)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return sc, nil
+}
+
+// checkProfile fails with ErrInvalid unless the profile exists
+func (s *Store) checkProfile(ctx context.Context, id string) error {
+	_, err := s.GetProfile(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: profile %s does not exist", ErrInvalid, id)
+	}
+	return err
+}
+
+// DeleteSchedule removes a schedule and its run history
+func (s *Store) DeleteSchedule(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: schedule %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// GetSchedule loads a saved schedule
+func (s *Store) GetSchedule(ctx context.Context, id string) (Schedule, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM schedules WHERE id = ?", id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schedule{}, fmt.Errorf("%w: schedule %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Schedule{}, err
+	}
+	var sc Schedule
+	if err := msgpack.Unmarshal(data, &sc); err != nil {
+		return Schedule{}, fmt.Errorf("corrupt schedule %s: %w", id, err)
+	}
+	return sc, nil
+}
+
+// ListSchedules returns every saved schedule ordered by name
+func (s *Store) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, data FROM schedules ORDER BY name COLLATE NOCASE, created_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		var sc Schedule
+		if err := msgpack.Unmarshal(data, &sc); err != nil {
+			return nil, fmt.Errorf("corrupt schedule %s: %w", id, err)
+		}
+		schedules = append(schedules, sc)
+	}
+	return schedules, rows.Err()
+}
+
+// SaveScheduleRun records a run and deletes the schedule's oldest runs
+// beyond the newest keep
+func (s *Store) SaveScheduleRun(ctx context.Context, run ScheduleRun, keep int) error {
+	data, err := msgpack.Marshal(run)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO schedule_runs (id, schedule_id, status, data, started_at) VALUES (?, ?, ?, ?, ?)",
+		run.ID, run.ScheduleID, run.Status, data, formatTime(run.StartedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save schedule run: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM schedule_runs
+		WHERE schedule_id = ? AND id NOT IN (
+			SELECT id FROM schedule_runs WHERE schedule_id = ? ORDER BY started_at DESC LIMIT ?
+		)`,
+		run.ScheduleID, run.ScheduleID, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune schedule runs: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListScheduleRuns returns up to limit runs of a schedule, newest first,
+// without their rows
+func (s *Store) ListScheduleRuns(ctx context.Context, scheduleID string, limit int) ([]ScheduleRun, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, data FROM schedule_runs WHERE schedule_id = ? ORDER BY started_at DESC LIMIT ?",
+		scheduleID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		run, err := decodeScheduleRun(id, data)
+		if err != nil {
+			return nil, err
+		}
+		run.Rows = nil
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetScheduleRun loads a run with its rows
+func (s *Store) GetScheduleRun(ctx context.Context, id string) (ScheduleRun, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM schedule_runs WHERE id = ?", id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ScheduleRun{}, fmt.Errorf("%w: run %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return ScheduleRun{}, err
+	}
+	return decodeScheduleRun(id, data)
+}
+
+// decodeScheduleRun decodes a stored run record
+func decodeScheduleRun(id string, data []byte) (ScheduleRun, error) {
+	var run ScheduleRun
+	if err := msgpack.Unmarshal(data, &run); err != nil {
+		return ScheduleRun{}, fmt.Errorf("corrupt schedule run %s: %w", id, err)
+	}
+	return run, nil
+}
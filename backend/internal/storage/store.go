@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned for unknown record IDs
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned when a record fails validation
+	ErrInvalid = errors.New("invalid record")
+)
+
+// FileName is the name of the database file inside the data directory
+const FileName = "litebase.db"
+
+// Store is the backend's local SQLite database
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// Open opens (creating if needed) the database at path and applies pending migrations
+func Open(ctx context.Context, path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	// The file holds connection details; keep it and its journal files private.
+	// SQLite gives the WAL and shared-memory files the main file's permissions.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	f.Close()
+	if err := os.Chmod(path, 0600); err != nil {
+		return nil, fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+
+	// A URL escapes ? and # in the data directory, which would otherwise
+	// start the parameters; an empty host needs an absolute path
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	dsn := (&url.URL{
+		Scheme:   "file",
+		Path:     abs,
+		RawQuery: "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL",
+	}).String()
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	store := &Store{db: db, path: path}
+	if err := store.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Path returns the database file path
+func (s *Store) Path() string {
+	return s.path
+}
+
+// DB returns the underlying database handle
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// migration is one step of the schema history. Applied steps must never change.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations lists every schema change in order
+var migrations = []migration{
+	{1, "create profiles", `
+		CREATE TABLE profiles (
+			id          TEXT PRIMARY KEY,
+			name        TEXT NOT NULL,
+			group_name  TEXT NOT NULL DEFAULT '',
+			color       TEXT NOT NULL DEFAULT '',
+			environment TEXT NOT NULL DEFAULT '',
+			driver      TEXT NOT NULL,
+			dsn         TEXT NOT NULL,
+			options     BLOB,
+			created_at  TEXT NOT NULL,
+			updated_at  TEXT NOT NULL
+		);
+		CREATE INDEX profiles_group ON profiles (group_name, name);
+	`},
+	{2, "create jobs", `
+		CREATE TABLE jobs (
+			id          TEXT PRIMARY KEY,
+			status      TEXT NOT NULL,
+			data        BLOB NOT NULL,
+			created_at  TEXT NOT NULL,
+			finished_at TEXT
+		);
+		CREATE INDEX jobs_created ON jobs (created_at);
+	`},
+	{3, "create schedules", `
+		CREATE TABLE schedules (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			data       BLOB NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+		CREATE TABLE schedule_runs (
+			id          TEXT PRIMARY KEY,
+			schedule_id TEXT NOT NULL REFERENCES schedules (id) ON DELETE CASCADE,
+			status      TEXT NOT NULL,
+			data        BLOB NOT NULL,
+			started_at  TEXT NOT NULL
+		);
+		CREATE INDEX schedule_runs_started ON schedule_runs (schedule_id, started_at);
+	`},
+}
+
+// migrate applies the migrations newer than the database's schema version
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("database schema version %d is newer than this backend supports (%d)", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.apply(ctx, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration in a transaction
+func (s *Store) apply(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339Nano),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START)
+const listenFdsStart = 3
+
+// Listener is a listening socket inherited from the service manager
+type Listener struct {
+	net.Listener
+	Name string // Value from FileDescriptorName=, if any
+}
+
+// Listeners returns the sockets passed to this process via LISTEN_FDS/LISTEN_PID.
+// It returns no listeners (and no error) when the process was not socket-activated.
+// The activation environment is cleared so that child processes don't inherit it.
+func Listeners() ([]Listener, error) {
+	defer unsetActivationEnv()
+
+	pidStr := os.Getenv("LISTEN_PID")
+	fdsStr := os.Getenv("LISTEN_FDS")
+	if pidStr == "" || fdsStr == "" {
+		return nil, nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_PID %q: %w", pidStr, err)
+	}
+	if pid != os.Getpid() {
+		// The sockets were meant for another process (e.g. our parent)
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(fdsStr)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+
+	var names []string
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	listeners := make([]Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		listener, err := net.FileListener(file)
+		// FileListener dups the descriptor, so the original can always be closed
+		file.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("inherited fd %d is not a listening socket: %w", fd, err)
+		}
+
+		listeners = append(listeners, Listener{Listener: listener, Name: name})
+	}
+
+	return listeners, nil
+}
+
+// unsetActivationEnv removes the socket activation variables from the environment
+func unsetActivationEnv() {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+}
+
+// closeListeners closes listeners collected before a failure
+func closeListeners(listeners []Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
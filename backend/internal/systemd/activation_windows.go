@@ -0,0 +1,16 @@
+//go:build windows
+
+package systemd
+
+import "net"
+
+// Listener is a listening socket inherited from the service manager
+type Listener struct {
+	net.Listener
+	Name string
+}
+
+// Listeners always returns no listeners on Windows
+func Listeners() ([]Listener, error) {
+	return nil, nil
+}
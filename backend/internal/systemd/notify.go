@@ -0,0 +1,46 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// Notification states understood by systemd (see sd_notify(3))
+const (
+	StateReady     = "READY=1"
+	StateStopping  = "STOPPING=1"
+	StateReloading = "RELOADING=1"
+)
+
+// Notify sends a state update to the service manager.
+// It returns false (and no error) when NOTIFY_SOCKET is not set,
+// i.e. the process is not running under systemd with Type=notify.
+func Notify(state string) (bool, error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return false, nil
+	}
+
+	// Abstract namespace sockets are announced with a leading '@'
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return true, nil
+}
+
+// Status formats a free-form STATUS= notification
+func Status(status string) string {
+	return "STATUS=" + status
+}
@@ -0,0 +1,257 @@
+// Package values keeps the full form of large values that were truncated in
+// query results, so clients can fetch them in chunks.
+package values
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"litebase-backend/internal/ids"
+	"litebase-backend/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned for unknown or expired value references
+	ErrNotFound = errors.New("value not found")
+	// ErrInvalid is returned for malformed fetch requests
+	ErrInvalid = errors.New("invalid value request")
+	// ErrTooLarge is returned for values larger than the disk quota
+	ErrTooLarge = errors.New("value exceeds the disk quota")
+)
+
+const (
+	// DefaultChunk is the number of bytes a fetch returns when no length is given
+	DefaultChunk = 1 << 20
+	// MaxChunk is the largest number of bytes one fetch returns
+	MaxChunk = 8 << 20
+	// filePrefix names value files in the store directory
+	filePrefix = "value_"
+)
+
+// Config configures the value store
+type Config struct {
+	Logger    logger.Logger
+	Dir       string        // Holds the value files; leftovers are removed on start
+	Retention time.Duration // Values are deleted this long after they were kept
+	DiskQuota int64         // Bytes all values may use together; the oldest are deleted first. 0 for no limit
+}
+
+// Info describes a kept value
+type Info struct {
+	Ref       string    `msgpack:"ref"`
+	Kind      string    `msgpack:"kind"` // text, binary or json
+	Size      int64     `msgpack:"size"`
+	ExpiresAt time.Time `msgpack:"expires_at"`
+
+	owner string // Session that may read the value; empty for any session
+}
+
+// Store keeps truncated values in files until they expire
+type Store struct {
+	dir    string
+	logger logger.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	values    map[string]*Info
+	used      int64
+	retention time.Duration
+	diskQuota int64
+
+	wg sync.WaitGroup
+}
+
+// NewStore creates the value directory and starts expiring old values
+func NewStore(config Config) (*Store, error) {
+	if config.Logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	if config.Retention <= 0 {
+		return nil, fmt.Errorf("retention must be positive")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create value directory: %w", err)
+	}
+	// Values of a previous run with our process ID are unreachable
+	leftovers, _ := filepath.Glob(filepath.Join(config.Dir, filePrefix+"*"))
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Store{
+		dir:       config.Dir,
+		logger:    config.Logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		values:    make(map[string]*Info),
+		retention: config.Retention,
+		diskQuota: config.DiskQuota,
+	}
+	s.wg.Add(1)
+	go s.expire()
+	return s, nil
+}
+
+// SetLimits changes the retention and disk quota. Values kept before keep
+// their expiry time.
+func (s *Store) SetLimits(retention time.Duration, diskQuota int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention, s.diskQuota = retention, diskQuota
+	s.evictLocked(0)
+}
+
+// Keep stores a value for owner and returns its reference. A value without
+// an owner can be read by any session. It implements database.ValueKeeper.
+func (s *Store) Keep(owner, kind string, data []byte) (string, error) {
+	size := int64(len(data))
+	s.mu.Lock()
+	quota := s.diskQuota
+	s.mu.Unlock()
+	if quota > 0 && size > quota {
+		return "", fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+
+	ref, err := ids.NewToken("val_")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(s.path(ref), data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write value: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictLocked(size)
+	s.values[ref] = &Info{Ref: ref, Kind: kind, Size: size, ExpiresAt: time.Now().Add(s.retention), owner: owner}
+	s.used += size
+	return ref, nil
+}
+
+// Read returns up to length bytes of a value starting at offset. A length
+// of zero reads DefaultChunk bytes. Values kept for another session are
+// reported as not found.
+func (s *Store) Read(ref, owner string, offset, length int64) ([]byte, Info, error) {
+	switch {
+	case offset < 0:
+		return nil, Info{}, fmt.Errorf("%w: offset must not be negative", ErrInvalid)
+	case length < 0 || length > MaxChunk:
+		return nil, Info{}, fmt.Errorf("%w: length must be between 0 and %d", ErrInvalid, MaxChunk)
+	case length == 0:
+		length = DefaultChunk
+	}
+
+	s.mu.Lock()
+	v, ok := s.values[ref]
+	if ok && v.owner != "" && v.owner != owner {
+		// Another session's value
+		ok = false
+	}
+	var info Info
+	if ok {
+		info = *v
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, Info{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	if offset > info.Size {
+		return nil, Info{}, fmt.Errorf("%w: offset %d is past the end of the value (%d bytes)", ErrInvalid, offset, info.Size)
+	}
+
+	f, err := os.Open(s.path(ref))
+	if err != nil {
+		// Deleted by expiry after the lookup
+		return nil, Info{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	defer f.Close()
+	data := make([]byte, min(length, info.Size-offset))
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, Info{}, fmt.Errorf("failed to read value: %w", err)
+	}
+	return data, info, nil
+}
+
+// Shutdown stops the expiry loop and deletes every value
+func (s *Store) Shutdown() error {
+	s.cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ref := range s.values {
+		s.removeLocked(ref)
+	}
+	os.Remove(s.dir)
+	return nil
+}
+
+// path returns the file of a value
+func (s *Store) path(ref string) string {
+	return filepath.Join(s.dir, filePrefix+ref)
+}
+
+// removeLocked deletes a value; s.mu must be held
+func (s *Store) removeLocked(ref string) {
+	v, ok := s.values[ref]
+	if !ok {
+		return
+	}
+	delete(s.values, ref)
+	s.used -= v.Size
+	if err := os.Remove(s.path(ref)); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("Failed to delete value file", zap.String("ref", ref), zap.Error(err))
+	}
+}
+
+// evictLocked deletes the oldest values until another extra bytes fit in
+// the disk quota; s.mu must be held
+func (s *Store) evictLocked(extra int64) {
+	if s.diskQuota <= 0 || s.used+extra <= s.diskQuota {
+		return
+	}
+	oldest := make([]*Info, 0, len(s.values))
+	for _, v := range s.values {
+		oldest = append(oldest, v)
+	}
+	sort.Slice(oldest, func(i, j int) bool { return oldest[i].ExpiresAt.Before(oldest[j].ExpiresAt) })
+	for _, v := range oldest {
+		if s.used+extra <= s.diskQuota {
+			return
+		}
+		s.removeLocked(v.Ref)
+	}
+}
+
+// expire deletes values past their expiry time
+func (s *Store) expire() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for ref, v := range s.values {
+				if now.After(v.ExpiresAt) {
+					s.removeLocked(ref)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
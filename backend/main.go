@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"litebase-backend/internal/config"
 	"litebase-backend/internal/logger"
 	"litebase-backend/internal/server"
 
@@ -19,33 +21,84 @@ var (
 	buildTime = "unknown"
 )
 
+// flagKeys maps command line flags to the config keys they override
+var flagKeys = map[string]string{
+	"socket":        "ipc.socket_path",
+	"pipe":          "ipc.pipe_name",
+	"log-level":     "log.level",
+	"port":          "ipc.port",
+	"drain-timeout": "ipc.drain_timeout",
+}
+
 func main() {
 	// Parse command line flags
 	var (
-		socketPath = flag.String("socket", "", "Unix domain socket path (Linux/macOS)")
-		pipeName   = flag.String("pipe", "", "Named pipe name (Windows)")
-		logLevel   = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-		port       = flag.Int("port", 0, "TCP port for development (optional)")
+		configPath  = flag.String("config", os.Getenv("LITEBASE_CONFIG"), "Config file path (.toml, .yaml or .yml)")
+		printConfig = flag.Bool("print-config", false, "Print the effective configuration and exit")
+		_           = flag.String("socket", "", "Unix domain socket path (Linux/macOS)")
+		_           = flag.String("pipe", "", "Named pipe name (Windows)")
+		_           = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+		_           = flag.Int("port", 0, "TCP port for development (optional)")
+		_           = flag.Duration("drain-timeout", 5*time.Minute, "How long to wait for clients to disconnect after an upgrade")
+		takeover    = flag.Bool("takeover", false, "Stop a running backend on the same socket and take over")
+		upgrade     = flag.Bool("upgrade", false, "Take the listening socket over from a running backend without dropping connections")
 	)
 	flag.Parse()
 
+	// Flags only override the configuration when given explicitly
+	overrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			overrides[key] = f.Value.String()
+		}
+	})
+
+	// Load configuration: defaults < config file < LITEBASE_* env < flags
+	loadConfig := func() (*config.Config, error) {
+		return config.Load(config.LoadOptions{Path: *configPath, Overrides: overrides})
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := cfg.WriteTOML(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
-	logger := logger.New(*logLevel)
+	logger := logger.NewWithOptions(logger.Options{
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+		Redact: cfg.Log.Redact,
+	})
 	defer logger.Sync()
 
 	logger.Info("Starting LiteBase Backend", zap.String("version", version), zap.String("buildTime", buildTime))
 
 	// Create server configuration
-	config := &server.Config{
-		SocketPath: *socketPath,
-		PipeName:   *pipeName,
-		Port:       *port,
-		Logger:     logger,
-		DebugMode:  *logLevel == "debug",
+	serverConfig := &server.Config{
+		SocketPath:     cfg.IPC.SocketPath,
+		PipeName:       cfg.IPC.PipeName,
+		Port:           cfg.IPC.Port,
+		Logger:         logger,
+		DebugMode:      cfg.Log.Level == "debug",
+		Takeover:       *takeover,
+		Upgrade:        *upgrade,
+		ReadTimeout:    cfg.IPC.ReadTimeout.Std(),
+		WriteTimeout:   cfg.IPC.WriteTimeout.Std(),
+		MaxMessageSize: cfg.IPC.MaxMessageSize,
+		Settings:       cfg,
+		LoadConfig:     loadConfig,
 	}
 
 	// Create and start server
-	srv, err := server.New(config)
+	srv, err := server.New(serverConfig)
 	if err != nil {
 		logger.Error("Failed to create server", zap.Error(err))
 		os.Exit(1)
@@ -55,16 +108,47 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Re-read configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			logger.Info("Reloading configuration...")
+			if _, err := srv.Reload(); err != nil {
+				logger.Error("Failed to reload configuration", zap.Error(err))
+			}
+		}
+	}()
+
 	// Start server in background
+	startFailed := make(chan struct{})
 	go func() {
 		if err := srv.Start(); err != nil {
 			logger.Error("Server failed to start", zap.Error(err))
+			close(startFailed)
 			// Don't exit immediately, allow graceful shutdown
 			quit <- syscall.SIGTERM
 		}
 	}()
 
-	<-quit
+	select {
+	case <-quit:
+	case <-srv.HandedOff():
+		// A newer backend serves new connections; let existing clients finish
+		drainCtx, cancel := context.WithTimeout(context.Background(), srv.Settings().IPC.DrainTimeout.Std())
+		go func() {
+			// A signal during the drain cuts it short
+			select {
+			case <-quit:
+				cancel()
+			case <-drainCtx.Done():
+			}
+		}()
+		if err := srv.Drain(drainCtx); err != nil {
+			logger.Warn("Closing remaining client connections", zap.Error(err))
+		}
+		cancel()
+	}
 
 	logger.Info("Shutting down server...")
 
@@ -78,5 +162,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	select {
+	case <-startFailed:
+		os.Exit(1)
+	default:
+	}
+
 	logger.Info("Server exited gracefully")
 }